@@ -5,13 +5,22 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+const (
+	LogTimestampFormat string = "2006-01-02 15:04:05.000"
+
+	WaitTimeoutDefault  time.Duration = 5 * time.Minute
+	WaitPollingInterval time.Duration = 200 * time.Millisecond
+)
+
 func SetCommonFlags(command *cobra.Command) {
 	command.Flags().StringP("config", "c", "", "Set config file (yaml)")
 	command.Flags().BoolP("version", "v", false, "Print version")
@@ -19,6 +28,99 @@ func SetCommonFlags(command *cobra.Command) {
 	command.Flags().BoolP("debug", "d", false, "Enable debug mode")
 }
 
+// TurnInOptions is a struct to store options given to turn-in requests
+type TurnInOptions struct {
+	TTL         time.Duration
+	Priority    turnin.TurnInPriority
+	Output      OutputFormat
+	Wait        bool
+	WaitTimeout time.Duration // 0 to wait forever
+	Direct      bool          // submit over the control socket of the service
+}
+
+// Apply applies options to the turn-in item
+func (options *TurnInOptions) Apply(item turnin.TurnInItem) {
+	if options.TTL > 0 {
+		item.SetExpiryTime(item.GetCreationTime().Add(options.TTL))
+	}
+
+	item.SetPriority(options.Priority)
+	item.SetResultRequested(options.Wait)
+}
+
+func SetTurnInFlags(command *cobra.Command) {
+	command.Flags().Duration("ttl", 0, "Set time-to-live of the request (e.g., 30m, 24h), the request expires if not processed in time")
+	command.Flags().String("priority", "normal", "Set priority of the request (low, normal, high)")
+	command.Flags().StringP("output", "o", string(OutputFormatText), "Set output format (text, json)")
+	command.Flags().Bool("direct", false, "Submit the request to the service over its control socket, falls back to the turn-in dir if the service is unavailable")
+}
+
+// SetWaitFlags sets flags to wait for requests processed
+func SetWaitFlags(command *cobra.Command) {
+	command.Flags().String("wait", "", "Wait until the request is processed, with optional timeout (e.g., --wait, --wait=10m), 0 to wait forever")
+	command.Flags().Lookup("wait").NoOptDefVal = WaitTimeoutDefault.String()
+}
+
+func ProcessTurnInFlags(command *cobra.Command) (*TurnInOptions, error) {
+	options := &TurnInOptions{}
+
+	ttlFlag := command.Flags().Lookup("ttl")
+	if ttlFlag != nil {
+		ttl, err := time.ParseDuration(ttlFlag.Value.String())
+		if err != nil {
+			return nil, NewInvalidArgumentErrorf("failed to parse ttl %s - %v", ttlFlag.Value.String(), err)
+		}
+
+		if ttl < 0 {
+			return nil, NewInvalidArgumentErrorf("ttl %s must not be negative", ttlFlag.Value.String())
+		}
+
+		options.TTL = ttl
+	}
+
+	priorityFlag := command.Flags().Lookup("priority")
+	if priorityFlag != nil {
+		priority, err := turnin.ParseTurnInPriority(priorityFlag.Value.String())
+		if err != nil {
+			return nil, NewInvalidArgumentError(err.Error())
+		}
+
+		options.Priority = priority
+	}
+
+	outputFlag := command.Flags().Lookup("output")
+	if outputFlag != nil {
+		output, err := ParseOutputFormat(outputFlag.Value.String())
+		if err != nil {
+			return nil, err
+		}
+
+		options.Output = output
+	}
+
+	directFlag := command.Flags().Lookup("direct")
+	if directFlag != nil {
+		options.Direct, _ = strconv.ParseBool(directFlag.Value.String())
+	}
+
+	waitFlag := command.Flags().Lookup("wait")
+	if waitFlag != nil && waitFlag.Changed {
+		waitTimeout, err := time.ParseDuration(waitFlag.Value.String())
+		if err != nil {
+			return nil, NewInvalidArgumentErrorf("failed to parse wait timeout %s - %v", waitFlag.Value.String(), err)
+		}
+
+		if waitTimeout < 0 {
+			return nil, NewInvalidArgumentErrorf("wait timeout %s must not be negative", waitFlag.Value.String())
+		}
+
+		options.Wait = true
+		options.WaitTimeout = waitTimeout
+	}
+
+	return options, nil
+}
+
 func ProcessCommonFlags(command *cobra.Command) (*commons.ClientConfig, bool, error) {
 	logger := log.WithFields(log.Fields{
 		"package":  "commons",
@@ -63,13 +165,13 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.ClientConfig, bool, er
 			yamlBytes, err := os.ReadFile(configPath)
 			if err != nil {
 				logger.Error(err)
-				return nil, false, err // stop here
+				return nil, false, NewConfigErrorf("failed to read config %s - %v", configPath, err) // stop here
 			}
 
 			clientConfig, err := commons.NewClientConfigFromYAML(yamlBytes)
 			if err != nil {
 				logger.Error(err)
-				return nil, false, err // stop here
+				return nil, false, NewConfigErrorf("failed to read config %s - %v", configPath, err) // stop here
 			}
 
 			// overwrite config
@@ -88,6 +190,10 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.ClientConfig, bool, er
 		log.SetLevel(log.DebugLevel)
 	}
 
+	// invalid format is reported on validation
+	logFormat, _ := commons.GetLogFormat(config.LogFormat)
+	log.SetFormatter(commons.NewLogFormatter(logFormat, LogTimestampFormat))
+
 	var logWriter io.WriteCloser
 	logFilePath := config.GetLogFilePath()
 	if logFilePath != "-" || len(logFilePath) >= 0 {
@@ -103,7 +209,7 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.ClientConfig, bool, er
 	err := config.Validate()
 	if err != nil {
 		logger.Error(err)
-		return nil, false, err // stop here
+		return nil, false, NewConfigErrorf("invalid config - %v", err) // stop here
 	}
 
 	return config, true, nil // contiue
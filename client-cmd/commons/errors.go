@@ -0,0 +1,121 @@
+package commons
+
+import (
+	"fmt"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+)
+
+// InvalidArgumentError is an error returned when command-line arguments are invalid
+type InvalidArgumentError struct {
+	message string
+}
+
+// NewInvalidArgumentError creates InvalidArgumentError struct
+func NewInvalidArgumentError(message string) *InvalidArgumentError {
+	return &InvalidArgumentError{
+		message: message,
+	}
+}
+
+// NewInvalidArgumentErrorf creates InvalidArgumentError struct
+func NewInvalidArgumentErrorf(format string, v ...interface{}) *InvalidArgumentError {
+	return &InvalidArgumentError{
+		message: fmt.Sprintf(format, v...),
+	}
+}
+
+func (e *InvalidArgumentError) Error() string {
+	return e.message
+}
+
+// IsInvalidArgumentError evaluates if the given error is InvalidArgumentError
+func IsInvalidArgumentError(err error) bool {
+	if _, ok := err.(*InvalidArgumentError); ok {
+		return true
+	}
+
+	return false
+}
+
+// ConfigError is an error returned when config cannot be read or is invalid
+type ConfigError struct {
+	message string
+}
+
+// NewConfigErrorf creates ConfigError struct
+func NewConfigErrorf(format string, v ...interface{}) *ConfigError {
+	return &ConfigError{
+		message: fmt.Sprintf(format, v...),
+	}
+}
+
+func (e *ConfigError) Error() string {
+	return e.message
+}
+
+// IsConfigError evaluates if the given error is ConfigError
+func IsConfigError(err error) bool {
+	if _, ok := err.(*ConfigError); ok {
+		return true
+	}
+
+	return false
+}
+
+// WaitTimeoutError is an error returned when a request is not processed in time
+type WaitTimeoutError struct {
+	message string
+}
+
+// NewWaitTimeoutErrorf creates WaitTimeoutError struct
+func NewWaitTimeoutErrorf(format string, v ...interface{}) *WaitTimeoutError {
+	return &WaitTimeoutError{
+		message: fmt.Sprintf(format, v...),
+	}
+}
+
+func (e *WaitTimeoutError) Error() string {
+	return e.message
+}
+
+// IsWaitTimeoutError evaluates if the given error is WaitTimeoutError
+func IsWaitTimeoutError(err error) bool {
+	if _, ok := err.(*WaitTimeoutError); ok {
+		return true
+	}
+
+	return false
+}
+
+// RequestFailedError is an error returned when a request waited for is not processed successfully
+type RequestFailedError struct {
+	status  turnin.ResultStatus
+	message string
+}
+
+// NewRequestFailedErrorf creates RequestFailedError struct
+func NewRequestFailedErrorf(status turnin.ResultStatus, format string, v ...interface{}) *RequestFailedError {
+	return &RequestFailedError{
+		status:  status,
+		message: fmt.Sprintf(format, v...),
+	}
+}
+
+func (e *RequestFailedError) Error() string {
+	return e.message
+}
+
+// GetStatus returns status of the request
+func (e *RequestFailedError) GetStatus() turnin.ResultStatus {
+	return e.status
+}
+
+// IsRequestFailedError evaluates if the given error is RequestFailedError
+func IsRequestFailedError(err error) bool {
+	if _, ok := err.(*RequestFailedError); ok {
+		return true
+	}
+
+	return false
+}
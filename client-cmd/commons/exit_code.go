@@ -0,0 +1,55 @@
+package commons
+
+import (
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+)
+
+const (
+	// ExitCodeSuccess is returned when a command succeeds
+	ExitCodeSuccess int = 0
+	// ExitCodeError is returned for errors not classified
+	ExitCodeError int = 1
+	// ExitCodeInvalidArgument is returned when command-line arguments are invalid
+	ExitCodeInvalidArgument int = 2
+	// ExitCodeConfigError is returned when config cannot be read or is invalid
+	ExitCodeConfigError int = 3
+	// ExitCodeQueueFull is returned when the turn in dir has too many pending turn-ins
+	ExitCodeQueueFull int = 10
+	// ExitCodeDiskFull is returned when the turn in dir does not have enough free space or inodes
+	ExitCodeDiskFull int = 11
+	// ExitCodePermissionDenied is returned when the turn in dir is not writable
+	ExitCodePermissionDenied int = 12
+	// ExitCodeWaitTimeout is returned when a request waited for is not processed in time
+	ExitCodeWaitTimeout int = 20
+	// ExitCodeRequestFailed is returned when a request waited for fails
+	ExitCodeRequestFailed int = 21
+	// ExitCodeRequestExpired is returned when a request waited for expires
+	ExitCodeRequestExpired int = 22
+)
+
+// GetExitCode returns exit code for the error
+func GetExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitCodeSuccess
+	case IsInvalidArgumentError(err):
+		return ExitCodeInvalidArgument
+	case IsConfigError(err):
+		return ExitCodeConfigError
+	case turnin.IsQueueFullError(err):
+		return ExitCodeQueueFull
+	case turnin.IsDiskFullError(err):
+		return ExitCodeDiskFull
+	case turnin.IsPermissionDeniedError(err):
+		return ExitCodePermissionDenied
+	case IsWaitTimeoutError(err):
+		return ExitCodeWaitTimeout
+	case IsRequestFailedError(err):
+		if err.(*RequestFailedError).GetStatus() == turnin.ResultStatusExpired {
+			return ExitCodeRequestExpired
+		}
+		return ExitCodeRequestFailed
+	default:
+		return ExitCodeError
+	}
+}
@@ -0,0 +1,36 @@
+package commons
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+)
+
+func TestGetExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "success", expected: ExitCodeSuccess},
+		{name: "unclassified", err: errors.New("failed"), expected: ExitCodeError},
+		{name: "invalid argument", err: NewInvalidArgumentErrorf("bad flag"), expected: ExitCodeInvalidArgument},
+		{name: "config", err: NewConfigErrorf("bad config"), expected: ExitCodeConfigError},
+		{name: "queue full", err: turnin.NewCapacityErrorf(turnin.QueueFullCapacityErrorKind, "full"), expected: ExitCodeQueueFull},
+		{name: "disk full", err: turnin.NewCapacityErrorf(turnin.DiskFullCapacityErrorKind, "full"), expected: ExitCodeDiskFull},
+		{name: "permission denied", err: turnin.NewCapacityErrorf(turnin.PermissionDeniedCapacityErrorKind, "denied"), expected: ExitCodePermissionDenied},
+		{name: "wait timeout", err: NewWaitTimeoutErrorf("not processed"), expected: ExitCodeWaitTimeout},
+		{name: "request failed", err: NewRequestFailedErrorf(turnin.ResultStatusFailed, "failed"), expected: ExitCodeRequestFailed},
+		{name: "request expired", err: NewRequestFailedErrorf(turnin.ResultStatusExpired, "expired"), expected: ExitCodeRequestExpired},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exitCode := GetExitCode(test.err)
+			if exitCode != test.expected {
+				t.Errorf("expected exit code %d, got %d", test.expected, exitCode)
+			}
+		})
+	}
+}
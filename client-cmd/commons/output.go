@@ -0,0 +1,128 @@
+package commons
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+	"github.com/spf13/cobra"
+)
+
+type OutputFormat string
+
+const (
+	OutputFormatText OutputFormat = "text"
+	OutputFormatJSON OutputFormat = "json"
+)
+
+// ParseOutputFormat parses output format string (text, json)
+func ParseOutputFormat(format string) (OutputFormat, error) {
+	switch OutputFormat(strings.ToLower(strings.TrimSpace(format))) {
+	case "", OutputFormatText:
+		return OutputFormatText, nil
+	case OutputFormatJSON:
+		return OutputFormatJSON, nil
+	default:
+		return OutputFormatText, NewInvalidArgumentErrorf("unknown output format - %s", format)
+	}
+}
+
+// GetOutputFormat returns output format given via command-line flag, text if not given or invalid
+func GetOutputFormat(command *cobra.Command) OutputFormat {
+	outputFlag := command.Flags().Lookup("output")
+	if outputFlag != nil {
+		format, err := ParseOutputFormat(outputFlag.Value.String())
+		if err == nil {
+			return format
+		}
+	}
+
+	return OutputFormatText
+}
+
+// TurnInResult is a machine-readable result of a turn-in
+type TurnInResult struct {
+	ID          string `json:"id"`
+	RequestID   string `json:"request_id"`
+	FilePath    string `json:"file_path"`
+	RequestType string `json:"request_type"`
+	Status      string `json:"status,omitempty"` // filled if waited for completion
+	Error       string `json:"error,omitempty"`
+}
+
+// ErrorResult is a machine-readable result of a failure
+type ErrorResult struct {
+	Error    string `json:"error"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// FinishTurnIn waits for the turn-in processed if requested, and prints the result
+// returns error if the turn-in is not processed successfully
+func FinishTurnIn(ti *turnin.TurnIn, options *TurnInOptions, item turnin.TurnInItem) error {
+	result := TurnInResult{
+		ID:          turnin.GetItemID(item),
+		RequestID:   item.GetRequestID(),
+		FilePath:    item.GetItemFilePath(),
+		RequestType: string(item.GetRequestType()),
+	}
+
+	if !options.Wait {
+		return printTurnInResult(options.Output, &result)
+	}
+
+	record, err := ti.WaitResult(result.ID, options.WaitTimeout, WaitPollingInterval)
+	if err != nil {
+		return err
+	}
+
+	if record == nil {
+		return NewWaitTimeoutErrorf("request %s is not processed in %s", result.ID, options.WaitTimeout.String())
+	}
+
+	ti.RemoveResult(result.ID)
+
+	result.Status = string(record.Status)
+	result.Error = record.Error
+
+	if record.Status != turnin.ResultStatusSuccess {
+		// error is printed with exit code
+		return NewRequestFailedErrorf(record.Status, "request %s is %s - %s", result.ID, record.Status, record.Error)
+	}
+
+	return printTurnInResult(options.Output, &result)
+}
+
+func printTurnInResult(format OutputFormat, result *TurnInResult) error {
+	if format != OutputFormatJSON {
+		return nil
+	}
+
+	return PrintJSON(result)
+}
+
+// PrintError prints the error to stderr, and to stdout in JSON if output format is JSON
+func PrintError(format OutputFormat, err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+
+	if format == OutputFormatJSON {
+		result := ErrorResult{
+			Error:    err.Error(),
+			ExitCode: GetExitCode(err),
+		}
+
+		PrintJSON(result)
+	}
+}
+
+// PrintJSON prints the value in JSON to stdout
+func PrintJSON(v interface{}) error {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(bytes))
+	return nil
+}
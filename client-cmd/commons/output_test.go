@@ -0,0 +1,73 @@
+package commons
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+)
+
+func TestFinishTurnInWait(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         turnin.ResultStatus // the result is not written if empty
+		expectExitCode int
+	}{
+		{name: "success", status: turnin.ResultStatusSuccess, expectExitCode: ExitCodeSuccess},
+		{name: "failed", status: turnin.ResultStatusFailed, expectExitCode: ExitCodeRequestFailed},
+		{name: "expired", status: turnin.ResultStatusExpired, expectExitCode: ExitCodeRequestExpired},
+		{name: "timeout", expectExitCode: ExitCodeWaitTimeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ti := turnin.NewTurnIn(t.TempDir())
+			err := ti.MakeTurnInDir()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			item := turnin.NewSendMessageRequest("irods.data-object.add", "{}")
+			item.SetResultRequested(true)
+			err = ti.Turnin(item)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// processed by the service
+			if len(test.status) > 0 {
+				var processErr error
+				if test.status != turnin.ResultStatusSuccess {
+					processErr = errors.New("not processed")
+				}
+
+				err = ti.WriteResult(turnin.NewResultRecord(item, test.status, processErr, ""))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			options := &TurnInOptions{
+				Output:      OutputFormatText,
+				Wait:        true,
+				WaitTimeout: 100 * time.Millisecond,
+			}
+
+			err = FinishTurnIn(ti, options, item)
+			if exitCode := GetExitCode(err); exitCode != test.expectExitCode {
+				t.Fatalf("expected exit code %d, got %d - %v", test.expectExitCode, exitCode, err)
+			}
+
+			// the result is taken by the client
+			record, err := ti.ReadResult(turnin.GetItemID(item))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if record != nil {
+				t.Errorf("expected the result removed, got %+v", record)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package commons
+
+import (
+	"context"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/control"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTurnIn creates TurnIn for the client config, with capacity limits
+func NewTurnIn(config *commons.ClientConfig) *turnin.TurnIn {
+	ti := turnin.NewTurnIn(config.TurnInDirPath)
+	ti.Limits = turnin.CapacityLimits{
+		MinFreeBytes:  config.MinFreeBytes,
+		MinFreeInodes: config.MinFreeInodes,
+		MaxBacklog:    config.MaxBacklog,
+	}
+	return ti
+}
+
+// isDirectEnqueue returns true if requests are submitted over the control socket
+func isDirectEnqueue(config *commons.ClientConfig, options *TurnInOptions) bool {
+	return config.DirectEnqueue || options.Direct
+}
+
+// Turnin turns a request in, over the control socket if direct enqueue is enabled
+// falls back to the turn-in dir if the service is unavailable
+func Turnin(config *commons.ClientConfig, options *TurnInOptions, item turnin.TurnInItem) error {
+	_, err := TurninBatch(config, options, []turnin.TurnInItem{item})
+	return err
+}
+
+// TurninBatch turns requests in, over the control socket if direct enqueue is enabled
+// falls back to the turn-in dir if the service is unavailable
+// stops at the first error, returns the number of requests turned in
+func TurninBatch(config *commons.ClientConfig, options *TurnInOptions, items []turnin.TurnInItem) (int, error) {
+	return turninBatchTraced(config, options, items, false)
+}
+
+// TurninBatchAllOrNothing turns requests in only if all of them can be turned in
+// requests are staged in the turn-in dir and moved in at once, direct enqueue is not used
+// returns the number of requests turned in
+func TurninBatchAllOrNothing(config *commons.ClientConfig, options *TurnInOptions, items []turnin.TurnInItem) (int, error) {
+	return turninBatchTraced(config, options, items, true)
+}
+
+func turninBatchTraced(config *commons.ClientConfig, options *TurnInOptions, items []turnin.TurnInItem, allOrNothing bool) (int, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "commons",
+		"function": "turninBatchTraced",
+	})
+
+	tracing, err := commons.NewTracing(&config.TracingConfig, commons.TracingServiceNameClient)
+	if err != nil {
+		// requests are turned in without tracing
+		logger.WithError(err).Warn("failed to initialize tracing")
+	}
+	defer tracing.Release()
+
+	ctx, span := tracing.GetTracer(commons.TracerName).Start(context.Background(), "Turnin", trace.WithAttributes(attribute.Int("turnin.count", len(items))))
+	defer span.End()
+
+	if len(items) == 1 {
+		span.SetAttributes(commons.TracingRequestTypeKey.String(string(items[0].GetRequestType())))
+	}
+
+	// request IDs are generated here to log the same ID on both sides
+	// the service continues the trace with the trace context stored
+	for _, item := range items {
+		requestID := turnin.EnsureRequestID(item)
+		turnin.InjectTraceContext(ctx, item)
+
+		logger.WithField("request_id", requestID).Debugf("turning in a %s request", item.GetRequestType())
+	}
+
+	var enqueued int
+	if allOrNothing {
+		ti := NewTurnIn(config)
+		enqueued, err = ti.TurninBatchAllOrNothing(items)
+	} else {
+		enqueued, err = turninBatch(config, options, items)
+	}
+	commons.SetSpanError(span, err)
+	return enqueued, err
+}
+
+func turninBatch(config *commons.ClientConfig, options *TurnInOptions, items []turnin.TurnInItem) (int, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "commons",
+		"function": "turninBatch",
+	})
+
+	enqueued := 0
+	if isDirectEnqueue(config, options) {
+		client := control.NewClient(config.ControlSocketPath, control.TimeoutDefault)
+
+		for _, item := range items {
+			err := enqueueDirect(client, item)
+			if err != nil {
+				if !control.IsUnavailableError(err) {
+					return enqueued, err
+				}
+
+				logger.WithError(err).Warnf("service is unavailable, falling back to turn-in dir %s", config.TurnInDirPath)
+				break
+			}
+
+			enqueued++
+		}
+
+		if enqueued == len(items) {
+			return enqueued, nil
+		}
+	}
+
+	ti := NewTurnIn(config)
+	turnedIn, err := ti.TurninBatch(items[enqueued:])
+	return enqueued + turnedIn, err
+}
+
+// enqueueDirect submits a request over the control socket
+func enqueueDirect(client *control.Client, item turnin.TurnInItem) error {
+	itemBytes, err := item.MarshalJson()
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Call(&control.Request{
+		Command: control.CommandEnqueue,
+		Item:    itemBytes,
+	})
+	if err != nil {
+		return convertServiceError(err)
+	}
+
+	item.SetItemFilePath(response.FilePath)
+	return nil
+}
+
+// convertServiceError converts errors returned by the service to errors of the client, to exit with the same codes
+func convertServiceError(err error) error {
+	serviceErr, ok := err.(*control.ServiceError)
+	if !ok {
+		return err
+	}
+
+	switch serviceErr.GetErrorClass() {
+	case string(turnin.QueueFullCapacityErrorKind), string(turnin.DiskFullCapacityErrorKind), string(turnin.PermissionDeniedCapacityErrorKind):
+		return turnin.NewCapacityErrorf(turnin.CapacityErrorKind(serviceErr.GetErrorClass()), "%s", serviceErr.Error())
+	case string(turnin.ErrorClassDecode), string(turnin.ErrorClassValidation):
+		return NewInvalidArgumentError(serviceErr.Error())
+	default:
+		return err
+	}
+}
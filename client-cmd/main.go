@@ -5,6 +5,7 @@ import (
 
 	cmd_commons "github.com/cyverse/irods-rule-async-exec-cmd/client-cmd/commons"
 	"github.com/cyverse/irods-rule-async-exec-cmd/client-cmd/subcmd"
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -15,10 +16,13 @@ var rootCmd = &cobra.Command{
 	Short: "Queue a command to be exectued asynchronously",
 	Long:  "Queue a command to be exectued asynchronously. The command can be either 'Send Message' or 'BisQue Data Control Request'. Messages are routed to AMQP service configured, and BisQue Data Control Requests are routed to BisQue server configured.",
 	RunE:  processCommand,
+	// errors are reported with exit codes in main
+	SilenceErrors: true,
+	SilenceUsage:  true,
 }
 
-func Execute() error {
-	return rootCmd.Execute()
+func Execute() (*cobra.Command, error) {
+	return rootCmd.ExecuteC()
 }
 
 func processCommand(command *cobra.Command, args []string) error {
@@ -30,10 +34,11 @@ func processCommand(command *cobra.Command, args []string) error {
 	_, cont, err := cmd_commons.ProcessCommonFlags(command)
 	if err != nil {
 		logger.Error(err)
+		return err
 	}
 
 	if !cont {
-		return err
+		return nil
 	}
 
 	// if nothing is given
@@ -43,10 +48,7 @@ func processCommand(command *cobra.Command, args []string) error {
 }
 
 func main() {
-	log.SetFormatter(&log.TextFormatter{
-		TimestampFormat: "2006-01-02 15:04:05.000",
-		FullTimestamp:   true,
-	})
+	log.SetFormatter(commons.NewLogFormatter(commons.LogFormatText, cmd_commons.LogTimestampFormat))
 
 	log.SetLevel(log.InfoLevel)
 
@@ -58,15 +60,28 @@ func main() {
 	// attach common flags
 	cmd_commons.SetCommonFlags(rootCmd)
 
+	// flag errors of root and sub commands are invalid arguments
+	rootCmd.SetFlagErrorFunc(func(command *cobra.Command, err error) error {
+		return cmd_commons.NewInvalidArgumentError(err.Error())
+	})
+
 	// add sub commands
 	subcmd.AddSendMsgCommand(rootCmd)
 	subcmd.AddLinkBisqueCommand(rootCmd)
 	subcmd.AddRemoveBisqueCommand(rootCmd)
 	subcmd.AddMoveBisqueCommand(rootCmd)
+	subcmd.AddIrodsMetadataCommand(rootCmd)
+	subcmd.AddBatchCommand(rootCmd)
+	subcmd.AddCtlCommand(rootCmd)
 
-	err := Execute()
+	command, err := Execute()
 	if err != nil {
-		logger.Fatal(err)
-		os.Exit(1)
+		logger.Error(err)
+		if command == nil {
+			command = rootCmd
+		}
+
+		cmd_commons.PrintError(cmd_commons.GetOutputFormat(command), err)
+		os.Exit(cmd_commons.GetExitCode(err))
 	}
 }
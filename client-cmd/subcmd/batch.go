@@ -0,0 +1,260 @@
+package subcmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cmd_commons "github.com/cyverse/irods-rule-async-exec-cmd/client-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// batchLineSizeMax is the max size of a line in batch input
+	batchLineSizeMax int = 1024 * 1024 // 1MB
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Queue requests in batch",
+	Long: `This buffers requests given in newline-delimited JSON, read from STDIN or a file.
+	Each line is a request of any supported type, e.g., {"type": "link_bisque", "irods_username": "...", "irods_path": "..."}.
+	The requests are stored in the turn-in dir temporarily, then processed by the service.`,
+	RunE: processBatchCommand,
+}
+
+// batchLineResult is a result of a line in batch input
+type batchLineResult struct {
+	Line        int    `json:"line"`
+	ID          string `json:"id,omitempty"`
+	RequestID   string `json:"request_id,omitempty"`
+	FilePath    string `json:"file_path,omitempty"`
+	RequestType string `json:"request_type,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+func AddBatchCommand(rootCmd *cobra.Command) {
+	// attach common flags
+	cmd_commons.SetCommonFlags(batchCmd)
+	cmd_commons.SetTurnInFlags(batchCmd)
+
+	batchCmd.Flags().StringP("input", "i", "-", "Read requests from the file, '-' for STDIN")
+	batchCmd.Flags().Bool("all_or_nothing", false, "Queue no requests if any line is invalid or fails to be queued")
+
+	rootCmd.AddCommand(batchCmd)
+}
+
+func processBatchCommand(command *cobra.Command, args []string) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "subcmd",
+		"function": "processBatchCommand",
+	})
+
+	config, cont, err := cmd_commons.ProcessCommonFlags(command)
+	if err != nil {
+		return err
+	}
+
+	if !cont {
+		return nil
+	}
+
+	options, err := cmd_commons.ProcessTurnInFlags(command)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	inputPath := "-"
+	inputFlag := command.Flags().Lookup("input")
+	if inputFlag != nil {
+		inputPath = inputFlag.Value.String()
+	}
+
+	allOrNothing := false
+	allOrNothingFlag := command.Flags().Lookup("all_or_nothing")
+	if allOrNothingFlag != nil {
+		allOrNothing, _ = strconv.ParseBool(allOrNothingFlag.Value.String())
+	}
+
+	logger.Infof("[batch] input %s, all or nothing %t", inputPath, allOrNothing)
+
+	var input io.Reader
+	if inputPath == "-" || len(inputPath) == 0 {
+		input = os.Stdin
+	} else {
+		inputFile, err := os.Open(inputPath)
+		if err != nil {
+			err = cmd_commons.NewInvalidArgumentErrorf("failed to open input %s - %v", inputPath, err)
+			logger.Error(err)
+			return err
+		}
+		defer inputFile.Close()
+
+		input = inputFile
+	}
+
+	return turninBatchRequests(config, options, command, input, allOrNothing)
+}
+
+func turninBatchRequests(config *commons.ClientConfig, options *cmd_commons.TurnInOptions, command *cobra.Command, input io.Reader, allOrNothing bool) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "subcmd",
+		"function": "turninBatchRequests",
+	})
+
+	// read and validate all lines first
+	lines := []int{}
+	items := []turnin.TurnInItem{}
+	results := []batchLineResult{}
+	invalidLines := 0
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), batchLineSizeMax)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+
+		item, err := newBatchRequest([]byte(line), options, command)
+		if err != nil {
+			invalidLines++
+			results = append(results, batchLineResult{
+				Line:  lineNum,
+				Error: err.Error(),
+			})
+			continue
+		}
+
+		lines = append(lines, lineNum)
+		items = append(items, item)
+	}
+
+	if err := scanner.Err(); err != nil {
+		err = cmd_commons.NewInvalidArgumentErrorf("failed to read input at line %d - %v", lineNum+1, err)
+		logger.Error(err)
+		return err
+	}
+
+	logger.Debugf("read %d requests, %d invalid lines", len(items), invalidLines)
+
+	if allOrNothing && invalidLines > 0 {
+		printBatchResults(options.Output, results)
+
+		err := cmd_commons.NewInvalidArgumentErrorf("%d of %d requests are invalid, queued nothing", invalidLines, invalidLines+len(items))
+		logger.Error(err)
+		return err
+	}
+
+	var turnedIn int
+	var turninErr error
+	if allOrNothing {
+		turnedIn, turninErr = cmd_commons.TurninBatchAllOrNothing(config, options, items)
+	} else {
+		turnedIn, turninErr = cmd_commons.TurninBatch(config, options, items)
+	}
+
+	if turninErr != nil {
+		logger.WithError(turninErr).Errorf("failed to turn-in requests, turned-in %d of %d", turnedIn, len(items))
+	}
+
+	for idx, item := range items {
+		result := batchLineResult{
+			Line:        lines[idx],
+			RequestType: string(item.GetRequestType()),
+		}
+
+		if idx < turnedIn {
+			result.ID = turnin.GetItemID(item)
+			result.RequestID = item.GetRequestID()
+			result.FilePath = item.GetItemFilePath()
+		} else if idx == turnedIn && turninErr != nil {
+			result.Error = turninErr.Error()
+		} else {
+			result.Error = "not queued"
+		}
+
+		results = append(results, result)
+	}
+
+	printBatchResults(options.Output, results)
+
+	if turninErr != nil {
+		return turninErr
+	}
+
+	if invalidLines > 0 {
+		err := cmd_commons.NewInvalidArgumentErrorf("%d of %d requests are invalid, queued %d", invalidLines, invalidLines+len(items), turnedIn)
+		logger.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// newBatchRequest creates a request from a line, flags are applied to fields not given in the line
+func newBatchRequest(line []byte, options *cmd_commons.TurnInOptions, command *cobra.Command) (turnin.TurnInItem, error) {
+	item, err := turnin.NewTurnInRequest(line)
+	if err != nil {
+		return nil, err
+	}
+
+	content := map[string]json.RawMessage{}
+	err = json.Unmarshal(line, &content)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.GetCreationTime().IsZero() {
+		item.SetCreationTime(time.Now().Local())
+	}
+
+	if _, ok := content["expiry_time"]; !ok && options.TTL > 0 {
+		item.SetExpiryTime(item.GetCreationTime().Add(options.TTL))
+	}
+
+	if _, ok := content["priority"]; !ok && command.Flags().Changed("priority") {
+		item.SetPriority(options.Priority)
+	}
+
+	err = item.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func printBatchResults(format cmd_commons.OutputFormat, results []batchLineResult) {
+	sort.SliceStable(results, func(i int, j int) bool {
+		return results[i].Line < results[j].Line
+	})
+
+	for _, result := range results {
+		if format == cmd_commons.OutputFormatJSON {
+			bytes, err := json.Marshal(result)
+			if err == nil {
+				fmt.Println(string(bytes))
+			}
+			continue
+		}
+
+		if len(result.Error) > 0 {
+			fmt.Fprintf(os.Stderr, "line %d: %s\n", result.Line, result.Error)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package subcmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	cmd_commons "github.com/cyverse/irods-rule-async-exec-cmd/client-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/control"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	ctlErrorsLimitDefault int = 20
+)
+
+var ctlCmd = &cobra.Command{
+	Use:   "ctl [command] [target]",
+	Short: "Control the running service",
+	Long: `This sends a command to the running service over its control socket.
+	Commands are:
+	  status                          show status of the service
+	  pause [message|bisque|irods|all]
+	                                  pause processing requests in the lane
+	  resume [message|bisque|irods|all]
+	                                  resume processing requests in the lane
+	  scrape                          scrape requests immediately
+	  drain                           process all requests queued, then stop the service
+	  reconnect [amqp[:name]|amqp_consumer|kafka|nats|nats_consumer|irods|all]
+	                                  reconnect to AMQP destinations or iRODS, all if not given
+	  errors                          show recent errors`,
+	RunE: processCtlCommand,
+}
+
+func AddCtlCommand(rootCmd *cobra.Command) {
+	// attach common flags
+	cmd_commons.SetCommonFlags(ctlCmd)
+
+	ctlCmd.Flags().String("socket", "", "Set control socket path of the service, overrides config")
+	ctlCmd.Flags().Duration("timeout", control.TimeoutDefault, "Set timeout of the command")
+	ctlCmd.Flags().Int("limit", ctlErrorsLimitDefault, "Set the max number of recent errors to show, 0 for all")
+	ctlCmd.Flags().StringP("output", "o", string(cmd_commons.OutputFormatText), "Set output format (text, json)")
+
+	rootCmd.AddCommand(ctlCmd)
+}
+
+func processCtlCommand(command *cobra.Command, args []string) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "subcmd",
+		"function": "processCtlCommand",
+	})
+
+	config, cont, err := cmd_commons.ProcessCommonFlags(command)
+	if err != nil {
+		return err
+	}
+
+	if !cont {
+		return nil
+	}
+
+	output, err := cmd_commons.ParseOutputFormat(command.Flags().Lookup("output").Value.String())
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	socketPath := config.ControlSocketPath
+	socketFlag := command.Flags().Lookup("socket")
+	if socketFlag != nil && len(socketFlag.Value.String()) > 0 {
+		socketPath = socketFlag.Value.String()
+	}
+
+	timeout, err := time.ParseDuration(command.Flags().Lookup("timeout").Value.String())
+	if err != nil {
+		return cmd_commons.NewInvalidArgumentErrorf("failed to parse timeout - %v", err)
+	}
+
+	limit, err := strconv.Atoi(command.Flags().Lookup("limit").Value.String())
+	if err != nil || limit < 0 {
+		return cmd_commons.NewInvalidArgumentErrorf("invalid limit %s", command.Flags().Lookup("limit").Value.String())
+	}
+
+	logger.Infof("[ctl] %s", strings.Join(args, " "))
+
+	request, err := newCtlRequest(args, limit)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	client := control.NewClient(socketPath, timeout)
+	response, err := client.Call(request)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	printCtlResponse(output, response)
+	return nil
+}
+
+// newCtlRequest creates a control request from arguments
+func newCtlRequest(args []string, limit int) (*control.Request, error) {
+	if len(args) == 0 {
+		return nil, cmd_commons.NewInvalidArgumentError("not enough input arguments")
+	}
+
+	request := &control.Request{
+		Command: control.Command(strings.ToLower(args[0])),
+	}
+
+	switch request.Command {
+	case control.CommandPause, control.CommandResume:
+		// requires a lane
+		if len(args) < 2 {
+			return nil, cmd_commons.NewInvalidArgumentErrorf("%s requires a lane (%s, %s, %s, %s)", request.Command, control.LaneSendMessage, control.LaneBisque, control.LaneIRODS, control.LaneAll)
+		}
+		request.Target = args[1]
+	case control.CommandReconnect:
+		request.Target = control.ComponentAll
+		if len(args) >= 2 {
+			request.Target = args[1]
+		}
+	case control.CommandErrors:
+		request.Limit = limit
+	case control.CommandStatus, control.CommandScrape, control.CommandDrain:
+		// no arguments
+	default:
+		return nil, cmd_commons.NewInvalidArgumentErrorf("unknown command %s", args[0])
+	}
+
+	return request, nil
+}
+
+func printCtlResponse(format cmd_commons.OutputFormat, response *control.Response) {
+	if format == cmd_commons.OutputFormatJSON {
+		cmd_commons.PrintJSON(response)
+		return
+	}
+
+	if response.Status != nil {
+		printCtlStatus(response.Status)
+	}
+
+	for _, record := range response.Errors {
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", record.Time.Format(time.RFC3339), record.RequestType, record.ID, record.ErrorClass, record.Error)
+	}
+
+	if len(response.Message) > 0 {
+		fmt.Println(response.Message)
+	}
+}
+
+func printCtlStatus(status *control.Status) {
+	fmt.Printf("service version: %s\n", status.ServiceVersion)
+	fmt.Printf("started at: %s\n", status.StartTime.Format(time.RFC3339))
+	fmt.Printf("draining: %t\n", status.Draining)
+
+	fmt.Println("lanes:")
+	for _, lane := range status.Lanes {
+		state := "running"
+		if lane.Paused {
+			state = "paused"
+		}
+		fmt.Printf("  %s: %s\n", lane.Name, state)
+	}
+
+	fmt.Println("components:")
+	for _, component := range status.Components {
+		state := "not configured"
+		if component.Configured {
+			state = "disconnected"
+			if component.Connected {
+				state = "connected"
+			}
+		}
+		if !component.LastActivityTime.IsZero() {
+			state = fmt.Sprintf("%s, last active at %s", state, component.LastActivityTime.Format(time.RFC3339))
+		}
+		if len(component.LastError) > 0 {
+			state = fmt.Sprintf("%s, last error: %s", state, component.LastError)
+		}
+		fmt.Printf("  %s: %s\n", component.Name, state)
+	}
+
+	fmt.Println("backlog:")
+	for _, backlog := range status.Backlog {
+		if backlog.Count > 0 {
+			fmt.Printf("  %s: %d, oldest at %s\n", backlog.Priority, backlog.Count, backlog.OldestCreationTime.Format(time.RFC3339))
+		} else {
+			fmt.Printf("  %s: 0\n", backlog.Priority)
+		}
+	}
+}
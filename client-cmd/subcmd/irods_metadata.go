@@ -0,0 +1,175 @@
+package subcmd
+
+import (
+	"strings"
+
+	cmd_commons "github.com/cyverse/irods-rule-async-exec-cmd/client-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var irodsMetadataCmd = &cobra.Command{
+	Use:   "irods_metadata [add|set|rm|rmw] [iRODS path] [attribute] [value] [unit]",
+	Short: "Add, set or remove metadata of an iRODS data object or collection",
+	Long: `This buffers a request to modify metadata (AVUs) of an iRODS data object or collection.
+	The request is stored in the turn-in dir temporarily, then processed by the service with the admin account.
+	Operations are:
+	  add   add an AVU
+	  set   replace AVUs having the attribute with the AVU
+	  rm    remove an AVU
+	  rmw   remove AVUs matching patterns, % and _ are wildcards, any unit if not given
+	More AVUs can be given with --avu, e.g., --avu attribute=value --avu attribute=value=unit.`,
+	RunE: processIrodsMetadataCommand,
+}
+
+func AddIrodsMetadataCommand(rootCmd *cobra.Command) {
+	// attach common flags
+	cmd_commons.SetCommonFlags(irodsMetadataCmd)
+	cmd_commons.SetTurnInFlags(irodsMetadataCmd)
+	cmd_commons.SetWaitFlags(irodsMetadataCmd)
+
+	irodsMetadataCmd.Flags().BoolP("recursive", "r", false, "Apply to all data objects and collections under the collection too")
+	irodsMetadataCmd.Flags().StringArray("avu", []string{}, "Add an AVU to apply (attribute=value or attribute=value=unit)")
+
+	rootCmd.AddCommand(irodsMetadataCmd)
+}
+
+func processIrodsMetadataCommand(command *cobra.Command, args []string) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "subcmd",
+		"function": "processIrodsMetadataCommand",
+	})
+
+	config, cont, err := cmd_commons.ProcessCommonFlags(command)
+	if err != nil {
+		return err
+	}
+
+	if !cont {
+		return nil
+	}
+
+	options, err := cmd_commons.ProcessTurnInFlags(command)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("[irods_metadata] %s", strings.Join(args, " "))
+
+	// irods_metadata requires
+	// 1. operation
+	// 2. iRODS path
+	// 3. attribute and value, with an optional unit, optional if AVUs are given with --avu
+	if len(args) < 2 {
+		err = cmd_commons.NewInvalidArgumentError("not enough input arguments")
+		logger.Error(err)
+		return err
+	}
+
+	operation, err := turnin.ParseIRODSMetadataOperation(args[0])
+	if err != nil {
+		err = cmd_commons.NewInvalidArgumentErrorf("%v", err)
+		logger.Error(err)
+		return err
+	}
+
+	irodsPath := args[1]
+
+	avus := []turnin.IRODSAVU{}
+	switch len(args) {
+	case 2:
+		// AVUs are given with flags
+	case 3:
+		err = cmd_commons.NewInvalidArgumentErrorf("value of an attribute %s is not given", args[2])
+		logger.Error(err)
+		return err
+	case 4, 5:
+		avu := turnin.IRODSAVU{
+			Attribute: args[2],
+			Value:     args[3],
+		}
+
+		if len(args) == 5 {
+			avu.Unit = args[4]
+		}
+
+		avus = append(avus, avu)
+	default:
+		err = cmd_commons.NewInvalidArgumentError("too many input arguments, give more AVUs with --avu")
+		logger.Error(err)
+		return err
+	}
+
+	avuFlags, _ := command.Flags().GetStringArray("avu")
+	for _, avuFlag := range avuFlags {
+		avu, err := parseIrodsAVU(avuFlag)
+		if err != nil {
+			logger.Error(err)
+			return err
+		}
+
+		avus = append(avus, avu)
+	}
+
+	recursive, _ := command.Flags().GetBool("recursive")
+
+	request := turnin.NewIRODSMetadataRequest(operation, irodsPath, avus)
+	request.Recursive = recursive
+
+	err = request.Validate()
+	if err != nil {
+		err = cmd_commons.NewInvalidArgumentErrorf("invalid irods_metadata request - %v", err)
+		logger.Error(err)
+		return err
+	}
+
+	err = turninIrodsMetadataRequestOne(config, options, request)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	ti := cmd_commons.NewTurnIn(config)
+	return cmd_commons.FinishTurnIn(ti, options, request)
+}
+
+// parseIrodsAVU parses attribute=value or attribute=value=unit
+func parseIrodsAVU(avuString string) (turnin.IRODSAVU, error) {
+	parts := strings.SplitN(avuString, "=", 3)
+	if len(parts) < 2 || len(parts[0]) == 0 {
+		return turnin.IRODSAVU{}, cmd_commons.NewInvalidArgumentErrorf("malformed avu %s, must be attribute=value or attribute=value=unit", avuString)
+	}
+
+	avu := turnin.IRODSAVU{
+		Attribute: parts[0],
+		Value:     parts[1],
+	}
+
+	if len(parts) == 3 {
+		avu.Unit = parts[2]
+	}
+
+	return avu, nil
+}
+
+func turninIrodsMetadataRequestOne(config *commons.ClientConfig, options *cmd_commons.TurnInOptions, request *turnin.IRODSMetadataRequest) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "subcmd",
+		"function": "turninIrodsMetadataRequestOne",
+	})
+
+	logger.Debugf("turn-in an irods metadata request %s, %s", request.Operation, request.IRODSPath)
+
+	options.Apply(request)
+
+	err := cmd_commons.Turnin(config, options, request)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	return nil
+}
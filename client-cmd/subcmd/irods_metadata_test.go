@@ -0,0 +1,44 @@
+package subcmd
+
+import (
+	"testing"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+)
+
+func TestParseIrodsAVU(t *testing.T) {
+	tests := []struct {
+		name      string
+		avu       string
+		expected  turnin.IRODSAVU
+		expectErr bool
+	}{
+		{name: "attribute and value", avu: "attr=value", expected: turnin.IRODSAVU{Attribute: "attr", Value: "value"}},
+		{name: "with unit", avu: "attr=value=unit", expected: turnin.IRODSAVU{Attribute: "attr", Value: "value", Unit: "unit"}},
+		{name: "equal sign in unit", avu: "attr=value=a=b", expected: turnin.IRODSAVU{Attribute: "attr", Value: "value", Unit: "a=b"}},
+		{name: "wildcards", avu: "ipc_%=%", expected: turnin.IRODSAVU{Attribute: "ipc_%", Value: "%"}},
+		{name: "attribute only", avu: "attr", expectErr: true},
+		{name: "missing attribute", avu: "=value", expectErr: true},
+		{name: "empty", avu: "", expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			avu, err := parseIrodsAVU(test.avu)
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", avu)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+
+			if avu != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, avu)
+			}
+		})
+	}
+}
@@ -1,8 +1,6 @@
 package subcmd
 
 import (
-	"fmt"
-	"os"
 	"strings"
 
 	cmd_commons "github.com/cyverse/irods-rule-async-exec-cmd/client-cmd/commons"
@@ -23,6 +21,8 @@ var linkBisqueCmd = &cobra.Command{
 func AddLinkBisqueCommand(rootCmd *cobra.Command) {
 	// attach common flags
 	cmd_commons.SetCommonFlags(linkBisqueCmd)
+	cmd_commons.SetTurnInFlags(linkBisqueCmd)
+	cmd_commons.SetWaitFlags(linkBisqueCmd)
 
 	rootCmd.AddCommand(linkBisqueCmd)
 }
@@ -35,14 +35,19 @@ func processLinkBisqueCommand(command *cobra.Command, args []string) error {
 
 	config, cont, err := cmd_commons.ProcessCommonFlags(command)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		return nil
+		return err
 	}
 
 	if !cont {
 		return nil
 	}
 
+	options, err := cmd_commons.ProcessTurnInFlags(command)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
 	logger.Infof("[link_bisque] %s", strings.Join(args, " "))
 
 	// link_bisque requires
@@ -51,37 +56,37 @@ func processLinkBisqueCommand(command *cobra.Command, args []string) error {
 	if len(args) >= 2 {
 		irodsUsername := args[0]
 		irodsPath := args[1]
-		err = turninLinkBisqueRequestOne(config, irodsUsername, irodsPath)
+		request, err := turninLinkBisqueRequestOne(config, options, irodsUsername, irodsPath)
 		if err != nil {
 			logger.Error(err)
-			fmt.Fprintln(os.Stderr, err.Error())
-			return nil
+			return err
 		}
-	} else {
-		err := fmt.Errorf("not enough input arguments")
-		logger.Error(err)
-		fmt.Fprintln(os.Stderr, err.Error())
-		return nil
+
+		ti := cmd_commons.NewTurnIn(config)
+		return cmd_commons.FinishTurnIn(ti, options, request)
 	}
-	return nil
+
+	err = cmd_commons.NewInvalidArgumentError("not enough input arguments")
+	logger.Error(err)
+	return err
 }
 
-func turninLinkBisqueRequestOne(config *commons.ClientConfig, irodsUsername string, irodsPath string) error {
+func turninLinkBisqueRequestOne(config *commons.ClientConfig, options *cmd_commons.TurnInOptions, irodsUsername string, irodsPath string) (*turnin.LinkBisqueRequest, error) {
 	logger := log.WithFields(log.Fields{
 		"package":  "subcmd",
 		"function": "turninLinkBisqueRequestOne",
 	})
 
-	ti := turnin.NewTurnIn(config.TurnInDirPath)
-
-	logger.Debugf("turn-in a link bisque request %s", irodsUsername, irodsPath)
+	logger.Debugf("turn-in a link bisque request %s, %s", irodsUsername, irodsPath)
 
 	request := turnin.NewLinkBisqueRequest(irodsUsername, irodsPath)
-	err := ti.Turnin(request)
+	options.Apply(request)
+
+	err := cmd_commons.Turnin(config, options, request)
 	if err != nil {
 		logger.Error(err)
-		return err
+		return nil, err
 	}
 
-	return nil
+	return request, nil
 }
@@ -1,8 +1,6 @@
 package subcmd
 
 import (
-	"fmt"
-	"os"
 	"strings"
 
 	cmd_commons "github.com/cyverse/irods-rule-async-exec-cmd/client-cmd/commons"
@@ -23,6 +21,8 @@ var moveBisqueCmd = &cobra.Command{
 func AddMoveBisqueCommand(rootCmd *cobra.Command) {
 	// attach common flags
 	cmd_commons.SetCommonFlags(moveBisqueCmd)
+	cmd_commons.SetTurnInFlags(moveBisqueCmd)
+	cmd_commons.SetWaitFlags(moveBisqueCmd)
 
 	rootCmd.AddCommand(moveBisqueCmd)
 }
@@ -35,14 +35,19 @@ func processMoveBisqueCommand(command *cobra.Command, args []string) error {
 
 	config, cont, err := cmd_commons.ProcessCommonFlags(command)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		return nil
+		return err
 	}
 
 	if !cont {
 		return nil
 	}
 
+	options, err := cmd_commons.ProcessTurnInFlags(command)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
 	logger.Infof("[move_bisque] %s", strings.Join(args, " "))
 
 	// move_bisque requires
@@ -53,37 +58,37 @@ func processMoveBisqueCommand(command *cobra.Command, args []string) error {
 		irodsUsername := args[0]
 		irodsSrcPath := args[1]
 		irodsDestPath := args[2]
-		err = turninMoveBisqueRequestOne(config, irodsUsername, irodsSrcPath, irodsDestPath)
+		request, err := turninMoveBisqueRequestOne(config, options, irodsUsername, irodsSrcPath, irodsDestPath)
 		if err != nil {
 			logger.Error(err)
-			fmt.Fprintln(os.Stderr, err.Error())
-			return nil
+			return err
 		}
-	} else {
-		err := fmt.Errorf("not enough input arguments")
-		logger.Error(err)
-		fmt.Fprintln(os.Stderr, err.Error())
-		return nil
+
+		ti := cmd_commons.NewTurnIn(config)
+		return cmd_commons.FinishTurnIn(ti, options, request)
 	}
-	return nil
+
+	err = cmd_commons.NewInvalidArgumentError("not enough input arguments")
+	logger.Error(err)
+	return err
 }
 
-func turninMoveBisqueRequestOne(config *commons.ClientConfig, irodsUsername string, irodsSourcePath string, irodsDestPath string) error {
+func turninMoveBisqueRequestOne(config *commons.ClientConfig, options *cmd_commons.TurnInOptions, irodsUsername string, irodsSourcePath string, irodsDestPath string) (*turnin.MoveBisqueRequest, error) {
 	logger := log.WithFields(log.Fields{
 		"package":  "subcmd",
 		"function": "turninMoveBisqueRequestOne",
 	})
 
-	ti := turnin.NewTurnIn(config.TurnInDirPath)
-
 	logger.Debugf("turn-in a move bisque request %s, %s to %s", irodsUsername, irodsSourcePath, irodsDestPath)
 
 	request := turnin.NewMoveBisqueRequest(irodsUsername, irodsSourcePath, irodsDestPath)
-	err := ti.Turnin(request)
+	options.Apply(request)
+
+	err := cmd_commons.Turnin(config, options, request)
 	if err != nil {
 		logger.Error(err)
-		return err
+		return nil, err
 	}
 
-	return nil
+	return request, nil
 }
@@ -1,8 +1,6 @@
 package subcmd
 
 import (
-	"fmt"
-	"os"
 	"strings"
 
 	cmd_commons "github.com/cyverse/irods-rule-async-exec-cmd/client-cmd/commons"
@@ -23,6 +21,8 @@ var removeBisqueCmd = &cobra.Command{
 func AddRemoveBisqueCommand(rootCmd *cobra.Command) {
 	// attach common flags
 	cmd_commons.SetCommonFlags(removeBisqueCmd)
+	cmd_commons.SetTurnInFlags(removeBisqueCmd)
+	cmd_commons.SetWaitFlags(removeBisqueCmd)
 
 	rootCmd.AddCommand(removeBisqueCmd)
 }
@@ -35,14 +35,19 @@ func processRemoveBisqueCommand(command *cobra.Command, args []string) error {
 
 	config, cont, err := cmd_commons.ProcessCommonFlags(command)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		return nil
+		return err
 	}
 
 	if !cont {
 		return nil
 	}
 
+	options, err := cmd_commons.ProcessTurnInFlags(command)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
 	logger.Infof("[remove_bisque] %s", strings.Join(args, " "))
 
 	// remove_bisque requires
@@ -51,37 +56,37 @@ func processRemoveBisqueCommand(command *cobra.Command, args []string) error {
 	if len(args) >= 2 {
 		irodsUsername := args[0]
 		irodsPath := args[1]
-		err = turninRemoveBisqueRequestOne(config, irodsUsername, irodsPath)
+		request, err := turninRemoveBisqueRequestOne(config, options, irodsUsername, irodsPath)
 		if err != nil {
 			logger.Error(err)
-			fmt.Fprintln(os.Stderr, err.Error())
-			return nil
+			return err
 		}
-	} else {
-		err := fmt.Errorf("not enough input arguments")
-		logger.Error(err)
-		fmt.Fprintln(os.Stderr, err.Error())
-		return nil
+
+		ti := cmd_commons.NewTurnIn(config)
+		return cmd_commons.FinishTurnIn(ti, options, request)
 	}
-	return nil
+
+	err = cmd_commons.NewInvalidArgumentError("not enough input arguments")
+	logger.Error(err)
+	return err
 }
 
-func turninRemoveBisqueRequestOne(config *commons.ClientConfig, irodsUsername string, irodsPath string) error {
+func turninRemoveBisqueRequestOne(config *commons.ClientConfig, options *cmd_commons.TurnInOptions, irodsUsername string, irodsPath string) (*turnin.RemoveBisqueRequest, error) {
 	logger := log.WithFields(log.Fields{
 		"package":  "subcmd",
 		"function": "turninRemoveBisqueRequestOne",
 	})
 
-	ti := turnin.NewTurnIn(config.TurnInDirPath)
-
 	logger.Debugf("turn-in a remove bisque request %s, %s", irodsUsername, irodsPath)
 
 	request := turnin.NewRemoveBisqueRequest(irodsUsername, irodsPath)
-	err := ti.Turnin(request)
+	options.Apply(request)
+
+	err := cmd_commons.Turnin(config, options, request)
 	if err != nil {
 		logger.Error(err)
-		return err
+		return nil, err
 	}
 
-	return nil
+	return request, nil
 }
@@ -1,8 +1,9 @@
 package subcmd
 
 import (
-	"fmt"
-	"os"
+	"bytes"
+	"encoding/json"
+	"strconv"
 	"strings"
 
 	cmd_commons "github.com/cyverse/irods-rule-async-exec-cmd/client-cmd/commons"
@@ -16,13 +17,27 @@ var sendMsgCmd = &cobra.Command{
 	Use:   "send_msg [key] [body]",
 	Short: "Send a message to MessageBus",
 	Long: `This buffers a message to be sent to AMQP message server.
-	The message is stored in the turn-in dir temporarily, then processed by the service.`,
+	The message is stored in the turn-in dir temporarily, then processed by the service.
+	A JSON body can be built from fields, e.g., -f path=/iplant/home/user -f size:=1024.
+	Fields given with := are JSON values, others are strings.`,
 	RunE: processSendMsgCommand,
 }
 
 func AddSendMsgCommand(rootCmd *cobra.Command) {
 	// attach common flags
 	cmd_commons.SetCommonFlags(sendMsgCmd)
+	cmd_commons.SetTurnInFlags(sendMsgCmd)
+	cmd_commons.SetWaitFlags(sendMsgCmd)
+
+	sendMsgCmd.Flags().StringArrayP("field", "f", []string{}, "Add a field to a JSON body (key=string or key:=json), merged into the body if --json is given")
+	sendMsgCmd.Flags().Bool("json", false, "Validate the body as a JSON document")
+	sendMsgCmd.Flags().String("destination", "", "Set name of the AMQP destination configured in the service, routed by the key if not given")
+	sendMsgCmd.Flags().String("exchange", "", "Set exchange of the destination, routed by the key if not given")
+	sendMsgCmd.Flags().String("content_type", "", "Set content type of the message, application/json if a JSON body is given")
+	sendMsgCmd.Flags().StringArray("header", []string{}, "Add a header to the message (key=value)")
+	sendMsgCmd.Flags().String("correlation_id", "", "Set correlation ID of the message")
+	sendMsgCmd.Flags().String("message_id", "", "Set message ID of the message")
+	sendMsgCmd.Flags().String("expiration", "", "Set expiration of the message (e.g., 30m), the message is dropped if not consumed in time")
 
 	rootCmd.AddCommand(sendMsgCmd)
 }
@@ -35,49 +50,196 @@ func processSendMsgCommand(command *cobra.Command, args []string) error {
 
 	config, cont, err := cmd_commons.ProcessCommonFlags(command)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		return nil
+		return err
 	}
 
 	if !cont {
 		return nil
 	}
 
+	options, err := cmd_commons.ProcessTurnInFlags(command)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
 	logger.Infof("[send_msg] %s", strings.Join(args, " "))
 
-	// send_msg requires 2 arguments
+	// send_msg requires 1 or 2 arguments
 	// 1. key
-	// 2. body
+	// 2. body, optional if fields are given
+	if len(args) < 1 {
+		err = cmd_commons.NewInvalidArgumentError("not enough input arguments")
+		logger.Error(err)
+		return err
+	}
+
+	key := args[0]
+	body := ""
 	if len(args) >= 2 {
-		key := args[0]
-		body := args[1]
-		err = turninSendMessageRequestOne(config, key, body)
+		body = args[1]
+	}
+
+	fields, _ := command.Flags().GetStringArray("field")
+	if len(args) < 2 && len(fields) == 0 {
+		err = cmd_commons.NewInvalidArgumentError("not enough input arguments, body or fields must be given")
+		logger.Error(err)
+		return err
+	}
+
+	request := turnin.NewSendMessageRequest(key, body)
+	err = applySendMessageFlags(command, request, len(args) >= 2, fields)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	err = turninSendMessageRequestOne(config, options, request)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	ti := cmd_commons.NewTurnIn(config)
+	return cmd_commons.FinishTurnIn(ti, options, request)
+}
+
+// applySendMessageFlags builds the body from fields and sets the destination and message properties given
+func applySendMessageFlags(command *cobra.Command, request *turnin.SendMessageRequest, bodyGiven bool, fields []string) error {
+	isJSON := false
+	jsonFlag := command.Flags().Lookup("json")
+	if jsonFlag != nil {
+		isJSON, _ = strconv.ParseBool(jsonFlag.Value.String())
+	}
+
+	if isJSON || len(fields) > 0 {
+		body, err := buildJSONBody(request.Body, bodyGiven, fields)
 		if err != nil {
-			logger.Error(err)
-			fmt.Fprintln(os.Stderr, err.Error())
-			return nil
+			return err
 		}
-	} else {
-		err := fmt.Errorf("not enough input arguments")
-		logger.Error(err)
-		fmt.Fprintln(os.Stderr, err.Error())
-		return nil
+
+		request.Body = body
+		request.ContentType = turnin.ContentTypeJSON
+	}
+
+	contentTypeFlag := command.Flags().Lookup("content_type")
+	if contentTypeFlag != nil && len(contentTypeFlag.Value.String()) > 0 {
+		request.ContentType = contentTypeFlag.Value.String()
 	}
+
+	headers, _ := command.Flags().GetStringArray("header")
+	for _, header := range headers {
+		headerKey, headerVal, ok := strings.Cut(header, "=")
+		if !ok || len(headerKey) == 0 {
+			return cmd_commons.NewInvalidArgumentErrorf("invalid header %s, must be key=value", header)
+		}
+
+		if request.Headers == nil {
+			request.Headers = map[string]string{}
+		}
+		request.Headers[headerKey] = headerVal
+	}
+
+	destinationFlag := command.Flags().Lookup("destination")
+	if destinationFlag != nil {
+		request.Destination = destinationFlag.Value.String()
+	}
+
+	exchangeFlag := command.Flags().Lookup("exchange")
+	if exchangeFlag != nil {
+		request.Exchange = exchangeFlag.Value.String()
+	}
+
+	correlationIDFlag := command.Flags().Lookup("correlation_id")
+	if correlationIDFlag != nil {
+		request.CorrelationID = correlationIDFlag.Value.String()
+	}
+
+	messageIDFlag := command.Flags().Lookup("message_id")
+	if messageIDFlag != nil {
+		request.MessageID = messageIDFlag.Value.String()
+	}
+
+	expirationFlag := command.Flags().Lookup("expiration")
+	if expirationFlag != nil {
+		request.Expiration = expirationFlag.Value.String()
+	}
+
+	err := request.Validate()
+	if err != nil {
+		return cmd_commons.NewInvalidArgumentErrorf("invalid send_message request - %v", err)
+	}
+
 	return nil
 }
 
-func turninSendMessageRequestOne(config *commons.ClientConfig, key string, body string) error {
+// buildJSONBody returns a compact JSON body of the document with the fields merged
+// fields are key=string or key:=json, the document must be a JSON object if fields are given
+func buildJSONBody(document string, documentGiven bool, fields []string) (string, error) {
+	if documentGiven && len(fields) == 0 {
+		buffer := bytes.Buffer{}
+		err := json.Compact(&buffer, []byte(document))
+		if err != nil {
+			return "", cmd_commons.NewInvalidArgumentErrorf("body is not a valid JSON - %v", err)
+		}
+		return buffer.String(), nil
+	}
+
+	object := map[string]json.RawMessage{}
+	if documentGiven {
+		err := json.Unmarshal([]byte(document), &object)
+		if err != nil {
+			return "", cmd_commons.NewInvalidArgumentErrorf("body must be a JSON object to add fields - %v", err)
+		}
+	}
+
+	for _, field := range fields {
+		fieldKey, fieldVal, ok := strings.Cut(field, "=")
+		if !ok {
+			return "", cmd_commons.NewInvalidArgumentErrorf("invalid field %s, must be key=string or key:=json", field)
+		}
+
+		var value json.RawMessage
+		if strings.HasSuffix(fieldKey, ":") {
+			fieldKey = strings.TrimSuffix(fieldKey, ":")
+			if !json.Valid([]byte(fieldVal)) {
+				return "", cmd_commons.NewInvalidArgumentErrorf("invalid field %s, value is not a valid JSON", field)
+			}
+			value = json.RawMessage(fieldVal)
+		} else {
+			stringBytes, err := json.Marshal(fieldVal)
+			if err != nil {
+				return "", cmd_commons.NewInvalidArgumentErrorf("invalid field %s - %v", field, err)
+			}
+			value = json.RawMessage(stringBytes)
+		}
+
+		if len(fieldKey) == 0 {
+			return "", cmd_commons.NewInvalidArgumentErrorf("invalid field %s, key is empty", field)
+		}
+
+		object[fieldKey] = value
+	}
+
+	bodyBytes, err := json.Marshal(object)
+	if err != nil {
+		return "", cmd_commons.NewInvalidArgumentErrorf("failed to build a JSON body - %v", err)
+	}
+
+	return string(bodyBytes), nil
+}
+
+func turninSendMessageRequestOne(config *commons.ClientConfig, options *cmd_commons.TurnInOptions, request *turnin.SendMessageRequest) error {
 	logger := log.WithFields(log.Fields{
 		"package":  "subcmd",
 		"function": "turninSendMessageRequestOne",
 	})
 
-	ti := turnin.NewTurnIn(config.TurnInDirPath)
+	logger.Debugf("turn-in a send message request %s", request.Key)
 
-	logger.Debugf("turn-in a send message request %s", key)
+	options.Apply(request)
 
-	request := turnin.NewSendMessageRequest(key, body)
-	err := ti.Turnin(request)
+	err := cmd_commons.Turnin(config, options, request)
 	if err != nil {
 		logger.Error(err)
 		return err
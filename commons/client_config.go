@@ -8,15 +8,33 @@ import (
 )
 
 const (
-	TurnInDirPathDefault string = "/var/lib/irods_rule_async_exec_cmd/turnin"
+	TurnInDirPathDefault     string = "/var/lib/irods_rule_async_exec_cmd/turnin"
+	ControlSocketPathDefault string = "/var/lib/irods_rule_async_exec_cmd/control.sock"
+
+	MinFreeBytesDefault  uint64 = 64 * 1024 * 1024 // 64MB
+	MinFreeInodesDefault uint64 = 1024
 )
 
 // ClientConfig is a configuration struct for client
 type ClientConfig struct {
 	TurnInDirPath string `yaml:"turnin_dir_path,omitempty"`
 
+	// checked before writing a turn-in, 0 for unlimited
+	MinFreeBytes  uint64 `yaml:"min_free_bytes,omitempty"`
+	MinFreeInodes uint64 `yaml:"min_free_inodes,omitempty"`
+	MaxBacklog    int    `yaml:"max_backlog,omitempty"`
+
+	// control socket of the service
+	ControlSocketPath string `yaml:"control_socket_path,omitempty"`
+	// submit requests over the control socket, falls back to the turn-in dir if the service is unavailable
+	DirectEnqueue bool `yaml:"direct_enqueue,omitempty"`
+
 	// for Logging
-	LogPath string `yaml:"log_path,omitempty"`
+	LogPath   string `yaml:"log_path,omitempty"`
+	LogFormat string `yaml:"log_format,omitempty"` // text or json
+
+	// for Tracing
+	TracingConfig TracingConfig `yaml:"tracing_config,omitempty"`
 }
 
 // NewDefaultClientConfig returns a default client config
@@ -24,7 +42,17 @@ func NewDefaultClientConfig() *ClientConfig {
 	return &ClientConfig{
 		TurnInDirPath: TurnInDirPathDefault,
 
-		LogPath: "", // use default
+		MinFreeBytes:  MinFreeBytesDefault,
+		MinFreeInodes: MinFreeInodesDefault,
+		MaxBacklog:    0,
+
+		ControlSocketPath: ControlSocketPathDefault,
+		DirectEnqueue:     false,
+
+		LogPath:   "", // use default
+		LogFormat: string(LogFormatText),
+
+		TracingConfig: NewDefaultTracingConfig(),
 	}
 }
 
@@ -46,6 +74,20 @@ func (config *ClientConfig) Validate() error {
 		return errors.New("turn-in dir path is not given")
 	}
 
+	if config.MaxBacklog < 0 {
+		return errors.New("max backlog must not be negative")
+	}
+
+	_, err := GetLogFormat(config.LogFormat)
+	if err != nil {
+		return err
+	}
+
+	err = config.TracingConfig.Validate()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -0,0 +1,214 @@
+package commons
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// KafkaSASLMechanism is a SASL mechanism to authenticate to Kafka
+type KafkaSASLMechanism string
+
+const (
+	// KafkaSASLMechanismNone disables SASL
+	KafkaSASLMechanismNone KafkaSASLMechanism = ""
+	// KafkaSASLMechanismPlain sends username and password in plain text, use with TLS
+	KafkaSASLMechanismPlain KafkaSASLMechanism = "PLAIN"
+	// KafkaSASLMechanismSCRAMSHA256 authenticates with SCRAM-SHA-256
+	KafkaSASLMechanismSCRAMSHA256 KafkaSASLMechanism = "SCRAM-SHA-256"
+	// KafkaSASLMechanismSCRAMSHA512 authenticates with SCRAM-SHA-512
+	KafkaSASLMechanismSCRAMSHA512 KafkaSASLMechanism = "SCRAM-SHA-512"
+
+	KafkaClientIDDefault string = "irods-rule-async-exec-svc"
+	// KafkaVersionDefault is the Kafka version of brokers assumed if not given, idempotent producer requires 0.11 or later
+	KafkaVersionDefault string = "2.1.0"
+	// KafkaTimeoutDefault is the timeout of connecting to and producing to brokers
+	KafkaTimeoutDefault time.Duration = 30 * time.Second
+)
+
+// kafkaTopicNameRegexp matches valid Kafka topic names
+var kafkaTopicNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// KafkaConfig is a configuration struct for Kafka, send_message requests are produced to
+type KafkaConfig struct {
+	Brokers  []string      `yaml:"brokers"` // host:port of bootstrap brokers
+	ClientID string        `yaml:"client_id,omitempty"`
+	Version  string        `yaml:"version,omitempty"` // Kafka version of brokers, e.g., 2.8.0
+	Timeout  time.Duration `yaml:"timeout,omitempty"`
+
+	// topic of messages whose keys match no topic mapping, the key is used as the topic if not given
+	Topic string `yaml:"topic,omitempty"`
+	// topics of messages per key prefix. the longest prefix matching the key is used
+	Topics []KafkaTopicConfig `yaml:"topics,omitempty"`
+
+	SASL KafkaSASLConfig `yaml:"sasl,omitempty"`
+	TLS  KafkaTLSConfig  `yaml:"tls,omitempty"`
+}
+
+// KafkaTopicConfig is a configuration struct to map keys of send_message requests starting with the prefix to a topic
+type KafkaTopicConfig struct {
+	KeyPrefix string `yaml:"key_prefix"`
+	Topic     string `yaml:"topic"`
+}
+
+// KafkaSASLConfig is a configuration struct for SASL authentication to Kafka
+type KafkaSASLConfig struct {
+	Mechanism string `yaml:"mechanism,omitempty"` // PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, SASL is disabled if not given
+	Username  string `yaml:"username,omitempty"`
+	Password  string `yaml:"password,omitempty"`
+}
+
+// KafkaTLSConfig is a configuration struct for TLS connections to Kafka
+type KafkaTLSConfig struct {
+	Enabled            bool   `yaml:"enabled,omitempty"`
+	CACertPath         string `yaml:"ca_cert_path,omitempty"` // system CAs are used if not given
+	CertPath           string `yaml:"cert_path,omitempty"`    // client certificate, for mutual TLS
+	KeyPath            string `yaml:"key_path,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// NewDefaultKafkaConfig returns a default Kafka config, Kafka is not configured
+func NewDefaultKafkaConfig() KafkaConfig {
+	return KafkaConfig{
+		Brokers:  []string{},
+		ClientID: KafkaClientIDDefault,
+		Version:  KafkaVersionDefault,
+		Timeout:  KafkaTimeoutDefault,
+	}
+}
+
+// IsConfigured returns true if brokers are given
+func (config *KafkaConfig) IsConfigured() bool {
+	return len(config.Brokers) > 0
+}
+
+// GetClientID returns client ID, default if not given
+func (config *KafkaConfig) GetClientID() string {
+	if len(config.ClientID) == 0 {
+		return KafkaClientIDDefault
+	}
+	return config.ClientID
+}
+
+// GetVersion returns Kafka version of brokers, default if not given
+func (config *KafkaConfig) GetVersion() string {
+	if len(config.Version) == 0 {
+		return KafkaVersionDefault
+	}
+	return config.Version
+}
+
+// GetTimeout returns timeout of connecting to and producing to brokers, default if not given
+func (config *KafkaConfig) GetTimeout() time.Duration {
+	if config.Timeout <= 0 {
+		return KafkaTimeoutDefault
+	}
+	return config.Timeout
+}
+
+// GetTopic returns the topic of messages with the key
+func (config *KafkaConfig) GetTopic(key string) string {
+	var matched *KafkaTopicConfig
+	for idx := range config.Topics {
+		topic := &config.Topics[idx]
+		if !strings.HasPrefix(key, topic.KeyPrefix) {
+			continue
+		}
+
+		if matched == nil || len(topic.KeyPrefix) > len(matched.KeyPrefix) {
+			matched = topic
+		}
+	}
+
+	if matched != nil {
+		return matched.Topic
+	}
+
+	if len(config.Topic) > 0 {
+		return config.Topic
+	}
+
+	return key
+}
+
+// GetSASLMechanism returns KafkaSASLMechanism, none if empty
+func (config *KafkaSASLConfig) GetSASLMechanism() (KafkaSASLMechanism, error) {
+	switch KafkaSASLMechanism(strings.ToUpper(config.Mechanism)) {
+	case KafkaSASLMechanismNone:
+		return KafkaSASLMechanismNone, nil
+	case KafkaSASLMechanismPlain:
+		return KafkaSASLMechanismPlain, nil
+	case KafkaSASLMechanismSCRAMSHA256:
+		return KafkaSASLMechanismSCRAMSHA256, nil
+	case KafkaSASLMechanismSCRAMSHA512:
+		return KafkaSASLMechanismSCRAMSHA512, nil
+	default:
+		return KafkaSASLMechanismNone, fmt.Errorf("unknown Kafka SASL mechanism %s", config.Mechanism)
+	}
+}
+
+// IsValidKafkaTopicName returns true if the name can be used as a Kafka topic
+func IsValidKafkaTopicName(name string) bool {
+	return name != "." && name != ".." && kafkaTopicNameRegexp.MatchString(name)
+}
+
+// Validate validates field values and returns error if occurs
+func (config *KafkaConfig) Validate() error {
+	if !config.IsConfigured() {
+		return errors.New("Kafka brokers are not given")
+	}
+
+	for _, broker := range config.Brokers {
+		if len(broker) == 0 {
+			return errors.New("Kafka broker must not be empty")
+		}
+	}
+
+	version, err := sarama.ParseKafkaVersion(config.GetVersion())
+	if err != nil {
+		return fmt.Errorf("Kafka version %s is not valid - %v", config.GetVersion(), err)
+	}
+
+	if !version.IsAtLeast(sarama.V0_11_0_0) {
+		return fmt.Errorf("Kafka version %s does not support idempotent producer, 0.11.0 or later is required", config.GetVersion())
+	}
+
+	if config.Timeout < 0 {
+		return errors.New("Kafka timeout must not be negative")
+	}
+
+	if len(config.Topic) > 0 && !IsValidKafkaTopicName(config.Topic) {
+		return fmt.Errorf("Kafka topic %s is not a valid topic name", config.Topic)
+	}
+
+	keyPrefixes := map[string]bool{}
+	for _, topic := range config.Topics {
+		if keyPrefixes[topic.KeyPrefix] {
+			return fmt.Errorf("Kafka topic for key prefix '%s' is given twice", topic.KeyPrefix)
+		}
+		keyPrefixes[topic.KeyPrefix] = true
+
+		if !IsValidKafkaTopicName(topic.Topic) {
+			return fmt.Errorf("Kafka topic %s for key prefix '%s' is not a valid topic name", topic.Topic, topic.KeyPrefix)
+		}
+	}
+
+	mechanism, err := config.SASL.GetSASLMechanism()
+	if err != nil {
+		return err
+	}
+
+	if mechanism != KafkaSASLMechanismNone && len(config.SASL.Username) == 0 {
+		return fmt.Errorf("Kafka SASL username is not given for mechanism %s", mechanism)
+	}
+
+	if (len(config.TLS.CertPath) > 0) != (len(config.TLS.KeyPath) > 0) {
+		return errors.New("Kafka TLS cert path and key path must be given together")
+	}
+
+	return nil
+}
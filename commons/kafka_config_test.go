@@ -0,0 +1,47 @@
+package commons
+
+import (
+	"testing"
+)
+
+func TestKafkaConfigGetTopic(t *testing.T) {
+	topics := []KafkaTopicConfig{
+		{KeyPrefix: "irods.", Topic: "irods-events"},
+		{KeyPrefix: "irods.data-object.", Topic: "irods-data-objects"},
+		{KeyPrefix: "irods.data-object.add", Topic: "irods-data-object-adds"},
+		{KeyPrefix: "bisque.", Topic: "bisque-events"},
+	}
+
+	tests := []struct {
+		name     string
+		topic    string
+		topics   []KafkaTopicConfig
+		key      string
+		expected string
+	}{
+		{name: "key as topic", key: "irods.data-object.add", expected: "irods.data-object.add"},
+		{name: "default topic", topic: "events", key: "irods.data-object.add", expected: "events"},
+		{name: "prefix", topic: "events", topics: topics, key: "irods.collection.add", expected: "irods-events"},
+		{name: "longest prefix", topic: "events", topics: topics, key: "irods.data-object.rm", expected: "irods-data-objects"},
+		{name: "longest prefix exact", topic: "events", topics: topics, key: "irods.data-object.add", expected: "irods-data-object-adds"},
+		{name: "other prefix", topic: "events", topics: topics, key: "bisque.link", expected: "bisque-events"},
+		{name: "no prefix matched", topic: "events", topics: topics, key: "user.add", expected: "events"},
+		{name: "no prefix matched without default", topics: topics, key: "user.add", expected: "user.add"},
+		{name: "prefix is case sensitive", topics: topics, key: "IRODS.data-object.add", expected: "IRODS.data-object.add"},
+		{name: "empty prefix matches all", topics: []KafkaTopicConfig{{KeyPrefix: "", Topic: "all"}, {KeyPrefix: "irods.", Topic: "irods-events"}}, key: "user.add", expected: "all"},
+		{name: "longer prefix over empty prefix", topics: []KafkaTopicConfig{{KeyPrefix: "", Topic: "all"}, {KeyPrefix: "irods.", Topic: "irods-events"}}, key: "irods.user.add", expected: "irods-events"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := NewDefaultKafkaConfig()
+			config.Topic = test.topic
+			config.Topics = test.topics
+
+			topic := config.GetTopic(test.key)
+			if topic != test.expected {
+				t.Errorf("expected topic %s, got %s", test.expected, topic)
+			}
+		})
+	}
+}
@@ -1,11 +1,70 @@
 package commons
 
 import (
+	"context"
+	"fmt"
 	"runtime/debug"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// LogFormat is a format of log lines
+type LogFormat string
+
+const (
+	// LogFormatText is a human readable format
+	LogFormatText LogFormat = "text"
+	// LogFormatJSON is a format to be collected by log aggregators, one JSON object per line
+	LogFormatJSON LogFormat = "json"
+
+	// RequestIDHeader is a header having the request ID of a turn-in, sent to remote services
+	RequestIDHeader string = "X-Request-ID"
+)
+
+type requestIDContextKey struct{}
+
+// GetLogFormat returns LogFormat from string, text if empty
+func GetLogFormat(format string) (LogFormat, error) {
+	switch LogFormat(format) {
+	case LogFormatText, "":
+		return LogFormatText, nil
+	case LogFormatJSON:
+		return LogFormatJSON, nil
+	default:
+		return LogFormatText, fmt.Errorf("unknown log format %s", format)
+	}
+}
+
+// NewLogFormatter returns a log formatter for the format
+// timestampFormat is used for text format, JSON format always uses RFC3339 with nanoseconds
+func NewLogFormatter(format LogFormat, timestampFormat string) log.Formatter {
+	if format == LogFormatJSON {
+		return &log.JSONFormatter{
+			TimestampFormat: time.RFC3339Nano,
+		}
+	}
+
+	return &log.TextFormatter{
+		TimestampFormat: timestampFormat,
+		FullTimestamp:   true,
+	}
+}
+
+// ContextWithRequestID returns a context carrying the request ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// GetRequestIDFromContext returns the request ID carried by the context, empty if not given
+func GetRequestIDFromContext(ctx context.Context) string {
+	if requestID, ok := ctx.Value(requestIDContextKey{}).(string); ok {
+		return requestID
+	}
+
+	return ""
+}
+
 func StackTraceFromPanic(logger *log.Entry) {
 	if r := recover(); r != nil {
 		logger.Errorf("stacktrace from panic: %s", string(debug.Stack()))
@@ -3,11 +3,16 @@ package commons
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
 	"gopkg.in/yaml.v2"
 )
 
@@ -18,12 +23,180 @@ const (
 	IrodsRootPathDefault string = "/"
 
 	ReconnectInterval time.Duration = 1 * time.Minute
+
+	TurnInPriorityAgingDefault time.Duration = 10 * time.Minute
+	TurnInLeaseDurationDefault time.Duration = 1 * time.Minute
+	// TurnInLeaseDurationMin is the min lease duration, leases are renewed a few times in the duration
+	TurnInLeaseDurationMin time.Duration = 10 * time.Second
+	// TurnInScrapeLimitDefault is the max number of turn-ins taken by a scrape, others or the next scrape take the rest
+	TurnInScrapeLimitDefault int = 100
+
+	RetentionCheckIntervalDefault time.Duration = 10 * time.Minute
+	ResultRetentionMaxAgeDefault  time.Duration = 24 * time.Hour
+
+	ControlSocketModeDefault string = "0660"
+
+	// AmqpDestinationDefault is a name of the default AMQP destination, configured by amqp_config
+	AmqpDestinationDefault string = "default"
+
+	// RedactedValue replaces secrets in configs printed
+	RedactedValue string = "<redacted>"
+)
+
+// MessageOutput is a backend send_message requests are delivered to
+type MessageOutput string
+
+const (
+	// MessageOutputAMQP publishes send_message requests to AMQP, routed by amqp_routes
+	MessageOutputAMQP MessageOutput = "amqp"
+	// MessageOutputKafka produces send_message requests to Kafka, to topics mapped from keys
+	MessageOutputKafka MessageOutput = "kafka"
+	// MessageOutputNATS publishes send_message requests to NATS JetStream, to subjects mapped from keys
+	MessageOutputNATS MessageOutput = "nats"
+)
+
+// EventSource is a message bus iRODS events are consumed from
+type EventSource string
+
+const (
+	// EventSourceAMQP consumes iRODS events from the exchange of amqp_config
+	EventSourceAMQP EventSource = "amqp"
+	// EventSourceNATS consumes iRODS events from NATS JetStream subjects
+	EventSourceNATS EventSource = "nats"
 )
 
 // AmqpConfig is a configuration struct for AMQP Message bus
 type AmqpConfig struct {
 	URL      string `yaml:"url"`
 	Exchange string `yaml:"exchange"`
+
+	// defaults of messages sent, per routing key prefix. the longest prefix matching the key is used
+	MessageDefaults []AmqpMessageDefaultsConfig `yaml:"message_defaults,omitempty"`
+}
+
+// AmqpMessageDefaultsConfig is a configuration struct for defaults of messages whose routing keys start with the prefix
+// messages override the defaults, headers are merged
+type AmqpMessageDefaultsConfig struct {
+	KeyPrefix   string            `yaml:"key_prefix"` // empty to match all keys
+	ContentType string            `yaml:"content_type,omitempty"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	Expiration  time.Duration     `yaml:"expiration,omitempty"`
+}
+
+// AmqpDestinationConfig is a configuration struct for a named AMQP destination that send_message requests can be published to
+// the default destination is amqp_config
+type AmqpDestinationConfig struct {
+	Name       string `yaml:"name"`
+	AmqpConfig `yaml:",inline"`
+}
+
+// AmqpRouteConfig is a configuration struct to route send_message requests whose routing keys start with the prefix
+// the longest prefix matching the key is used, requests giving destination or exchange override the route
+type AmqpRouteConfig struct {
+	KeyPrefix   string `yaml:"key_prefix"`
+	Destination string `yaml:"destination,omitempty"` // default destination if not given
+	Exchange    string `yaml:"exchange,omitempty"`    // exchange of the destination if not given
+}
+
+// validateMessageDefaults validates message defaults and returns error if occurs
+func (config *AmqpConfig) validateMessageDefaults() error {
+	keyPrefixes := map[string]bool{}
+	for _, defaults := range config.MessageDefaults {
+		if keyPrefixes[defaults.KeyPrefix] {
+			return fmt.Errorf("AMQP message defaults for key prefix '%s' are given twice", defaults.KeyPrefix)
+		}
+		keyPrefixes[defaults.KeyPrefix] = true
+
+		if defaults.Expiration < 0 {
+			return fmt.Errorf("AMQP message expiration for key prefix '%s' must not be negative", defaults.KeyPrefix)
+		}
+	}
+
+	return nil
+}
+
+// GetAmqpRoute returns the route of send_message requests with the routing key, nil if no prefix matches
+func (config *ServerConfig) GetAmqpRoute(key string) *AmqpRouteConfig {
+	var matched *AmqpRouteConfig
+	for idx := range config.AmqpRoutes {
+		route := &config.AmqpRoutes[idx]
+		if !strings.HasPrefix(key, route.KeyPrefix) {
+			continue
+		}
+
+		if matched == nil || len(route.KeyPrefix) > len(matched.KeyPrefix) {
+			matched = route
+		}
+	}
+
+	return matched
+}
+
+// GetMessageOutputs returns backends send_message requests are delivered to, AMQP if not given
+func (config *ServerConfig) GetMessageOutputs() ([]MessageOutput, error) {
+	if len(config.MessageOutputs) == 0 {
+		return []MessageOutput{MessageOutputAMQP}, nil
+	}
+
+	outputs := []MessageOutput{}
+	for _, output := range config.MessageOutputs {
+		switch MessageOutput(strings.ToLower(output)) {
+		case MessageOutputAMQP:
+			outputs = append(outputs, MessageOutputAMQP)
+		case MessageOutputKafka:
+			outputs = append(outputs, MessageOutputKafka)
+		case MessageOutputNATS:
+			outputs = append(outputs, MessageOutputNATS)
+		default:
+			return nil, fmt.Errorf("unknown message output %s", output)
+		}
+	}
+
+	return outputs, nil
+}
+
+// HasMessageOutput returns true if send_message requests are delivered to the backend
+func (config *ServerConfig) HasMessageOutput(output MessageOutput) bool {
+	outputs, err := config.GetMessageOutputs()
+	if err != nil {
+		return false
+	}
+
+	for _, o := range outputs {
+		if o == output {
+			return true
+		}
+	}
+	return false
+}
+
+// GetEventSource returns a message bus iRODS events are consumed from, AMQP if not given
+func (config *ServerConfig) GetEventSource() (EventSource, error) {
+	switch EventSource(strings.ToLower(config.EventSource)) {
+	case EventSourceAMQP, "":
+		return EventSourceAMQP, nil
+	case EventSourceNATS:
+		return EventSourceNATS, nil
+	default:
+		return EventSourceAMQP, fmt.Errorf("unknown event source %s", config.EventSource)
+	}
+}
+
+// GetMessageDefaults returns defaults of messages with the routing key, nil if no prefix matches
+func (config *AmqpConfig) GetMessageDefaults(key string) *AmqpMessageDefaultsConfig {
+	var matched *AmqpMessageDefaultsConfig
+	for idx := range config.MessageDefaults {
+		defaults := &config.MessageDefaults[idx]
+		if !strings.HasPrefix(key, defaults.KeyPrefix) {
+			continue
+		}
+
+		if matched == nil || len(defaults.KeyPrefix) > len(matched.KeyPrefix) {
+			matched = defaults
+		}
+	}
+
+	return matched
 }
 
 type BisqueConfig struct {
@@ -36,6 +209,24 @@ type BisqueConfig struct {
 	IrodsRootPath string `yaml:"irods_root_path"` // e.g., '/ucsb/home' for ucsb
 }
 
+// RetentionPolicyConfig is a configuration struct for retention of a spool dir, zero values mean unlimited
+type RetentionPolicyConfig struct {
+	MaxAge        time.Duration `yaml:"max_age,omitempty"`
+	MaxFileCount  int           `yaml:"max_file_count,omitempty"`
+	MaxTotalBytes int64         `yaml:"max_total_bytes,omitempty"`
+	Archive       bool          `yaml:"archive,omitempty"` // archive pruned items into dated tarballs instead of deleting
+}
+
+// RetentionConfig is a configuration struct for retention of failed/expired/quarantine/archive spool dirs
+type RetentionConfig struct {
+	CheckInterval time.Duration         `yaml:"check_interval,omitempty"`
+	Failed        RetentionPolicyConfig `yaml:"failed,omitempty"`
+	Expired       RetentionPolicyConfig `yaml:"expired,omitempty"`
+	Quarantine    RetentionPolicyConfig `yaml:"quarantine,omitempty"`
+	Archive       RetentionPolicyConfig `yaml:"archive,omitempty"` // archive option is ignored
+	Results       RetentionPolicyConfig `yaml:"results,omitempty"` // results not taken by clients, archive option is ignored
+}
+
 type IrodsConfig struct {
 	Host          string `yaml:"host"`
 	Port          int    `yaml:"port"`
@@ -44,6 +235,18 @@ type IrodsConfig struct {
 	AdminPassword string `yaml:"admin_password"`
 }
 
+func getControlSocketFilename() string {
+	return "control.sock"
+}
+
+func getPIDFilename() string {
+	return "irods_rule_async_exec_cmd.pid"
+}
+
+func getLockFilename() string {
+	return "irods_rule_async_exec_cmd.lock"
+}
+
 func getLogFilename() string {
 	return "irods_rule_async_exec_cmd.log"
 }
@@ -62,6 +265,18 @@ type ServerConfig struct {
 
 	// iRODS FS Event Publish
 	AmqpConfig AmqpConfig `yaml:"amqp_config,omitempty"`
+	// other destinations send_message requests can be published to, and routes to them
+	AmqpDestinations []AmqpDestinationConfig `yaml:"amqp_destinations,omitempty"`
+	AmqpRoutes       []AmqpRouteConfig       `yaml:"amqp_routes,omitempty"`
+
+	// Kafka send_message requests can be produced to
+	KafkaConfig KafkaConfig `yaml:"kafka_config,omitempty"`
+	// NATS JetStream send_message requests can be published to, and iRODS events can be consumed from
+	NatsConfig NatsConfig `yaml:"nats_config,omitempty"`
+	// backends send_message requests are delivered to, amqp, kafka and/or nats
+	MessageOutputs []string `yaml:"message_outputs,omitempty"`
+	// message bus iRODS events are consumed from for BisQue, amqp or nats
+	EventSource string `yaml:"event_source,omitempty"`
 
 	// Bisque
 	BisqueConfig BisqueConfig `yaml:"bisque_config,omitempty"`
@@ -69,12 +284,45 @@ type ServerConfig struct {
 	// iRODS
 	IrodsConfig IrodsConfig `yaml:"irods_config,omitempty"`
 
+	// turn-in dir, placed in data root dir if not given. can be shared with other instances on shared storage
+	TurnInDirPath string `yaml:"turnin_dir_path,omitempty"`
+	// name of this instance claiming turn-ins in the turn-in dir, host name if not given
+	InstanceName string `yaml:"instance_name,omitempty"`
+	// turn-ins claimed by an instance are reclaimed by others if the instance does not renew its lease in time
+	TurnInLeaseDuration time.Duration `yaml:"turnin_lease_duration,omitempty"`
+	// max number of turn-ins taken by a scrape, so instances share the work and new high priority turn-ins do not wait long, 0 for no limit
+	TurnInScrapeLimit int `yaml:"turnin_scrape_limit,omitempty"`
+
+	// default TTLs of turn-in items per request type (e.g., link_bisque: 168h), no expiry if not given. keys must be request types
+	TurnInTTLs map[string]time.Duration `yaml:"turnin_ttls,omitempty"`
+	// raises priority of waiting turn-in items by one level per interval, 0 to disable
+	TurnInPriorityAging time.Duration `yaml:"turnin_priority_aging,omitempty"`
+
+	// retention of failed, expired, quarantined and archived turn-ins
+	RetentionConfig RetentionConfig `yaml:"retention_config,omitempty"`
+
+	// control socket, placed in data root dir if not given
+	ControlSocketPath  string `yaml:"control_socket_path,omitempty"`
+	ControlSocketMode  string `yaml:"control_socket_mode,omitempty"`  // permission in octal, e.g., 0660
+	ControlSocketGroup string `yaml:"control_socket_group,omitempty"` // group owning the socket, e.g., irods
+
+	// PID file of the running service, placed in data root dir if not given
+	PIDFilePath string `yaml:"pid_file_path,omitempty"`
+
 	// for Logging
-	LogPath string `yaml:"log_path,omitempty"`
+	LogPath   string `yaml:"log_path,omitempty"`
+	LogFormat string `yaml:"log_format,omitempty"` // text or json
+
+	// for Tracing
+	TracingConfig TracingConfig `yaml:"tracing_config,omitempty"`
 
 	Foreground   bool `yaml:"foreground,omitempty"`
+	Systemd      bool `yaml:"systemd,omitempty"` // run in foreground, notifying systemd of readiness and liveness
 	Debug        bool `yaml:"debug,omitempty"`
 	ChildProcess bool `yaml:"childprocess,omitempty"`
+
+	// path of the config file read, to reload on SIGHUP
+	ConfigFilePath string `yaml:"config_file_path,omitempty"`
 }
 
 // NewDefaultServerConfig returns a default server config
@@ -87,6 +335,11 @@ func NewDefaultServerConfig() *ServerConfig {
 			Exchange: "",
 		},
 
+		KafkaConfig:    NewDefaultKafkaConfig(),
+		NatsConfig:     NewDefaultNatsConfig(),
+		MessageOutputs: []string{string(MessageOutputAMQP)},
+		EventSource:    string(EventSourceAMQP),
+
 		BisqueConfig: BisqueConfig{
 			URL:           "",
 			AdminUsername: "",
@@ -104,9 +357,34 @@ func NewDefaultServerConfig() *ServerConfig {
 			AdminPassword: "",
 		},
 
-		LogPath: "", // use default
+		TurnInDirPath:       "", // use default
+		InstanceName:        "", // use host name
+		TurnInLeaseDuration: TurnInLeaseDurationDefault,
+		TurnInScrapeLimit:   TurnInScrapeLimitDefault,
+
+		TurnInTTLs:          map[string]time.Duration{},
+		TurnInPriorityAging: TurnInPriorityAgingDefault,
+
+		RetentionConfig: RetentionConfig{
+			CheckInterval: RetentionCheckIntervalDefault,
+			Results: RetentionPolicyConfig{
+				MaxAge: ResultRetentionMaxAgeDefault,
+			},
+		},
+
+		ControlSocketPath:  "", // use default
+		ControlSocketMode:  ControlSocketModeDefault,
+		ControlSocketGroup: "",
+
+		PIDFilePath: "", // use default
+
+		LogPath:   "", // use default
+		LogFormat: string(LogFormatText),
+
+		TracingConfig: NewDefaultTracingConfig(),
 
 		Foreground:   false,
+		Systemd:      false,
 		Debug:        false,
 		ChildProcess: false,
 	}
@@ -134,10 +412,83 @@ func (config *ServerConfig) GetLogFilePath() string {
 	return path.Join(config.DataRootPath, getLogFilename())
 }
 
+// GetPIDFilePath returns PID file path
+func (config *ServerConfig) GetPIDFilePath() string {
+	if len(config.PIDFilePath) > 0 {
+		return config.PIDFilePath
+	}
+
+	// default
+	return path.Join(config.DataRootPath, getPIDFilename())
+}
+
+// GetLockFilePath returns path of the lock file held by the running service
+// it is always in data root dir, as the lock guards the turn-in dir in it
+func (config *ServerConfig) GetLockFilePath() string {
+	return path.Join(config.DataRootPath, getLockFilename())
+}
+
+// GetControlSocketPath returns control socket path
+func (config *ServerConfig) GetControlSocketPath() string {
+	if len(config.ControlSocketPath) > 0 {
+		return config.ControlSocketPath
+	}
+
+	// default
+	return path.Join(config.DataRootPath, getControlSocketFilename())
+}
+
+// GetControlSocketMode returns permission of control socket
+func (config *ServerConfig) GetControlSocketMode() (os.FileMode, error) {
+	modeString := config.ControlSocketMode
+	if len(modeString) == 0 {
+		// default
+		modeString = ControlSocketModeDefault
+	}
+
+	mode, err := strconv.ParseUint(modeString, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse control socket mode %s - %v", modeString, err)
+	}
+
+	if mode&^uint64(os.ModePerm) != 0 {
+		return 0, fmt.Errorf("control socket mode %s is not a permission", modeString)
+	}
+
+	return os.FileMode(mode), nil
+}
+
 func (config *ServerConfig) GetTurnInRootDirPath() string {
+	if len(config.TurnInDirPath) > 0 {
+		return config.TurnInDirPath
+	}
+
 	return path.Join(config.DataRootPath, "turnin")
 }
 
+// GetInstanceName returns name of this instance, host name if not given
+func (config *ServerConfig) GetInstanceName() (string, error) {
+	if len(config.InstanceName) > 0 {
+		return config.InstanceName, nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to get host name for instance name - %v", err)
+	}
+
+	return hostname, nil
+}
+
+// GetTurnInTTL returns default TTL of turn-in items of the given request type, 0 if items never expire
+func (config *ServerConfig) GetTurnInTTL(requestType string) time.Duration {
+	if ttl, ok := config.TurnInTTLs[requestType]; ok {
+		return ttl
+	}
+
+	return 0
+}
+
 // MakeLogDir makes a log dir required
 func (config *ServerConfig) MakeLogDir() error {
 	logFilePath := config.GetLogFilePath()
@@ -158,6 +509,12 @@ func (config *ServerConfig) MakeWorkDirs() error {
 		return err
 	}
 
+	pidDirPath := filepath.Dir(config.GetPIDFilePath())
+	err = config.makeDir(pidDirPath)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -194,18 +551,213 @@ func (config *ServerConfig) makeDir(path string) error {
 	return nil
 }
 
+// Redacted returns a copy of the config with secrets redacted, to print
+func (config *ServerConfig) Redacted() *ServerConfig {
+	redacted := *config
+
+	redacted.AmqpConfig.URL = RedactURL(config.AmqpConfig.URL)
+
+	// do not modify destinations of the config
+	redacted.AmqpDestinations = make([]AmqpDestinationConfig, len(config.AmqpDestinations))
+	for idx, destination := range config.AmqpDestinations {
+		destination.URL = RedactURL(destination.URL)
+		redacted.AmqpDestinations[idx] = destination
+	}
+
+	redacted.NatsConfig.URL = RedactNatsURL(config.NatsConfig.URL)
+
+	if len(config.KafkaConfig.SASL.Password) > 0 {
+		redacted.KafkaConfig.SASL.Password = RedactedValue
+	}
+
+	if len(config.BisqueConfig.AdminPassword) > 0 {
+		redacted.BisqueConfig.AdminPassword = RedactedValue
+	}
+
+	if len(config.IrodsConfig.AdminPassword) > 0 {
+		redacted.IrodsConfig.AdminPassword = RedactedValue
+	}
+
+	return &redacted
+}
+
+// RedactURL returns the URL with password redacted
+func RedactURL(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	// replaces password with xxxxx
+	return parsedURL.Redacted()
+}
+
+// ServerConfigSection is a section of ServerConfig compared on reload
+type ServerConfigSection string
+
+const (
+	DataRootPathSection        ServerConfigSection = "data_root_path"
+	TurnInDirPathSection       ServerConfigSection = "turnin_dir_path"
+	InstanceSection            ServerConfigSection = "instance"
+	AmqpConfigSection          ServerConfigSection = "amqp_config"
+	AmqpDestinationsSection    ServerConfigSection = "amqp_destinations"
+	AmqpRoutesSection          ServerConfigSection = "amqp_routes"
+	KafkaConfigSection         ServerConfigSection = "kafka_config"
+	NatsConfigSection          ServerConfigSection = "nats_config"
+	MessageOutputsSection      ServerConfigSection = "message_outputs"
+	EventSourceSection         ServerConfigSection = "event_source"
+	BisqueConfigSection        ServerConfigSection = "bisque_config"
+	IrodsConfigSection         ServerConfigSection = "irods_config"
+	TurnInTTLsSection          ServerConfigSection = "turnin_ttls"
+	TurnInPriorityAgingSection ServerConfigSection = "turnin_priority_aging"
+	TurnInScrapeLimitSection   ServerConfigSection = "turnin_scrape_limit"
+	RetentionConfigSection     ServerConfigSection = "retention_config"
+	ControlSocketSection       ServerConfigSection = "control_socket"
+	PIDFilePathSection         ServerConfigSection = "pid_file_path"
+	LogPathSection             ServerConfigSection = "log_path"
+	LogFormatSection           ServerConfigSection = "log_format"
+	TracingConfigSection       ServerConfigSection = "tracing_config"
+	DebugSection               ServerConfigSection = "debug"
+)
+
+// Diff returns sections changed in the other config
+func (config *ServerConfig) Diff(other *ServerConfig) []ServerConfigSection {
+	changes := []ServerConfigSection{}
+
+	sections := []struct {
+		section ServerConfigSection
+		equal   bool
+	}{
+		{DataRootPathSection, config.DataRootPath == other.DataRootPath},
+		{TurnInDirPathSection, config.TurnInDirPath == other.TurnInDirPath},
+		{InstanceSection, config.InstanceName == other.InstanceName && config.TurnInLeaseDuration == other.TurnInLeaseDuration},
+		{AmqpConfigSection, reflect.DeepEqual(config.AmqpConfig, other.AmqpConfig)},
+		{AmqpDestinationsSection, reflect.DeepEqual(config.AmqpDestinations, other.AmqpDestinations)},
+		{AmqpRoutesSection, reflect.DeepEqual(config.AmqpRoutes, other.AmqpRoutes)},
+		{KafkaConfigSection, reflect.DeepEqual(config.KafkaConfig, other.KafkaConfig)},
+		{NatsConfigSection, config.NatsConfig == other.NatsConfig},
+		{MessageOutputsSection, reflect.DeepEqual(config.MessageOutputs, other.MessageOutputs)},
+		{EventSourceSection, config.EventSource == other.EventSource},
+		{BisqueConfigSection, config.BisqueConfig == other.BisqueConfig},
+		{IrodsConfigSection, config.IrodsConfig == other.IrodsConfig},
+		{TurnInTTLsSection, reflect.DeepEqual(config.TurnInTTLs, other.TurnInTTLs)},
+		{TurnInPriorityAgingSection, config.TurnInPriorityAging == other.TurnInPriorityAging},
+		{TurnInScrapeLimitSection, config.TurnInScrapeLimit == other.TurnInScrapeLimit},
+		{RetentionConfigSection, config.RetentionConfig == other.RetentionConfig},
+		{ControlSocketSection, config.ControlSocketPath == other.ControlSocketPath && config.ControlSocketMode == other.ControlSocketMode && config.ControlSocketGroup == other.ControlSocketGroup},
+		{PIDFilePathSection, config.PIDFilePath == other.PIDFilePath},
+		{LogPathSection, config.LogPath == other.LogPath},
+		{LogFormatSection, config.LogFormat == other.LogFormat},
+		{TracingConfigSection, config.TracingConfig == other.TracingConfig},
+		{DebugSection, config.Debug == other.Debug},
+	}
+
+	for _, section := range sections {
+		if !section.equal {
+			changes = append(changes, section.section)
+		}
+	}
+
+	return changes
+}
+
 // Validate validates field values and returns error if occurs
 func (config *ServerConfig) Validate() error {
 	if len(config.DataRootPath) == 0 {
 		return fmt.Errorf("data root dir must be given")
 	}
 
-	if len(config.AmqpConfig.URL) == 0 {
-		return errors.New("AMQP URL is not given")
+	outputs, err := config.GetMessageOutputs()
+	if err != nil {
+		return err
+	}
+
+	outputsGiven := map[MessageOutput]bool{}
+	for _, output := range outputs {
+		if outputsGiven[output] {
+			return fmt.Errorf("message output %s is given twice", output)
+		}
+		outputsGiven[output] = true
+	}
+
+	eventSource, err := config.GetEventSource()
+	if err != nil {
+		return err
+	}
+
+	// BisQue consumes iRODS events from the event source
+	bisqueEnabled := len(config.BisqueConfig.URL) > 0
+
+	if outputsGiven[MessageOutputAMQP] || (bisqueEnabled && eventSource == EventSourceAMQP) || len(config.AmqpConfig.URL) > 0 {
+		if len(config.AmqpConfig.URL) == 0 {
+			return errors.New("AMQP URL is not given")
+		}
+
+		if len(config.AmqpConfig.Exchange) == 0 {
+			return errors.New("AMQP Exchange is not given")
+		}
+	}
+
+	err = config.AmqpConfig.validateMessageDefaults()
+	if err != nil {
+		return err
 	}
 
-	if len(config.AmqpConfig.Exchange) == 0 {
-		return errors.New("AMQP Exchange is not given")
+	if outputsGiven[MessageOutputKafka] || config.KafkaConfig.IsConfigured() {
+		err = config.KafkaConfig.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if outputsGiven[MessageOutputNATS] || (bisqueEnabled && eventSource == EventSourceNATS) || config.NatsConfig.IsConfigured() {
+		err = config.NatsConfig.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if bisqueEnabled && eventSource == EventSourceNATS && len(config.NatsConfig.EventSubjectPrefix) == 0 {
+		return errors.New("NATS event subject prefix is not given, iRODS events are consumed from NATS")
+	}
+
+	destinations := map[string]bool{
+		AmqpDestinationDefault: true,
+	}
+	for _, destination := range config.AmqpDestinations {
+		if len(destination.Name) == 0 {
+			return errors.New("AMQP destination name is not given")
+		}
+
+		if destinations[destination.Name] {
+			return fmt.Errorf("AMQP destination %s is given twice, or uses a reserved name", destination.Name)
+		}
+		destinations[destination.Name] = true
+
+		if len(destination.URL) == 0 {
+			return fmt.Errorf("AMQP URL of destination %s is not given", destination.Name)
+		}
+
+		if len(destination.Exchange) == 0 {
+			return fmt.Errorf("AMQP Exchange of destination %s is not given", destination.Name)
+		}
+
+		err = destination.validateMessageDefaults()
+		if err != nil {
+			return fmt.Errorf("AMQP destination %s - %v", destination.Name, err)
+		}
+	}
+
+	routeKeyPrefixes := map[string]bool{}
+	for _, route := range config.AmqpRoutes {
+		if routeKeyPrefixes[route.KeyPrefix] {
+			return fmt.Errorf("AMQP route for key prefix '%s' is given twice", route.KeyPrefix)
+		}
+		routeKeyPrefixes[route.KeyPrefix] = true
+
+		if len(route.Destination) > 0 && !destinations[route.Destination] {
+			return fmt.Errorf("AMQP route for key prefix '%s' has unknown destination %s", route.KeyPrefix, route.Destination)
+		}
 	}
 
 	// bisque config is optional
@@ -259,5 +811,69 @@ func (config *ServerConfig) Validate() error {
 		return errors.New("IRODS Admin Password is not given")
 	}
 
+	requestTypes := map[string]bool{}
+	for _, requestType := range turnin.GetTurnInRequestTypes() {
+		requestTypes[string(requestType)] = true
+	}
+
+	for requestType, ttl := range config.TurnInTTLs {
+		if !requestTypes[requestType] {
+			return fmt.Errorf("turn-in TTL is given for unknown request type %s", requestType)
+		}
+
+		if ttl < 0 {
+			return fmt.Errorf("turn-in TTL for %s must not be negative", requestType)
+		}
+	}
+
+	if config.TurnInPriorityAging < 0 {
+		return errors.New("turn-in priority aging must not be negative")
+	}
+
+	if strings.ContainsAny(config.InstanceName, "/\\") || config.InstanceName == "." || config.InstanceName == ".." {
+		return fmt.Errorf("instance name %s must not be a path", config.InstanceName)
+	}
+
+	if config.TurnInLeaseDuration < TurnInLeaseDurationMin {
+		return fmt.Errorf("turn-in lease duration must be at least %s", TurnInLeaseDurationMin.String())
+	}
+
+	if config.TurnInScrapeLimit < 0 {
+		return errors.New("turn-in scrape limit must not be negative")
+	}
+
+	if config.RetentionConfig.CheckInterval <= 0 {
+		return errors.New("retention check interval must be positive")
+	}
+
+	retentionPolicies := map[string]RetentionPolicyConfig{
+		"failed":     config.RetentionConfig.Failed,
+		"expired":    config.RetentionConfig.Expired,
+		"quarantine": config.RetentionConfig.Quarantine,
+		"archive":    config.RetentionConfig.Archive,
+		"results":    config.RetentionConfig.Results,
+	}
+
+	for name, policy := range retentionPolicies {
+		if policy.MaxAge < 0 || policy.MaxFileCount < 0 || policy.MaxTotalBytes < 0 {
+			return fmt.Errorf("retention policy for %s must not have negative values", name)
+		}
+	}
+
+	_, err = config.GetControlSocketMode()
+	if err != nil {
+		return err
+	}
+
+	_, err = GetLogFormat(config.LogFormat)
+	if err != nil {
+		return err
+	}
+
+	err = config.TracingConfig.Validate()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
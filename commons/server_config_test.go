@@ -0,0 +1,39 @@
+package commons
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServerConfigValidateTurnInTTLs(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttls      map[string]time.Duration
+		expectErr bool
+	}{
+		{name: "none"},
+		{name: "known types", ttls: map[string]time.Duration{"send_message": time.Hour, "link_bisque": 168 * time.Hour, "irods_metadata": 0}},
+		{name: "negative", ttls: map[string]time.Duration{"send_message": -time.Hour}, expectErr: true},
+		{name: "unknown type", ttls: map[string]time.Duration{"send_msg": time.Hour}, expectErr: true},
+		{name: "case sensitive", ttls: map[string]time.Duration{"Send_Message": time.Hour}, expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := NewDefaultServerConfig()
+			config.DataRootPath = t.TempDir()
+			config.AmqpConfig.URL = "amqp://localhost:5672"
+			config.AmqpConfig.Exchange = "irods"
+			config.IrodsConfig.Host = "localhost"
+			config.IrodsConfig.Zone = "zone"
+			config.IrodsConfig.AdminUsername = "rods"
+			config.IrodsConfig.AdminPassword = "password"
+			config.TurnInTTLs = test.ttls
+
+			err := config.Validate()
+			if test.expectErr != (err != nil) {
+				t.Errorf("expected error %t, got %v", test.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package commons
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingExporter is an exporter of trace spans
+type TracingExporter string
+
+const (
+	// TracingExporterNone disables tracing
+	TracingExporterNone TracingExporter = "none"
+	// TracingExporterOTLP sends spans to an OTLP/HTTP collector
+	TracingExporterOTLP TracingExporter = "otlp"
+	// TracingExporterFile writes spans to a file in JSON
+	TracingExporterFile TracingExporter = "file"
+
+	TracingOTLPEndpointDefault string  = "http://localhost:4318"
+	TracingSampleRatioDefault  float64 = 1.0
+
+	// TracingShutdownTimeout is the max time to flush spans on release
+	TracingShutdownTimeout time.Duration = 5 * time.Second
+
+	TracingServiceNameClient  string = "irods-rule-async-exec-cmd"
+	TracingServiceNameService string = "irods-rule-async-exec-svc"
+
+	// TracerName is the instrumentation name of spans
+	TracerName string = "github.com/cyverse/irods-rule-async-exec-cmd"
+
+	// TracingRequestIDKey is a span attribute having the request ID of a turn-in
+	TracingRequestIDKey attribute.Key = "turnin.request_id"
+	// TracingRequestTypeKey is a span attribute having the request type of a turn-in
+	TracingRequestTypeKey attribute.Key = "turnin.request_type"
+)
+
+// TracingConfig is a configuration struct for OpenTelemetry tracing
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter,omitempty"`      // none, otlp or file
+	OTLPEndpoint string  `yaml:"otlp_endpoint,omitempty"` // URL of OTLP/HTTP collector, e.g., http://localhost:4318
+	FilePath     string  `yaml:"file_path,omitempty"`     // file to append spans to, one JSON object per span
+	SampleRatio  float64 `yaml:"sample_ratio"`            // ratio of new traces sampled, from 0 to 1
+}
+
+// NewDefaultTracingConfig returns a default tracing config, tracing is disabled
+func NewDefaultTracingConfig() TracingConfig {
+	return TracingConfig{
+		Exporter:     string(TracingExporterNone),
+		OTLPEndpoint: TracingOTLPEndpointDefault,
+		FilePath:     "",
+		SampleRatio:  TracingSampleRatioDefault,
+	}
+}
+
+// GetExporter returns TracingExporter, none if empty
+func (config *TracingConfig) GetExporter() (TracingExporter, error) {
+	switch TracingExporter(config.Exporter) {
+	case TracingExporterNone, "":
+		return TracingExporterNone, nil
+	case TracingExporterOTLP:
+		return TracingExporterOTLP, nil
+	case TracingExporterFile:
+		return TracingExporterFile, nil
+	default:
+		return TracingExporterNone, fmt.Errorf("unknown tracing exporter %s", config.Exporter)
+	}
+}
+
+// Validate validates field values and returns error if occurs
+func (config *TracingConfig) Validate() error {
+	exporter, err := config.GetExporter()
+	if err != nil {
+		return err
+	}
+
+	switch exporter {
+	case TracingExporterOTLP:
+		_, err := url.Parse(config.OTLPEndpoint)
+		if err != nil || len(config.OTLPEndpoint) == 0 {
+			return fmt.Errorf("invalid OTLP endpoint %s", config.OTLPEndpoint)
+		}
+	case TracingExporterFile:
+		if len(config.FilePath) == 0 {
+			return errors.New("tracing file path is not given")
+		}
+	}
+
+	if config.SampleRatio < 0 || config.SampleRatio > 1 {
+		return errors.New("tracing sample ratio must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// Tracing provides tracers, spans are dropped if tracing is disabled
+type Tracing struct {
+	provider *sdktrace.TracerProvider
+	writer   io.Closer
+}
+
+// NewTracing creates Tracing for the config, exporting spans of the given service
+func NewTracing(config *TracingConfig, serviceName string) (*Tracing, error) {
+	exporterType, err := config.GetExporter()
+	if err != nil {
+		return nil, err
+	}
+
+	tracing := &Tracing{}
+
+	var exporter sdktrace.SpanExporter
+	switch exporterType {
+	case TracingExporterNone:
+		return tracing, nil
+	case TracingExporterOTLP:
+		endpoint, err := url.Parse(config.OTLPEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse OTLP endpoint %s - %v", config.OTLPEndpoint, err)
+		}
+
+		options := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(endpoint.Host),
+		}
+
+		if endpoint.Scheme != "https" {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+
+		if len(strings.Trim(endpoint.Path, "/")) > 0 {
+			options = append(options, otlptracehttp.WithURLPath(endpoint.Path))
+		}
+
+		// does not connect until spans are exported
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter - %v", err)
+		}
+	case TracingExporterFile:
+		file, err := os.OpenFile(config.FilePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open tracing file %s - %v", config.FilePath, err)
+		}
+
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to create file exporter - %v", err)
+		}
+
+		tracing.writer = file
+	}
+
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersionKey.String(GetReleaseVersion()),
+	)
+
+	tracing.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// follow the decision of the caller if a span is given in the trace context
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+
+	return tracing, nil
+}
+
+// GetTracer returns a tracer of the name, a no-op tracer if tracing is disabled
+func (tracing *Tracing) GetTracer(name string) trace.Tracer {
+	if tracing == nil || tracing.provider == nil {
+		return trace.NewNoopTracerProvider().Tracer(name)
+	}
+
+	return tracing.provider.Tracer(name)
+}
+
+// Release flushes spans not exported yet and releases the exporter
+func (tracing *Tracing) Release() error {
+	if tracing == nil || tracing.provider == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TracingShutdownTimeout)
+	defer cancel()
+
+	err := tracing.provider.Shutdown(ctx)
+
+	if tracing.writer != nil {
+		tracing.writer.Close()
+		tracing.writer = nil
+	}
+
+	tracing.provider = nil
+	return err
+}
+
+// SetSpanError marks the span failed with the error
+func SetSpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,57 @@
+package control
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// Client is a client of the control socket
+type Client struct {
+	socketPath string
+	timeout    time.Duration
+}
+
+// NewClient creates a new Client
+func NewClient(socketPath string, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = TimeoutDefault
+	}
+
+	return &Client{
+		socketPath: socketPath,
+		timeout:    timeout,
+	}
+}
+
+// Call sends a request to the service and returns its response
+// returns UnavailableError if the service cannot be reached, ServiceError if the service fails to handle the request
+func (client *Client) Call(request *Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", client.socketPath, client.timeout)
+	if err != nil {
+		return nil, NewUnavailableErrorf("failed to connect to control socket %s - %v", client.socketPath, err)
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(client.timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	err = WriteMessage(conn, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send a %s request - %v", request.Command, err)
+	}
+
+	response := Response{}
+	err = ReadMessage(conn, &response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive a response of a %s request - %v", request.Command, err)
+	}
+
+	if len(response.Error) > 0 {
+		return &response, NewServiceError(response.Error, response.ErrorClass)
+	}
+
+	return &response, nil
+}
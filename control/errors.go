@@ -0,0 +1,60 @@
+package control
+
+import "fmt"
+
+// UnavailableError is an error returned when the control socket cannot be reached
+type UnavailableError struct {
+	message string
+}
+
+// NewUnavailableErrorf creates UnavailableError struct
+func NewUnavailableErrorf(format string, v ...interface{}) *UnavailableError {
+	return &UnavailableError{
+		message: fmt.Sprintf(format, v...),
+	}
+}
+
+func (e *UnavailableError) Error() string {
+	return e.message
+}
+
+// IsUnavailableError evaluates if the given error is UnavailableError
+func IsUnavailableError(err error) bool {
+	if _, ok := err.(*UnavailableError); ok {
+		return true
+	}
+
+	return false
+}
+
+// ServiceError is an error returned by the service for a request
+type ServiceError struct {
+	message    string
+	errorClass string
+}
+
+// NewServiceError creates ServiceError struct
+func NewServiceError(message string, errorClass string) *ServiceError {
+	return &ServiceError{
+		message:    message,
+		errorClass: errorClass,
+	}
+}
+
+func (e *ServiceError) Error() string {
+	return e.message
+}
+
+// GetErrorClass returns class of the error
+func (e *ServiceError) GetErrorClass() string {
+	return e.errorClass
+}
+
+// IsServiceError evaluates if the given error is ServiceError
+func IsServiceError(err error) bool {
+	if _, ok := err.(*ServiceError); ok {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,186 @@
+package control
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// MessageSizeMax is the max size of a message exchanged over the control socket
+	MessageSizeMax uint32 = 16 * 1024 * 1024 // 16MB
+	// TimeoutDefault is the default timeout of a request over the control socket
+	TimeoutDefault time.Duration = 10 * time.Second
+)
+
+// Command is a command sent over the control socket
+type Command string
+
+const (
+	CommandStatus    Command = "status"
+	CommandPause     Command = "pause"
+	CommandResume    Command = "resume"
+	CommandScrape    Command = "scrape"
+	CommandDrain     Command = "drain"
+	CommandReconnect Command = "reconnect"
+	CommandErrors    Command = "errors"
+	CommandEnqueue   Command = "enqueue"
+)
+
+// GetCommands returns all commands
+func GetCommands() []Command {
+	return []Command{
+		CommandStatus,
+		CommandPause,
+		CommandResume,
+		CommandScrape,
+		CommandDrain,
+		CommandReconnect,
+		CommandErrors,
+		CommandEnqueue,
+	}
+}
+
+const (
+	// LaneSendMessage is a lane of send_message requests
+	LaneSendMessage string = "message"
+	// LaneBisque is a lane of BisQue requests
+	LaneBisque string = "bisque"
+	// LaneIRODS is a lane of iRODS requests, e.g., irods_metadata
+	LaneIRODS string = "irods"
+	// LaneAll selects all lanes
+	LaneAll string = "all"
+
+	// ComponentAMQP is the AMQP connection of the default destination, selects all destinations in reconnect
+	ComponentAMQP string = "amqp"
+	// ComponentAMQPDestinationPrefix is a prefix of AMQP connections of other destinations, followed by the name
+	ComponentAMQPDestinationPrefix string = "amqp:"
+	// ComponentAMQPConsumer is the AMQP connection consuming iRODS events, separated from publishing
+	ComponentAMQPConsumer string = "amqp_consumer"
+	// ComponentKafka is the Kafka producer
+	ComponentKafka string = "kafka"
+	// ComponentNATS is the NATS connection publishing to JetStream
+	ComponentNATS string = "nats"
+	// ComponentNATSConsumer is the NATS connection consuming iRODS events, separated from publishing
+	ComponentNATSConsumer string = "nats_consumer"
+	// ComponentIRODS is the iRODS connection
+	ComponentIRODS string = "irods"
+	// ComponentBisque is the BisQue client
+	ComponentBisque string = "bisque"
+	// ComponentAll selects all components
+	ComponentAll string = "all"
+)
+
+// Request is a request sent over the control socket
+type Request struct {
+	Command Command `json:"command"`
+	// Target is a lane for pause/resume, a component for reconnect
+	Target string `json:"target,omitempty"`
+	// Limit is the max number of records returned for errors
+	Limit int `json:"limit,omitempty"`
+	// Item is a turn-in request to enqueue, in the same JSON as turn-in files
+	Item json.RawMessage `json:"item,omitempty"`
+}
+
+// Response is a response to a request sent over the control socket
+type Response struct {
+	Error string `json:"error,omitempty"`
+	// ErrorClass is a class of the error, e.g., validation, queue_full
+	ErrorClass string `json:"error_class,omitempty"`
+	Message    string `json:"message,omitempty"`
+	// ID and FilePath of a turn-in enqueued
+	ID       string        `json:"id,omitempty"`
+	FilePath string        `json:"file_path,omitempty"`
+	Status   *Status       `json:"status,omitempty"`
+	Errors   []ErrorRecord `json:"errors,omitempty"`
+}
+
+// LaneStatus is a status of a lane
+type LaneStatus struct {
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+}
+
+// ComponentStatus is a status of a connection to a remote service
+type ComponentStatus struct {
+	Name       string `json:"name"`
+	Configured bool   `json:"configured"`
+	Connected  bool   `json:"connected"`
+	// LastActivityTime is the last time the component was seen working, e.g., an event is consumed
+	LastActivityTime time.Time `json:"last_activity_time,omitempty"`
+	// LastError is an error that disconnected the component last
+	LastError string `json:"last_error,omitempty"`
+}
+
+// BacklogStatus is a backlog of turn-ins for a priority level
+type BacklogStatus struct {
+	Priority           string    `json:"priority"`
+	Count              int       `json:"count"`
+	OldestCreationTime time.Time `json:"oldest_creation_time,omitempty"`
+}
+
+// Status is a status of the service
+type Status struct {
+	ServiceVersion string            `json:"service_version"`
+	StartTime      time.Time         `json:"start_time"`
+	Draining       bool              `json:"draining"`
+	Lanes          []LaneStatus      `json:"lanes"`
+	Components     []ComponentStatus `json:"components"`
+	Backlog        []BacklogStatus   `json:"backlog"`
+}
+
+// ErrorRecord is a record of an error occurred while processing a turn-in
+type ErrorRecord struct {
+	Time        time.Time `json:"time"`
+	ID          string    `json:"id,omitempty"`
+	RequestID   string    `json:"request_id,omitempty"`
+	RequestType string    `json:"request_type,omitempty"`
+	Error       string    `json:"error"`
+	ErrorClass  string    `json:"error_class,omitempty"`
+}
+
+// WriteMessage writes a message prefixed with its length in 4 bytes, big endian
+func WriteMessage(w io.Writer, v interface{}) error {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if uint32(len(bytes)) > MessageSizeMax {
+		return fmt.Errorf("message size %d exceeds max %d", len(bytes), MessageSizeMax)
+	}
+
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(bytes)))
+
+	_, err = w.Write(append(header, bytes...))
+	return err
+}
+
+// ReadMessage reads a message prefixed with its length in 4 bytes, big endian
+// returns io.EOF if no more messages are available
+func ReadMessage(r io.Reader, v interface{}) error {
+	header := make([]byte, 4)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	if size > MessageSizeMax {
+		return fmt.Errorf("message size %d exceeds max %d", size, MessageSizeMax)
+	}
+
+	bytes := make([]byte, size)
+	_, err = io.ReadFull(r, bytes)
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	return json.Unmarshal(bytes, v)
+}
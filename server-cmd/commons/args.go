@@ -15,6 +15,8 @@ import (
 
 const (
 	ChildProcessArgument = "child_process"
+
+	LogTimestampFormat string = "2006-01-02 15:04:05.000000"
 )
 
 func SetCommonFlags(command *cobra.Command) {
@@ -23,6 +25,7 @@ func SetCommonFlags(command *cobra.Command) {
 	command.Flags().BoolP("help", "h", false, "Print help")
 	command.Flags().BoolP("debug", "d", false, "Enable debug mode")
 	command.Flags().BoolP("foreground", "f", false, "Run in foreground")
+	command.Flags().Bool("systemd", false, "Run as a systemd service of notify type, in foreground")
 	command.Flags().Bool(ChildProcessArgument, false, "")
 }
 
@@ -44,6 +47,12 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.ServerConfig, io.Write
 		foreground, _ = strconv.ParseBool(foregroundFlag.Value.String())
 	}
 
+	systemd := false
+	systemdFlag := command.Flags().Lookup("systemd")
+	if systemdFlag != nil {
+		systemd, _ = strconv.ParseBool(systemdFlag.Value.String())
+	}
+
 	childProcess := false
 	childProcessFlag := command.Flags().Lookup(ChildProcessArgument)
 	if childProcessFlag != nil {
@@ -93,6 +102,7 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.ServerConfig, io.Write
 
 			// overwrite config
 			config = serverConfig
+			config.ConfigFilePath = configPath
 			readConfig = true
 		}
 	}
@@ -113,6 +123,7 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.ServerConfig, io.Write
 
 		// overwrite config
 		config = serverConfig
+		config.ConfigFilePath = commons.ConfigFilePathDefault
 		readConfig = true
 	}
 
@@ -130,6 +141,15 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.ServerConfig, io.Write
 		config.Foreground = true
 	}
 
+	if systemd {
+		config.Systemd = true
+	}
+
+	if config.Systemd {
+		// systemd tracks the process it started, do not fork
+		config.Foreground = true
+	}
+
 	config.ChildProcess = childProcess
 
 	err := config.MakeLogDir()
@@ -142,6 +162,10 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.ServerConfig, io.Write
 		log.SetLevel(log.DebugLevel)
 	}
 
+	// invalid format is reported on validation
+	logFormat, _ := commons.GetLogFormat(config.LogFormat)
+	log.SetFormatter(commons.NewLogFormatter(logFormat, LogTimestampFormat))
+
 	var logWriter io.WriteCloser
 	logFilePath := config.GetLogFilePath()
 	if logFilePath == "-" || len(logFilePath) == 0 {
@@ -166,6 +190,22 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.ServerConfig, io.Write
 	return config, logWriter, true, nil // continue
 }
 
+// ReadConfigFile reads a config file, defaults are applied to fields not given
+func ReadConfigFile(configPath string) (*commons.ServerConfig, error) {
+	yamlBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := commons.NewServerConfigFromYAML(yamlBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	config.ConfigFilePath = configPath
+	return config, nil
+}
+
 func PrintVersion(command *cobra.Command) error {
 	info, err := commons.GetVersionJSON()
 	if err != nil {
@@ -169,6 +169,10 @@ func ChildProcessReadConfigViaSTDIN() (*commons.ServerConfig, io.WriteCloser, er
 		log.SetLevel(log.DebugLevel)
 	}
 
+	// invalid format is reported on validation
+	logFormat, _ := commons.GetLogFormat(config.LogFormat)
+	log.SetFormatter(commons.NewLogFormatter(logFormat, LogTimestampFormat))
+
 	err = config.Validate()
 	if err != nil {
 		logger.Error(err)
@@ -0,0 +1,152 @@
+package commons
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// SystemdNotifyReady tells systemd that the service is ready
+	SystemdNotifyReady string = "READY=1"
+	// SystemdNotifyReloading tells systemd that the service is reloading configuration
+	SystemdNotifyReloading string = "RELOADING=1"
+	// SystemdNotifyStopping tells systemd that the service is stopping
+	SystemdNotifyStopping string = "STOPPING=1"
+	// SystemdNotifyWatchdog tells systemd that the service is alive
+	SystemdNotifyWatchdog string = "WATCHDOG=1"
+
+	// SystemdControlSocketName is the name of the control socket passed by systemd, set with FileDescriptorName
+	SystemdControlSocketName string = "control"
+
+	// systemdListenFDsStart is the first file descriptor passed by systemd
+	systemdListenFDsStart int = 3
+)
+
+// SystemdNotify sends a state to systemd, returns false if the service is not run by systemd with notify type
+func SystemdNotify(state string) (bool, error) {
+	socketAddr := os.Getenv("NOTIFY_SOCKET")
+	if len(socketAddr) == 0 {
+		return false, nil
+	}
+
+	// abstract sockets start with @, handled by net package
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{
+		Name: socketAddr,
+		Net:  "unixgram",
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to systemd notify socket %s - %v", socketAddr, err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return false, fmt.Errorf("failed to notify systemd - %v", err)
+	}
+
+	return true, nil
+}
+
+// SystemdNotifyStatus sends a status text to systemd, shown in systemctl status
+func SystemdNotifyStatus(status string) (bool, error) {
+	// status is a single line
+	status = strings.ReplaceAll(status, "\n", " ")
+	return SystemdNotify(fmt.Sprintf("STATUS=%s", status))
+}
+
+// GetSystemdWatchdogTimeout returns watchdog timeout set by WatchdogSec, 0 if watchdog is disabled
+func GetSystemdWatchdogTimeout() (time.Duration, error) {
+	usecString := os.Getenv("WATCHDOG_USEC")
+	if len(usecString) == 0 {
+		return 0, nil
+	}
+
+	pidString := os.Getenv("WATCHDOG_PID")
+	if len(pidString) > 0 {
+		pid, err := strconv.Atoi(pidString)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse WATCHDOG_PID %s - %v", pidString, err)
+		}
+
+		if pid != os.Getpid() {
+			// watchdog is for another process
+			return 0, nil
+		}
+	}
+
+	usec, err := strconv.ParseInt(usecString, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse WATCHDOG_USEC %s - %v", usecString, err)
+	}
+
+	if usec <= 0 {
+		return 0, fmt.Errorf("WATCHDOG_USEC %s must be positive", usecString)
+	}
+
+	return time.Duration(usec) * time.Microsecond, nil
+}
+
+// GetSystemdListeners returns listeners passed by systemd socket activation, keyed by FileDescriptorName
+// systemd names them after the socket unit if FileDescriptorName is not given
+func GetSystemdListeners() (map[string]net.Listener, error) {
+	listeners := map[string]net.Listener{}
+
+	pidString := os.Getenv("LISTEN_PID")
+	fdsString := os.Getenv("LISTEN_FDS")
+	if len(pidString) == 0 || len(fdsString) == 0 {
+		return listeners, nil
+	}
+
+	pid, err := strconv.Atoi(pidString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse LISTEN_PID %s - %v", pidString, err)
+	}
+
+	if pid != os.Getpid() {
+		// sockets are for another process
+		return listeners, nil
+	}
+
+	fds, err := strconv.Atoi(fdsString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse LISTEN_FDS %s - %v", fdsString, err)
+	}
+
+	names := []string{}
+	fdNamesString := os.Getenv("LISTEN_FDNAMES")
+	if len(fdNamesString) > 0 {
+		names = strings.Split(fdNamesString, ":")
+	}
+
+	// not to pass them to child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	for idx := 0; idx < fds; idx++ {
+		fd := systemdListenFDsStart + idx
+		syscall.CloseOnExec(fd)
+
+		name := ""
+		if idx < len(names) {
+			name = names[idx]
+		}
+
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		// listener has its own copy of the fd
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to use socket %s (fd %d) passed by systemd - %v", name, fd, err)
+		}
+
+		listeners[name] = listener
+	}
+
+	return listeners, nil
+}
@@ -4,10 +4,11 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"sync"
+	"syscall"
 
 	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
 	cmd_commons "github.com/cyverse/irods-rule-async-exec-cmd/server-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/server-cmd/subcmd"
 	"github.com/cyverse/irods-rule-async-exec-cmd/service"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -52,10 +53,7 @@ func processCommand(command *cobra.Command, args []string) error {
 }
 
 func main() {
-	log.SetFormatter(&log.TextFormatter{
-		TimestampFormat: "2006-01-02 15:04:05.000000",
-		FullTimestamp:   true,
-	})
+	log.SetFormatter(commons.NewLogFormatter(commons.LogFormatText, cmd_commons.LogTimestampFormat))
 
 	log.SetLevel(log.InfoLevel)
 
@@ -67,6 +65,10 @@ func main() {
 	// attach common flags
 	cmd_commons.SetCommonFlags(rootCmd)
 
+	// add sub commands
+	subcmd.AddConfigCommand(rootCmd)
+	subcmd.AddProcessCommands(rootCmd)
+
 	err := Execute()
 	if err != nil {
 		logger.Fatal(err)
@@ -95,6 +97,15 @@ func parentMain(command *cobra.Command, args []string) {
 		os.Exit(0)
 	}
 
+	// fail before forking, the child process can only report it in the log
+	pid, locked, err := service.GetInstanceLockHolder(config.GetLockFilePath())
+	if err != nil {
+		logger.WithError(err).Warn("failed to check if another instance is running")
+	} else if locked {
+		logger.Errorf("another instance of iRODS Rule Async Exec Cmd Service (pid %d) is running with data root dir %s", pid, config.DataRootPath)
+		os.Exit(1)
+	}
+
 	if !config.Foreground {
 		// background
 		childStdin, childStdout, err := cmd_commons.RunChildProcess(os.Args[0])
@@ -192,6 +203,15 @@ func run(config *commons.ServerConfig, isChildProcess bool) error {
 		return err
 	}
 
+	if config.Systemd {
+		err = setSystemdListeners(svc)
+		if err != nil {
+			logger.WithError(err).Error("failed to use sockets passed by systemd")
+			svc.Release()
+			return err
+		}
+	}
+
 	err = svc.Start()
 	if err != nil {
 		logger.WithError(err).Error("failed to start the service")
@@ -208,27 +228,81 @@ func run(config *commons.ServerConfig, isChildProcess bool) error {
 		}
 	}
 
-	defer svc.Stop()
-	defer svc.Release()
+	// stop first, turn-ins being processed must finish before clients and turn-ins claimed are released
+	defer func() {
+		svc.Stop()
+		svc.Release()
+	}()
+
+	if config.Systemd {
+		// the service is started, systemd starts units depending on this
+		notifySystemd(cmd_commons.SystemdNotifyReady)
+
+		watchdogStopChan := make(chan bool)
+		go runSystemdWatchdog(svc, watchdogStopChan)
+
+		defer func() {
+			close(watchdogStopChan)
+			notifySystemd(cmd_commons.SystemdNotifyStopping)
+		}()
+	}
 
 	// wait
-	waitForCtrlC()
+	waitForTermination(svc, config)
 
 	return nil
 }
 
-func waitForCtrlC() {
-	var endWaiter sync.WaitGroup
+// waitForTermination waits until interrupted, or the service drained turn-ins
+// reloads configuration on SIGHUP
+func waitForTermination(svc *service.AsyncExecCmdService, config *commons.ServerConfig) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "waitForTermination",
+	})
 
-	endWaiter.Add(1)
 	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signalChannel)
+
+	for {
+		select {
+		case sig := <-signalChannel:
+			if sig == syscall.SIGHUP {
+				logger.Info("received SIGHUP, reloading configuration")
+				if config.Systemd {
+					notifySystemd(cmd_commons.SystemdNotifyReloading)
+				}
+
+				err := reloadConfig(svc, config.ConfigFilePath)
+				if err != nil {
+					logger.WithError(err).Error("failed to reload configuration")
+				}
+
+				if config.Systemd {
+					notifySystemd(cmd_commons.SystemdNotifyReady)
+				}
+				continue
+			}
+
+			logger.Infof("received %s, stopping", sig.String())
+			return
+		case <-svc.GetDrainedChan():
+			return
+		}
+	}
+}
 
-	signal.Notify(signalChannel, os.Interrupt)
+// reloadConfig reads the config file again and applies it to the service
+func reloadConfig(svc *service.AsyncExecCmdService, configFilePath string) error {
+	if len(configFilePath) == 0 {
+		return fmt.Errorf("config file path is not known")
+	}
 
-	go func() {
-		<-signalChannel
-		endWaiter.Done()
-	}()
+	config, err := cmd_commons.ReadConfigFile(configFilePath)
+	if err != nil {
+		return err
+	}
 
-	endWaiter.Wait()
+	return svc.Reload(config)
 }
@@ -0,0 +1,125 @@
+package subcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	cmd_commons "github.com/cyverse/irods-rule-async-exec-cmd/server-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/service"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect configuration",
+	Long:  "Inspect configuration of iRODS Rule Async Exec Service without running the service.",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate configuration and test connections",
+	Long: `This validates the configuration, then tests connections to AMQP, iRODS and BisQue configured,
+	and checks permissions of the turn-in dir. Each check is reported. Exits with an error if any check fails.`,
+	RunE:          processConfigValidateCommand,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var configDumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Print effective configuration",
+	Long:  "This prints the effective configuration with defaults applied and secrets redacted.",
+	RunE:  processConfigDumpCommand,
+}
+
+func AddConfigCommand(rootCmd *cobra.Command) {
+	for _, command := range []*cobra.Command{configValidateCmd, configDumpCmd} {
+		command.Flags().StringP("config", "c", commons.ConfigFilePathDefault, "Set config file (yaml)")
+		configCmd.AddCommand(command)
+	}
+
+	configValidateCmd.Flags().StringP("output", "o", "text", "Set output format (text, json)")
+	configValidateCmd.Flags().Duration("timeout", service.ConfigCheckTimeoutDefault, "Set timeout of each connectivity check")
+
+	rootCmd.AddCommand(configCmd)
+}
+
+// readConfig reads the config file given via command-line flag
+func readConfig(command *cobra.Command) (*commons.ServerConfig, error) {
+	configPath := command.Flags().Lookup("config").Value.String()
+	config, err := cmd_commons.ReadConfigFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s - %v", configPath, err)
+	}
+
+	return config, nil
+}
+
+func processConfigValidateCommand(command *cobra.Command, args []string) error {
+	config, err := readConfig(command)
+	if err != nil {
+		return err
+	}
+
+	output := strings.ToLower(command.Flags().Lookup("output").Value.String())
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unknown output format - %s", output)
+	}
+
+	timeout, err := time.ParseDuration(command.Flags().Lookup("timeout").Value.String())
+	if err != nil {
+		return fmt.Errorf("failed to parse timeout - %v", err)
+	}
+
+	results := service.CheckConfig(config, timeout)
+
+	failed := 0
+	for _, result := range results {
+		if !result.OK {
+			failed++
+		}
+	}
+
+	if output == "json" {
+		bytes, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+	} else {
+		for _, result := range results {
+			state := "OK"
+			if result.Skipped {
+				state = "SKIP"
+			} else if !result.OK {
+				state = "FAIL"
+			}
+			fmt.Printf("[%-4s] %s: %s\n", state, result.Name, result.Message)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+
+	return nil
+}
+
+func processConfigDumpCommand(command *cobra.Command, args []string) error {
+	config, err := readConfig(command)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := yaml.Marshal(config.Redacted())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(strings.TrimRight(string(bytes), "\n"))
+	return nil
+}
@@ -0,0 +1,145 @@
+package subcmd
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/service"
+	"github.com/spf13/cobra"
+)
+
+const (
+	StopTimeoutDefault  time.Duration = 1 * time.Minute
+	StopPollingInterval time.Duration = 200 * time.Millisecond
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show if the service is running",
+	Long: `This shows if a service is running with the data root dir configured, with its pid.
+	Exits with an error if no service is running.`,
+	RunE:          processStatusCommand,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var stopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the running service",
+	Long: `This sends SIGTERM to the service running with the data root dir configured,
+	then waits until it stops. Exits with an error if it does not stop in time.`,
+	RunE:          processStopCommand,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func AddProcessCommands(rootCmd *cobra.Command) {
+	for _, command := range []*cobra.Command{statusCmd, stopCmd} {
+		command.Flags().StringP("config", "c", commons.ConfigFilePathDefault, "Set config file (yaml)")
+		rootCmd.AddCommand(command)
+	}
+
+	stopCmd.Flags().Duration("timeout", StopTimeoutDefault, "Set time to wait for the service stopped, 0 to not wait")
+}
+
+// getRunningServicePID returns pid of the running service, 0 if no service is running
+func getRunningServicePID(config *commons.ServerConfig) (int, error) {
+	pid, locked, err := service.GetInstanceLockHolder(config.GetLockFilePath())
+	if err != nil {
+		return 0, err
+	}
+
+	if !locked {
+		return 0, nil
+	}
+
+	if pid == 0 {
+		// lock file is being written, use the PID file
+		pid, err = service.ReadPIDFile(config.GetPIDFilePath())
+		if err != nil {
+			return 0, fmt.Errorf("service is running, but failed to find its pid - %v", err)
+		}
+	}
+
+	return pid, nil
+}
+
+func processStatusCommand(command *cobra.Command, args []string) error {
+	config, err := readConfig(command)
+	if err != nil {
+		return err
+	}
+
+	pid, err := getRunningServicePID(config)
+	if err != nil {
+		return err
+	}
+
+	if pid == 0 {
+		_, pidErr := service.ReadPIDFile(config.GetPIDFilePath())
+		if pidErr == nil {
+			return fmt.Errorf("service is not running, PID file %s is stale", config.GetPIDFilePath())
+		}
+		return fmt.Errorf("service is not running")
+	}
+
+	fmt.Printf("service is running (pid %d)\n", pid)
+	return nil
+}
+
+func processStopCommand(command *cobra.Command, args []string) error {
+	config, err := readConfig(command)
+	if err != nil {
+		return err
+	}
+
+	timeout, err := time.ParseDuration(command.Flags().Lookup("timeout").Value.String())
+	if err != nil {
+		return fmt.Errorf("failed to parse timeout - %v", err)
+	}
+
+	pid, err := getRunningServicePID(config)
+	if err != nil {
+		return err
+	}
+
+	if pid == 0 {
+		return fmt.Errorf("service is not running")
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("failed to find service process %d - %v", pid, err)
+	}
+
+	err = process.Signal(syscall.SIGTERM)
+	if err != nil {
+		return fmt.Errorf("failed to send SIGTERM to service process %d - %v", pid, err)
+	}
+
+	if timeout == 0 {
+		fmt.Printf("sent SIGTERM to service (pid %d)\n", pid)
+		return nil
+	}
+
+	// the lock is released when the service exits
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		_, locked, err := service.GetInstanceLockHolder(config.GetLockFilePath())
+		if err != nil {
+			return err
+		}
+
+		if !locked {
+			fmt.Printf("service (pid %d) is stopped\n", pid)
+			return nil
+		}
+
+		time.Sleep(StopPollingInterval)
+	}
+
+	return fmt.Errorf("service (pid %d) did not stop in %s", pid, timeout.String())
+}
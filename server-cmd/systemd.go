@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	cmd_commons "github.com/cyverse/irods-rule-async-exec-cmd/server-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/service"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// SystemdStatusInterval is the interval to update status text if watchdog is disabled
+	SystemdStatusInterval time.Duration = 30 * time.Second
+)
+
+// setSystemdListeners lets the service use sockets passed by systemd socket activation
+func setSystemdListeners(svc *service.AsyncExecCmdService) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "setSystemdListeners",
+	})
+
+	listeners, err := cmd_commons.GetSystemdListeners()
+	if err != nil {
+		return err
+	}
+
+	if len(listeners) == 0 {
+		return nil
+	}
+
+	if listener, ok := listeners[cmd_commons.SystemdControlSocketName]; ok {
+		logger.Info("using control socket passed by systemd")
+		svc.SetControlListener(listener)
+		delete(listeners, cmd_commons.SystemdControlSocketName)
+	} else if len(listeners) == 1 {
+		// only one socket is given without the name
+		for name, listener := range listeners {
+			logger.Infof("using socket %s passed by systemd as control socket", name)
+			svc.SetControlListener(listener)
+			delete(listeners, name)
+		}
+	}
+
+	for name, listener := range listeners {
+		logger.Warnf("ignoring unknown socket %s passed by systemd", name)
+		listener.Close()
+	}
+
+	return nil
+}
+
+// notifySystemd sends a state to systemd, errors are logged
+func notifySystemd(state string) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "notifySystemd",
+	})
+
+	_, err := cmd_commons.SystemdNotify(state)
+	if err != nil {
+		logger.WithError(err).Warnf("failed to notify systemd of %s", state)
+	}
+}
+
+// runSystemdWatchdog pings systemd watchdog while the scrape loop of the service is alive, and updates status text
+// returns when stopChan is closed
+func runSystemdWatchdog(svc *service.AsyncExecCmdService, stopChan <-chan bool) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "runSystemdWatchdog",
+	})
+
+	watchdogTimeout, err := cmd_commons.GetSystemdWatchdogTimeout()
+	if err != nil {
+		logger.WithError(err).Warn("failed to get systemd watchdog timeout, watchdog is disabled")
+		watchdogTimeout = 0
+	}
+
+	interval := SystemdStatusInterval
+	if watchdogTimeout > 0 {
+		// ping twice in timeout, as recommended by systemd
+		interval = watchdogTimeout / 2
+		logger.Infof("pinging systemd watchdog every %s", interval.String())
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := cmd_commons.SystemdNotifyStatus(getSystemdStatus(svc))
+		if err != nil {
+			logger.WithError(err).Warn("failed to update systemd status")
+		}
+
+		if watchdogTimeout > 0 {
+			lastAliveTime := svc.GetLastAliveTime()
+			if time.Since(lastAliveTime) < watchdogTimeout {
+				notifySystemd(cmd_commons.SystemdNotifyWatchdog)
+			} else {
+				// systemd restarts the service on watchdog timeout
+				logger.Errorf("scrape loop is not alive since %s, skip pinging systemd watchdog", lastAliveTime.String())
+			}
+		}
+
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// getSystemdStatus returns a status text of the service, shown in systemctl status
+func getSystemdStatus(svc *service.AsyncExecCmdService) string {
+	status := svc.GetStatus()
+
+	backlog := 0
+	for _, priorityBacklog := range status.Backlog {
+		backlog += priorityBacklog.Count
+	}
+
+	state := "Running"
+	if status.Draining {
+		state = "Draining"
+	}
+
+	texts := []string{
+		fmt.Sprintf("%s, %d turn-ins waiting", state, backlog),
+	}
+
+	pausedLanes := []string{}
+	for _, lane := range status.Lanes {
+		if lane.Paused {
+			pausedLanes = append(pausedLanes, lane.Name)
+		}
+	}
+
+	if len(pausedLanes) > 0 {
+		texts = append(texts, fmt.Sprintf("paused %s", strings.Join(pausedLanes, ", ")))
+	}
+
+	disconnected := []string{}
+	for _, component := range status.Components {
+		if component.Configured && !component.Connected {
+			disconnected = append(disconnected, component.Name)
+		}
+	}
+
+	if len(disconnected) > 0 {
+		texts = append(texts, fmt.Sprintf("disconnected from %s", strings.Join(disconnected, ", ")))
+	}
+
+	return strings.Join(texts, "; ")
+}
@@ -1,38 +1,40 @@
 package service
 
 import (
-	"fmt"
-	"os"
+	"context"
+	"encoding/json"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
 	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
-	"github.com/rs/xid"
 	log "github.com/sirupsen/logrus"
 	amqp_mod "github.com/streadway/amqp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	AMQPConsumerQueueName string        = "irods_rule_async_exec_cmd"
-	AMQPConsumeInterval   time.Duration = 1 * time.Second
+	// AMQPRequestIDHeader is a message header having the request ID of a send_message turn-in
+	AMQPRequestIDHeader string = "request_id"
+	// AMQPContentTypeDefault is a content type of messages if not given by requests or defaults
+	AMQPContentTypeDefault string = "text/plain"
 )
 
-type AmqpEventHandler func(msg amqp_mod.Delivery)
-
+// AMQP publishes send_message requests to a destination, iRODS events are consumed by AmqpConsumer
 type AMQP struct {
 	service              *AsyncExecCmdService
+	name                 string // name of the destination
 	config               *commons.AmqpConfig
 	connection           *amqp_mod.Connection
 	channel              *amqp_mod.Channel
-	queue                *amqp_mod.Queue
 	lastConnectTrialTime time.Time
 	connectionLock       sync.Mutex
-	eventHandler         AmqpEventHandler
 }
 
-// CreateAmqp creates a AMQP service object and connects to AMQP
-func CreateAmqp(service *AsyncExecCmdService, config *commons.AmqpConfig, hander AmqpEventHandler) (*AMQP, error) {
+// CreateAmqp creates a AMQP service object for the default destination and connects to AMQP
+func CreateAmqp(service *AsyncExecCmdService, config *commons.AmqpConfig) (*AMQP, error) {
 	logger := log.WithFields(log.Fields{
 		"package":  "service",
 		"function": "CreateAmqp",
@@ -43,10 +45,38 @@ func CreateAmqp(service *AsyncExecCmdService, config *commons.AmqpConfig, hander
 	// lazy connect
 	amqp := &AMQP{
 		service:              service,
+		name:                 commons.AmqpDestinationDefault,
+		config:               config,
+		lastConnectTrialTime: time.Time{},
+		connectionLock:       sync.Mutex{},
+	}
+
+	err := amqp.ensureConnected()
+	if err != nil {
+		logger.WithError(err).Warn("will retry again")
+		// ignore error
+	}
+
+	return amqp, nil
+}
+
+// CreateAmqpDestination creates a AMQP service object for a destination only publishing messages and connects to AMQP
+func CreateAmqpDestination(service *AsyncExecCmdService, name string, config *commons.AmqpConfig) (*AMQP, error) {
+	logger := log.WithFields(log.Fields{
+		"package":     "service",
+		"function":    "CreateAmqpDestination",
+		"destination": name,
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	// lazy connect
+	amqp := &AMQP{
+		service:              service,
+		name:                 name,
 		config:               config,
 		lastConnectTrialTime: time.Time{},
 		connectionLock:       sync.Mutex{},
-		eventHandler:         hander,
 	}
 
 	err := amqp.ensureConnected()
@@ -58,6 +88,11 @@ func CreateAmqp(service *AsyncExecCmdService, config *commons.AmqpConfig, hander
 	return amqp, nil
 }
 
+// GetName returns name of the destination
+func (amqp *AMQP) GetName() string {
+	return amqp.name
+}
+
 func (amqp *AMQP) ensureConnected() error {
 	logger := log.WithFields(log.Fields{
 		"package":  "service",
@@ -75,11 +110,10 @@ func (amqp *AMQP) ensureConnected() error {
 			// clear
 			amqp.connection = nil
 			amqp.channel = nil
-			amqp.queue = nil
 		}
 	}
 
-	if amqp.connection == nil || amqp.channel == nil || amqp.queue == nil {
+	if amqp.connection == nil || amqp.channel == nil {
 		// disconnected - try to connect
 		if time.Now().After(amqp.lastConnectTrialTime.Add(commons.ReconnectInterval)) {
 			// passed reconnect interval
@@ -102,75 +136,99 @@ func (amqp *AMQP) connect() error {
 
 	defer commons.StackTraceFromPanic(logger)
 
-	logger.Infof("connecting to AMQP %s", amqp.config.URL)
+	logger.Infof("connecting to AMQP %s for destination %s", commons.RedactURL(amqp.config.URL), amqp.name)
 
 	amqp.lastConnectTrialTime = time.Now()
 
 	amqp.connection = nil
 	amqp.channel = nil
-	amqp.queue = nil
 
 	connection, err := amqp_mod.Dial(amqp.config.URL)
 	if err != nil {
-		logger.WithError(err).Errorf("failed to connect to %s", amqp.config.URL)
-		return err
+		logger.WithError(err).Errorf("failed to connect to %s", commons.RedactURL(amqp.config.URL))
+		return NewServiceNotReadyErrorf("failed to connect to AMQP %s - %v", commons.RedactURL(amqp.config.URL), err)
 	}
 
 	channel, err := connection.Channel()
 	if err != nil {
 		logger.WithError(err).Error("failed to open a channel")
-		return err
+		connection.Close()
+		return NewServiceNotReadyErrorf("failed to open an AMQP channel - %v", err)
 	}
 
-	quename := amqp.getQueueName()
-	logger.Infof("Declaring a queue %s", quename)
+	amqp.connection = connection
+	amqp.channel = channel
 
-	queue, err := channel.QueueDeclare(quename, false, true, true, false, amqp_mod.Table{})
-	if err != nil {
-		logger.WithError(err).Errorf("failed to declare a queue")
-		return err
+	logger.Infof("connected to AMQP %s for destination %s", commons.RedactURL(amqp.config.URL), amqp.name)
+	return nil
+}
+
+// IsConnected returns true if connected to AMQP
+func (amqp *AMQP) IsConnected() bool {
+	amqp.connectionLock.Lock()
+	defer amqp.connectionLock.Unlock()
+
+	return amqp.connection != nil && !amqp.connection.IsClosed() && amqp.channel != nil
+}
+
+// Reconfigure replaces config and reconnects, waiting for messages being published
+func (amqp *AMQP) Reconfigure(config *commons.AmqpConfig) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AMQP",
+		"function": "Reconfigure",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Infof("reconfiguring AMQP %s", commons.RedactURL(config.URL))
+
+	amqp.connectionLock.Lock()
+	defer amqp.connectionLock.Unlock()
+
+	amqp.closeConnection()
+	amqp.config = config
+
+	return amqp.connect()
+}
+
+// SetConfig replaces config without reconnecting, URL and exchange must not be changed
+func (amqp *AMQP) SetConfig(config *commons.AmqpConfig) {
+	amqp.connectionLock.Lock()
+	defer amqp.connectionLock.Unlock()
+
+	amqp.config = config
+}
+
+// closeConnection closes the connection, connectionLock must be held
+func (amqp *AMQP) closeConnection() {
+	if amqp.channel != nil {
+		amqp.channel.Close()
 	}
 
-	// bind queue to listen fs events
-	err = channel.QueueBind(queue.Name, "#", amqp.config.Exchange, false, amqp_mod.Table{})
-	if err != nil {
-		logger.WithError(err).Errorf("failed to bind the queue")
-		return err
+	if amqp.connection != nil && !amqp.connection.IsClosed() {
+		amqp.connection.Close()
 	}
+}
 
-	amqp.connection = connection
-	amqp.channel = channel
-	amqp.queue = &queue
-
-	logger.Infof("connected to AMQP %s", amqp.config.URL)
-
-	go func() {
-		for amqp.connection != nil {
-			amqp.connectionLock.Lock()
-
-			if amqp.connection != nil && !amqp.connection.IsClosed() {
-				amqp.connectionLock.Unlock()
-
-				msgs, err := amqp.channel.Consume(amqp.queue.Name, "", true, false, false, false, nil)
-				if err != nil {
-					logger.WithError(err).Error("failed to consume a message")
-					return
-				}
-
-				for msg := range msgs {
-					logger.Debugf("consumed a message %s from AMQP", msg.RoutingKey)
-					// pass to handlers registered
-					if amqp.eventHandler != nil {
-						amqp.eventHandler(msg)
-					}
-				}
-			} else {
-				amqp.connectionLock.Unlock()
-			}
-		}
-	}()
+// Reconnect disconnects from AMQP and connects again immediately, ignoring reconnect interval
+func (amqp *AMQP) Reconnect() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AMQP",
+		"function": "Reconnect",
+	})
 
-	return nil
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Infof("reconnecting to AMQP %s", commons.RedactURL(amqp.config.URL))
+
+	amqp.connectionLock.Lock()
+	defer amqp.connectionLock.Unlock()
+
+	amqp.closeConnection()
+
+	return amqp.connect()
 }
 
 // Release releases all resources, disconnecting from AMQP
@@ -183,19 +241,14 @@ func (amqp *AMQP) Release() {
 
 	defer commons.StackTraceFromPanic(logger)
 
-	logger.Infof("trying to disconnect from %s", amqp.config.URL)
-
-	// this should be called to break Consume
-	if amqp.channel != nil {
-		amqp.channel.Close()
-		amqp.channel = nil
-	}
+	logger.Infof("trying to disconnect from %s", commons.RedactURL(amqp.config.URL))
 
 	amqp.connectionLock.Lock()
 	defer amqp.connectionLock.Unlock()
 
-	if amqp.queue != nil {
-		amqp.queue = nil
+	if amqp.channel != nil {
+		amqp.channel.Close()
+		amqp.channel = nil
 	}
 
 	if amqp.connection != nil {
@@ -204,23 +257,24 @@ func (amqp *AMQP) Release() {
 		}
 		amqp.connection = nil
 	}
-
-	amqp.eventHandler = nil
 }
 
 // ProcessItem processes a turn-in send_message request, publishing a AMQP message
-func (amqp *AMQP) ProcessItem(item turnin.TurnInItem) error {
+// the message is published to the exchange given, or the exchange of the destination if empty
+func (amqp *AMQP) ProcessItem(ctx context.Context, item turnin.TurnInItem, exchange string) error {
 	logger := log.WithFields(log.Fields{
-		"package":  "service",
-		"struct":   "AMQP",
-		"function": "ProcessItem",
+		"package":     "service",
+		"struct":      "AMQP",
+		"function":    "ProcessItem",
+		"request_id":  item.GetRequestID(),
+		"destination": amqp.name,
 	})
 
 	defer commons.StackTraceFromPanic(logger)
 
 	request, ok := item.(*turnin.SendMessageRequest)
 	if !ok {
-		err := fmt.Errorf("failed to convert item to SendMessageRequest")
+		err := NewValidationErrorf("failed to convert item to SendMessageRequest")
 		logger.Error(err)
 		return err
 	}
@@ -234,36 +288,115 @@ func (amqp *AMQP) ProcessItem(item turnin.TurnInItem) error {
 	amqp.connectionLock.Lock()
 	defer amqp.connectionLock.Unlock()
 
+	if amqp.channel == nil {
+		// disconnected by reconnect in the middle
+		err = NewServiceNotReadyErrorf("AMQP is disconnected. will retry")
+		logger.Error(err)
+		return err
+	}
+
 	logger.Debugf("trying to publish an AMQP message with a subject %s", request.Key)
 
 	if len(request.Key) == 0 {
-		err := fmt.Errorf("failed to send an AMQP message due to an empty key")
+		err := NewValidationErrorf("failed to send an AMQP message due to an empty key")
 		logger.Error(err)
 		return err
 	}
 
-	msg := amqp_mod.Publishing{
-		DeliveryMode: amqp_mod.Persistent,
-		Timestamp:    time.Now(),
-		ContentType:  "text/plain",
-		Body:         []byte(request.Body),
+	if len(exchange) == 0 {
+		exchange = amqp.config.Exchange
 	}
 
-	err = amqp.channel.Publish(amqp.config.Exchange, request.Key, false, false, msg)
+	ctx, span := amqp.service.startSpan(ctx, "AMQP publish", trace.SpanKindProducer,
+		semconv.MessagingSystemKey.String("rabbitmq"),
+		semconv.MessagingDestinationKey.String(exchange),
+		semconv.MessagingRabbitmqRoutingKeyKey.String(request.Key),
+	)
+	defer span.End()
+
+	msg, err := newAmqpPublishing(amqp.config, request)
 	if err != nil {
-		logger.WithError(err).Errorf("failed to send an AMQP message with a subject %s", request.Key)
+		commons.SetSpanError(span, err)
+		logger.Error(err)
 		return err
 	}
 
-	logger.Infof("published an AMQP message with a subject %s", request.Key)
+	// set last, not to be overridden by headers given
+	msg.Headers[AMQPRequestIDHeader] = request.RequestID
+	injectTraceContext(ctx, amqpHeaderCarrier(msg.Headers))
+
+	err = amqp.channel.Publish(exchange, request.Key, false, false, msg)
+	if err != nil {
+		commons.SetSpanError(span, err)
+		logger.WithError(err).Errorf("failed to send an AMQP message with a subject %s to exchange %s", request.Key, exchange)
+
+		// the channel or the connection is closed, connect again at the next try
+		amqp.closeConnection()
+		amqp.connection = nil
+		amqp.channel = nil
+		return NewServiceNotReadyErrorf("failed to send an AMQP message with a subject %s to exchange %s, will retry - %v", request.Key, exchange, err)
+	}
+
+	logger.Infof("published an AMQP message with a subject %s to exchange %s", request.Key, exchange)
 	return nil
 }
 
-func (amqp *AMQP) getQueueName() string {
-	hostname, err := os.Hostname()
+// newAmqpPublishing creates a message of the request, filling properties not given with defaults for the routing key
+func newAmqpPublishing(config *commons.AmqpConfig, request *turnin.SendMessageRequest) (amqp_mod.Publishing, error) {
+	defaults := config.GetMessageDefaults(request.Key)
+	if defaults == nil {
+		defaults = &commons.AmqpMessageDefaultsConfig{}
+	}
+
+	contentType := request.ContentType
+	if len(contentType) == 0 {
+		contentType = defaults.ContentType
+	}
+
+	if len(contentType) == 0 {
+		contentType = AMQPContentTypeDefault
+	}
+
+	if turnin.IsJSONContentType(contentType) && !json.Valid([]byte(request.Body)) {
+		return amqp_mod.Publishing{}, NewValidationErrorf("failed to send an AMQP message with a subject %s, body is not a valid JSON for content type %s", request.Key, contentType)
+	}
+
+	headers := amqp_mod.Table{}
+	for key, val := range defaults.Headers {
+		headers[key] = val
+	}
+
+	for key, val := range request.Headers {
+		headers[key] = val
+	}
+
+	expiration, err := request.GetExpiration()
 	if err != nil {
-		hostname = fmt.Sprintf("autocreated.%s", xid.New().String())
+		return amqp_mod.Publishing{}, NewValidationErrorf("failed to send an AMQP message with a subject %s - %v", request.Key, err)
+	}
+
+	if expiration == 0 {
+		expiration = defaults.Expiration
+	}
+
+	expirationString := ""
+	if expiration > 0 {
+		// AMQP expiration is in milliseconds
+		expirationMillis := expiration.Milliseconds()
+		if expirationMillis == 0 {
+			expirationMillis = 1
+		}
+		expirationString = strconv.FormatInt(expirationMillis, 10)
 	}
 
-	return fmt.Sprintf("%s.%s", AMQPConsumerQueueName, hostname)
+	return amqp_mod.Publishing{
+		Headers:       headers,
+		DeliveryMode:  amqp_mod.Persistent,
+		Timestamp:     time.Now(),
+		ContentType:   contentType,
+		CorrelationId: request.CorrelationID,
+		MessageId:     request.MessageID,
+		Expiration:    expirationString,
+		Body:          []byte(request.Body),
+	}, nil
 }
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
+	amqp_mod "github.com/streadway/amqp"
+)
+
+const (
+	AMQPConsumerQueueName string = "irods_rule_async_exec_cmd"
+	// EventConsumerBackoffMin is the first wait before reconnecting consumers of iRODS events
+	EventConsumerBackoffMin time.Duration = 1 * time.Second
+	// EventConsumerBackoffMax is the longest wait before reconnecting consumers of iRODS events
+	EventConsumerBackoffMax time.Duration = 1 * time.Minute
+)
+
+type AmqpEventHandler func(msg amqp_mod.Delivery)
+
+// AmqpConsumer consumes iRODS events from AMQP with its own connection
+// it reconnects with backoff when the connection or the channel is closed, independent from publishing
+type AmqpConsumer struct {
+	service      *AsyncExecCmdService
+	config       *commons.AmqpConfig
+	eventHandler AmqpEventHandler
+
+	consuming        bool
+	consumeStartTime time.Time
+	lastDeliveryTime time.Time
+	lastError        error
+	stateLock        sync.Mutex
+	reconnectChan    chan bool
+	terminateChan    chan bool
+	terminateOnce    sync.Once
+	waitGroup        sync.WaitGroup
+}
+
+// CreateAmqpConsumer creates a AMQP consumer, call Start to consume
+func CreateAmqpConsumer(service *AsyncExecCmdService, config *commons.AmqpConfig, handler AmqpEventHandler) *AmqpConsumer {
+	return &AmqpConsumer{
+		service:       service,
+		config:        config,
+		eventHandler:  handler,
+		reconnectChan: make(chan bool, 1),
+		terminateChan: make(chan bool),
+	}
+}
+
+// Start starts consuming in background, connecting to AMQP and reconnecting when disconnected
+func (consumer *AmqpConsumer) Start() {
+	consumer.waitGroup.Add(1)
+	go func() {
+		defer consumer.waitGroup.Done()
+		consumer.run()
+	}()
+}
+
+func (consumer *AmqpConsumer) run() {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AmqpConsumer",
+		"function": "run",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	backoff := EventConsumerBackoffMin
+	for {
+		consumed, err := consumer.consumeOnce()
+		consumer.setConsuming(false, err)
+
+		if consumed {
+			// connected successfully, start over
+			backoff = EventConsumerBackoffMin
+		}
+
+		select {
+		case <-consumer.terminateChan:
+			return
+		case <-consumer.reconnectChan:
+			// reconnect immediately
+			backoff = EventConsumerBackoffMin
+			continue
+		default:
+		}
+
+		if err != nil {
+			logger.WithError(err).Warnf("AMQP consumer is disconnected, will reconnect after %s", backoff.String())
+		}
+
+		select {
+		case <-consumer.terminateChan:
+			return
+		case <-consumer.reconnectChan:
+			backoff = EventConsumerBackoffMin
+		case <-time.After(backoff):
+			backoff *= 2
+			if backoff > EventConsumerBackoffMax {
+				backoff = EventConsumerBackoffMax
+			}
+		}
+	}
+}
+
+// consumeOnce connects to AMQP and consumes events until the connection or the channel is closed
+// returns true if it started consuming, with an error that stopped consuming
+// returns nil error if asked to terminate or reconnect
+func (consumer *AmqpConsumer) consumeOnce() (bool, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AmqpConsumer",
+		"function": "consumeOnce",
+	})
+
+	config := consumer.getConfig()
+
+	logger.Infof("connecting AMQP consumer to %s", commons.RedactURL(config.URL))
+
+	connection, err := amqp_mod.Dial(config.URL)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to %s - %v", commons.RedactURL(config.URL), err)
+	}
+	defer connection.Close()
+
+	connectionCloseChan := connection.NotifyClose(make(chan *amqp_mod.Error, 1))
+
+	channel, err := connection.Channel()
+	if err != nil {
+		return false, fmt.Errorf("failed to open a channel - %v", err)
+	}
+	defer channel.Close()
+
+	channelCloseChan := channel.NotifyClose(make(chan *amqp_mod.Error, 1))
+
+	queueName := getAmqpConsumerQueueName()
+	logger.Infof("Declaring a queue %s", queueName)
+
+	queue, err := channel.QueueDeclare(queueName, false, true, true, false, amqp_mod.Table{})
+	if err != nil {
+		return false, fmt.Errorf("failed to declare a queue %s - %v", queueName, err)
+	}
+
+	// bind queue to listen fs events
+	err = channel.QueueBind(queue.Name, "#", config.Exchange, false, amqp_mod.Table{})
+	if err != nil {
+		return false, fmt.Errorf("failed to bind the queue %s to exchange %s - %v", queue.Name, config.Exchange, err)
+	}
+
+	msgs, err := channel.Consume(queue.Name, "", true, false, false, false, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume the queue %s - %v", queue.Name, err)
+	}
+
+	consumer.setConsuming(true, nil)
+	logger.Infof("AMQP consumer is connected to %s, consuming %s", commons.RedactURL(config.URL), queue.Name)
+
+	for {
+		select {
+		case <-consumer.terminateChan:
+			return true, nil
+		case <-consumer.reconnectChan:
+			logger.Info("reconnecting AMQP consumer")
+			// let run loop reconnect immediately
+			consumer.reconnectChan <- true
+			return true, nil
+		case amqpErr := <-connectionCloseChan:
+			return true, fmt.Errorf("AMQP connection is closed - %v", amqpErr)
+		case amqpErr := <-channelCloseChan:
+			return true, fmt.Errorf("AMQP channel is closed - %v", amqpErr)
+		case msg, ok := <-msgs:
+			if !ok {
+				return true, fmt.Errorf("AMQP deliveries are closed")
+			}
+
+			consumer.setLastDeliveryTime(time.Now())
+
+			logger.Debugf("consumed a message %s from AMQP", msg.RoutingKey)
+			// pass to handlers registered
+			if consumer.eventHandler != nil {
+				consumer.eventHandler(msg)
+			}
+		}
+	}
+}
+
+func getAmqpConsumerQueueName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = fmt.Sprintf("autocreated.%s", xid.New().String())
+	}
+
+	return fmt.Sprintf("%s.%s", AMQPConsumerQueueName, hostname)
+}
+
+func (consumer *AmqpConsumer) getConfig() *commons.AmqpConfig {
+	consumer.stateLock.Lock()
+	defer consumer.stateLock.Unlock()
+
+	return consumer.config
+}
+
+func (consumer *AmqpConsumer) setConsuming(consuming bool, err error) {
+	consumer.stateLock.Lock()
+	defer consumer.stateLock.Unlock()
+
+	if consuming && !consumer.consuming {
+		consumer.consumeStartTime = time.Now()
+	}
+
+	consumer.consuming = consuming
+	consumer.lastError = err
+}
+
+func (consumer *AmqpConsumer) setLastDeliveryTime(t time.Time) {
+	consumer.stateLock.Lock()
+	defer consumer.stateLock.Unlock()
+
+	consumer.lastDeliveryTime = t
+}
+
+// IsConsuming returns true if the consumer is connected and consuming events
+func (consumer *AmqpConsumer) IsConsuming() bool {
+	consumer.stateLock.Lock()
+	defer consumer.stateLock.Unlock()
+
+	return consumer.consuming
+}
+
+// GetLastActivityTime returns the last time an event is delivered, or the consumer started consuming if later
+// zero time if the consumer is not consuming
+func (consumer *AmqpConsumer) GetLastActivityTime() time.Time {
+	consumer.stateLock.Lock()
+	defer consumer.stateLock.Unlock()
+
+	if !consumer.consuming {
+		return time.Time{}
+	}
+
+	if consumer.lastDeliveryTime.After(consumer.consumeStartTime) {
+		return consumer.lastDeliveryTime
+	}
+	return consumer.consumeStartTime
+}
+
+// GetLastError returns an error that disconnected the consumer last, nil if consuming
+func (consumer *AmqpConsumer) GetLastError() error {
+	consumer.stateLock.Lock()
+	defer consumer.stateLock.Unlock()
+
+	return consumer.lastError
+}
+
+// Reconfigure replaces config and reconnects
+func (consumer *AmqpConsumer) Reconfigure(config *commons.AmqpConfig) {
+	consumer.stateLock.Lock()
+	consumer.config = config
+	consumer.stateLock.Unlock()
+
+	consumer.Reconnect()
+}
+
+// Reconnect disconnects and connects again immediately, ignoring backoff
+func (consumer *AmqpConsumer) Reconnect() {
+	select {
+	case consumer.reconnectChan <- true:
+	default:
+		// reconnect is already requested
+	}
+}
+
+// Release stops consuming and disconnects from AMQP
+func (consumer *AmqpConsumer) Release() {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AmqpConsumer",
+		"function": "Release",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Info("stopping AMQP consumer")
+
+	consumer.terminateOnce.Do(func() {
+		close(consumer.terminateChan)
+	})
+
+	consumer.waitGroup.Wait()
+	consumer.eventHandler = nil
+}
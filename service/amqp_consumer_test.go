@@ -0,0 +1,431 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+	amqp_mod "github.com/streadway/amqp"
+)
+
+const (
+	fakeAmqpFrameMethod byte = 1
+	fakeAmqpFrameHeader byte = 2
+	fakeAmqpFrameBody   byte = 3
+	fakeAmqpFrameEnd    byte = 0xCE
+
+	fakeAmqpEventRoutingKey string = "data-object.add"
+)
+
+// fakeAmqpBroker is an AMQP 0-9-1 broker speaking just enough of the protocol for AMQP and AmqpConsumer
+// each consumer gets an event when it starts consuming
+type fakeAmqpBroker struct {
+	listener net.Listener
+
+	lock            sync.Mutex
+	consumerConns   []net.Conn
+	rejectConsumers bool
+
+	declares  chan time.Time // times queues are declared, consumers declare queues before consuming
+	consumes  chan time.Time // times consumers start consuming
+	publishes chan string    // routing keys of messages published
+}
+
+func newFakeAmqpBroker(t *testing.T) *fakeAmqpBroker {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker := &fakeAmqpBroker{
+		listener:  listener,
+		declares:  make(chan time.Time, 100),
+		consumes:  make(chan time.Time, 100),
+		publishes: make(chan string, 100),
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go broker.serve(conn)
+		}
+	}()
+
+	t.Cleanup(func() {
+		listener.Close()
+		broker.dropConsumers()
+	})
+
+	return broker
+}
+
+// getURL returns AMQP URL of the broker, credentials are not checked
+func (broker *fakeAmqpBroker) getURL() string {
+	return "amqp://guest:secret@" + broker.listener.Addr().String() + "/"
+}
+
+// setRejectConsumers makes the broker close connections declaring queues
+func (broker *fakeAmqpBroker) setRejectConsumers(reject bool) {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+
+	broker.rejectConsumers = reject
+}
+
+// dropConsumers closes connections of consumers
+func (broker *fakeAmqpBroker) dropConsumers() {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+
+	for _, conn := range broker.consumerConns {
+		conn.Close()
+	}
+	broker.consumerConns = nil
+}
+
+func (broker *fakeAmqpBroker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	protocolHeader := make([]byte, 8)
+	_, err := io.ReadFull(conn, protocolHeader)
+	if err != nil {
+		return
+	}
+
+	// connection.start
+	start := newFakeAmqpMethod(10, 10)
+	start.WriteByte(0)
+	start.WriteByte(9)
+	writeFakeAmqpLongString(start, "") // empty server properties table
+	writeFakeAmqpLongString(start, "PLAIN")
+	writeFakeAmqpLongString(start, "en_US")
+	if writeFakeAmqpFrame(conn, fakeAmqpFrameMethod, 0, start.Bytes()) != nil {
+		return
+	}
+
+	for {
+		frameType, channel, payload, err := readFakeAmqpFrame(conn)
+		if err != nil {
+			return
+		}
+
+		if frameType != fakeAmqpFrameMethod {
+			// heartbeats and contents of messages published
+			continue
+		}
+
+		reader := bytes.NewReader(payload)
+		classID := readFakeAmqpShort(reader)
+		methodID := readFakeAmqpShort(reader)
+
+		var reply *bytes.Buffer
+		switch {
+		case classID == 10 && methodID == 11:
+			// connection.start-ok -> connection.tune
+			reply = newFakeAmqpMethod(10, 30)
+			binary.Write(reply, binary.BigEndian, uint16(0))
+			binary.Write(reply, binary.BigEndian, uint32(131072))
+			binary.Write(reply, binary.BigEndian, uint16(0))
+		case classID == 10 && methodID == 31:
+			// connection.tune-ok
+		case classID == 10 && methodID == 40:
+			// connection.open -> connection.open-ok
+			reply = newFakeAmqpMethod(10, 41)
+			writeFakeAmqpShortString(reply, "")
+		case classID == 10 && methodID == 50:
+			// connection.close -> connection.close-ok
+			writeFakeAmqpFrame(conn, fakeAmqpFrameMethod, 0, newFakeAmqpMethod(10, 51).Bytes())
+			return
+		case classID == 20 && methodID == 10:
+			// channel.open -> channel.open-ok
+			reply = newFakeAmqpMethod(20, 11)
+			writeFakeAmqpLongString(reply, "")
+		case classID == 20 && methodID == 40:
+			// channel.close -> channel.close-ok
+			reply = newFakeAmqpMethod(20, 41)
+		case classID == 50 && methodID == 10:
+			// queue.declare -> queue.declare-ok
+			broker.lock.Lock()
+			reject := broker.rejectConsumers
+			broker.lock.Unlock()
+
+			// signal after deciding, so changes made on the signal apply to the next declare
+			broker.declares <- time.Now()
+
+			if reject {
+				return
+			}
+
+			readFakeAmqpShort(reader) // ticket
+			reply = newFakeAmqpMethod(50, 11)
+			writeFakeAmqpShortString(reply, readFakeAmqpShortString(reader))
+			binary.Write(reply, binary.BigEndian, uint32(0))
+			binary.Write(reply, binary.BigEndian, uint32(0))
+		case classID == 50 && methodID == 20:
+			// queue.bind -> queue.bind-ok
+			reply = newFakeAmqpMethod(50, 21)
+		case classID == 60 && methodID == 20:
+			// basic.consume -> basic.consume-ok, then an event
+			readFakeAmqpShort(reader) // ticket
+			readFakeAmqpShortString(reader)
+			consumerTag := readFakeAmqpShortString(reader)
+
+			consumeOK := newFakeAmqpMethod(60, 21)
+			writeFakeAmqpShortString(consumeOK, consumerTag)
+			if writeFakeAmqpFrame(conn, fakeAmqpFrameMethod, channel, consumeOK.Bytes()) != nil {
+				return
+			}
+
+			broker.lock.Lock()
+			broker.consumerConns = append(broker.consumerConns, conn)
+			broker.lock.Unlock()
+
+			broker.consumes <- time.Now()
+
+			if writeFakeAmqpDelivery(conn, channel, consumerTag, fakeAmqpEventRoutingKey, []byte(`{"path": "/zone/home/user/file"}`)) != nil {
+				return
+			}
+		case classID == 60 && methodID == 40:
+			// basic.publish, contents follow
+			readFakeAmqpShort(reader) // ticket
+			readFakeAmqpShortString(reader)
+			broker.publishes <- readFakeAmqpShortString(reader)
+		}
+
+		if reply != nil {
+			if writeFakeAmqpFrame(conn, fakeAmqpFrameMethod, channel, reply.Bytes()) != nil {
+				return
+			}
+		}
+	}
+}
+
+func newFakeAmqpMethod(classID uint16, methodID uint16) *bytes.Buffer {
+	buffer := &bytes.Buffer{}
+	binary.Write(buffer, binary.BigEndian, classID)
+	binary.Write(buffer, binary.BigEndian, methodID)
+	return buffer
+}
+
+func writeFakeAmqpShortString(buffer *bytes.Buffer, str string) {
+	buffer.WriteByte(byte(len(str)))
+	buffer.WriteString(str)
+}
+
+func writeFakeAmqpLongString(buffer *bytes.Buffer, str string) {
+	binary.Write(buffer, binary.BigEndian, uint32(len(str)))
+	buffer.WriteString(str)
+}
+
+func readFakeAmqpShort(reader *bytes.Reader) uint16 {
+	val := uint16(0)
+	binary.Read(reader, binary.BigEndian, &val)
+	return val
+}
+
+func readFakeAmqpShortString(reader *bytes.Reader) string {
+	size, err := reader.ReadByte()
+	if err != nil {
+		return ""
+	}
+
+	str := make([]byte, size)
+	io.ReadFull(reader, str)
+	return string(str)
+}
+
+func writeFakeAmqpFrame(conn net.Conn, frameType byte, channel uint16, payload []byte) error {
+	frame := &bytes.Buffer{}
+	frame.WriteByte(frameType)
+	binary.Write(frame, binary.BigEndian, channel)
+	binary.Write(frame, binary.BigEndian, uint32(len(payload)))
+	frame.Write(payload)
+	frame.WriteByte(fakeAmqpFrameEnd)
+
+	_, err := conn.Write(frame.Bytes())
+	return err
+}
+
+func readFakeAmqpFrame(conn net.Conn) (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	_, err := io.ReadFull(conn, header)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	_, err = io.ReadFull(conn, payload)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	return header[0], binary.BigEndian.Uint16(header[1:3]), payload[:len(payload)-1], nil
+}
+
+// writeFakeAmqpDelivery writes basic.deliver, a content header without properties and a body
+func writeFakeAmqpDelivery(conn net.Conn, channel uint16, consumerTag string, routingKey string, body []byte) error {
+	deliver := newFakeAmqpMethod(60, 60)
+	writeFakeAmqpShortString(deliver, consumerTag)
+	binary.Write(deliver, binary.BigEndian, uint64(1))
+	deliver.WriteByte(0) // not redelivered
+	writeFakeAmqpShortString(deliver, "irods")
+	writeFakeAmqpShortString(deliver, routingKey)
+
+	err := writeFakeAmqpFrame(conn, fakeAmqpFrameMethod, channel, deliver.Bytes())
+	if err != nil {
+		return err
+	}
+
+	header := &bytes.Buffer{}
+	binary.Write(header, binary.BigEndian, uint16(60))
+	binary.Write(header, binary.BigEndian, uint16(0))
+	binary.Write(header, binary.BigEndian, uint64(len(body)))
+	binary.Write(header, binary.BigEndian, uint16(0))
+
+	err = writeFakeAmqpFrame(conn, fakeAmqpFrameHeader, channel, header.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return writeFakeAmqpFrame(conn, fakeAmqpFrameBody, channel, body)
+}
+
+func waitFakeAmqpTime(t *testing.T, times chan time.Time, desc string) time.Time {
+	t.Helper()
+
+	select {
+	case tm := <-times:
+		return tm
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for %s", desc)
+		return time.Time{}
+	}
+}
+
+func waitAmqpEvent(t *testing.T, events chan amqp_mod.Delivery) {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		if event.RoutingKey != fakeAmqpEventRoutingKey {
+			t.Errorf("expected an event %s, got %s", fakeAmqpEventRoutingKey, event.RoutingKey)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+}
+
+func TestAmqpConsumerReconnect(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for reconnect backoff")
+	}
+
+	broker := newFakeAmqpBroker(t)
+	config := &commons.AmqpConfig{
+		URL:      broker.getURL(),
+		Exchange: "irods",
+	}
+
+	events := make(chan amqp_mod.Delivery, 10)
+	consumer := CreateAmqpConsumer(nil, config, func(msg amqp_mod.Delivery) {
+		events <- msg
+	})
+	consumer.Start()
+	defer consumer.Release()
+
+	waitFakeAmqpTime(t, broker.declares, "a queue declared")
+	waitFakeAmqpTime(t, broker.consumes, "consuming")
+	waitAmqpEvent(t, events)
+
+	if !consumer.IsConsuming() {
+		t.Fatal("consumer is not consuming")
+	}
+
+	publisher, err := CreateAmqp(nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Release()
+
+	if !publisher.IsConnected() {
+		t.Fatal("publisher is not connected")
+	}
+
+	// drop the consumer, keep it down
+	broker.setRejectConsumers(true)
+	dropTime := time.Now()
+	broker.dropConsumers()
+
+	firstRetryTime := waitFakeAmqpTime(t, broker.declares, "the first reconnect")
+	if wait := firstRetryTime.Sub(dropTime); wait < EventConsumerBackoffMin-100*time.Millisecond {
+		t.Errorf("reconnected after %s, before the backoff %s", wait, EventConsumerBackoffMin)
+	}
+
+	if consumer.IsConsuming() {
+		t.Error("consumer is consuming while disconnected")
+	}
+
+	if consumer.GetLastError() == nil {
+		t.Error("consumer has no error while disconnected")
+	}
+
+	// publishing is not blocked by the consumer being down
+	request := turnin.NewSendMessageRequest("data-object.mod", "{}")
+	publishStartTime := time.Now()
+	err = publisher.ProcessItem(context.Background(), request, "")
+	if err != nil {
+		t.Fatalf("failed to publish while the consumer is down - %v", err)
+	}
+
+	if elapsed := time.Since(publishStartTime); elapsed > time.Second {
+		t.Errorf("publishing took %s while the consumer is down", elapsed)
+	}
+
+	select {
+	case routingKey := <-broker.publishes:
+		if routingKey != request.Key {
+			t.Errorf("expected a message %s published, got %s", request.Key, routingKey)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a message published")
+	}
+
+	// backoff doubles after a failed reconnect
+	secondRetryTime := waitFakeAmqpTime(t, broker.declares, "the second reconnect")
+	if wait := secondRetryTime.Sub(firstRetryTime); wait < 2*EventConsumerBackoffMin-100*time.Millisecond {
+		t.Errorf("reconnected again after %s, expected backoff %s", wait, 2*EventConsumerBackoffMin)
+	}
+
+	// reconnect ignores backoff
+	broker.setRejectConsumers(false)
+	reconnectTime := time.Now()
+	consumer.Reconnect()
+
+	consumeTime := waitFakeAmqpTime(t, broker.consumes, "consuming again")
+	if wait := consumeTime.Sub(reconnectTime); wait >= 2*EventConsumerBackoffMin {
+		t.Errorf("reconnect waited %s for backoff", wait)
+	}
+
+	waitAmqpEvent(t, events)
+
+	if !consumer.IsConsuming() {
+		t.Error("consumer is not consuming after reconnect")
+	}
+
+	if !publisher.IsConnected() {
+		t.Error("publisher is disconnected")
+	}
+}
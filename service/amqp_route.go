@@ -0,0 +1,108 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+	log "github.com/sirupsen/logrus"
+)
+
+// routeSendMessage returns AMQP of the destination and the exchange to publish the request to
+// destination and exchange given in the request override the route matching the routing key
+func (svc *AsyncExecCmdService) routeSendMessage(request *turnin.SendMessageRequest) (*AMQP, string, error) {
+	destination := request.Destination
+	exchange := request.Exchange
+
+	route := svc.getConfig().GetAmqpRoute(request.Key)
+	if route != nil {
+		if len(destination) == 0 {
+			destination = route.Destination
+			if len(exchange) == 0 {
+				exchange = route.Exchange
+			}
+		} else if destination == route.Destination && len(exchange) == 0 {
+			exchange = route.Exchange
+		}
+	}
+
+	if len(destination) == 0 || destination == commons.AmqpDestinationDefault {
+		if svc.amqp == nil {
+			return nil, "", fmt.Errorf("failed to send a send_message request because AMQP is not configured")
+		}
+		return svc.amqp, exchange, nil
+	}
+
+	amqp, ok := svc.amqpDestinations[destination]
+	if !ok {
+		return nil, "", NewValidationErrorf("failed to send a send_message request to unknown AMQP destination %s", destination)
+	}
+
+	return amqp, exchange, nil
+}
+
+// createAmqpDestinations creates AMQP of destinations configured, other than the default
+func (svc *AsyncExecCmdService) createAmqpDestinations(config *commons.ServerConfig) error {
+	svc.amqpDestinations = map[string]*AMQP{}
+
+	for idx := range config.AmqpDestinations {
+		destination := &config.AmqpDestinations[idx]
+
+		amqp, err := CreateAmqpDestination(svc, destination.Name, &destination.AmqpConfig)
+		if err != nil {
+			return err
+		}
+
+		svc.amqpDestinations[destination.Name] = amqp
+	}
+
+	return nil
+}
+
+// hasAmqpDestinations returns true if the service has all destinations configured, and no others
+// adding or removing destinations requires restart
+func (svc *AsyncExecCmdService) hasAmqpDestinations(config *commons.ServerConfig) bool {
+	if len(config.AmqpDestinations) != len(svc.amqpDestinations) {
+		return false
+	}
+
+	for _, destination := range config.AmqpDestinations {
+		if _, ok := svc.amqpDestinations[destination.Name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reconfigureAmqpDestinations reconnects destinations whose URL or exchange is changed, the service must have all destinations
+func (svc *AsyncExecCmdService) reconfigureAmqpDestinations(oldConfig *commons.ServerConfig, config *commons.ServerConfig) {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AsyncExecCmdService",
+		"function": "reconfigureAmqpDestinations",
+	})
+
+	oldDestinations := map[string]commons.AmqpDestinationConfig{}
+	for _, destination := range oldConfig.AmqpDestinations {
+		oldDestinations[destination.Name] = destination
+	}
+
+	for idx := range config.AmqpDestinations {
+		destination := &config.AmqpDestinations[idx]
+		amqp := svc.amqpDestinations[destination.Name]
+
+		oldDestination := oldDestinations[destination.Name]
+		if oldDestination.URL == destination.URL && oldDestination.Exchange == destination.Exchange {
+			// message defaults are read at publishing
+			amqp.SetConfig(&destination.AmqpConfig)
+			continue
+		}
+
+		// reconnect failures are not fatal, components connect again lazily
+		err := amqp.Reconfigure(&destination.AmqpConfig)
+		if err != nil {
+			logger.WithError(err).Warnf("failed to reconnect to AMQP destination %s, will retry again", destination.Name)
+		}
+	}
+}
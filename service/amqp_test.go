@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+)
+
+func TestAmqpConnectFailure(t *testing.T) {
+	// nothing listens at the address
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	// created disconnected, retries later
+	publisher, err := CreateAmqp(nil, &commons.AmqpConfig{
+		URL:      "amqp://guest:secret@" + addr + "/",
+		Exchange: "irods",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Release()
+
+	err = publisher.connect()
+	if !IsServiceNotReadyError(err) {
+		t.Errorf("expected a service not ready error, got %v", err)
+	}
+}
+
+func TestAmqpPublishFailure(t *testing.T) {
+	broker := newFakeAmqpBroker(t)
+	publisher, err := CreateAmqp(nil, &commons.AmqpConfig{
+		URL:      broker.getURL(),
+		Exchange: "irods",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Release()
+
+	// the channel is closed under the publisher
+	err = publisher.channel.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := turnin.NewSendMessageRequest("data-object.add", "{}")
+	err = publisher.ProcessItem(context.Background(), request, "")
+	if !IsServiceNotReadyError(err) {
+		t.Fatalf("expected a service not ready error to retry, got %v", err)
+	}
+
+	if publisher.IsConnected() {
+		t.Error("expected the publisher disconnected after a failed publish")
+	}
+
+	// the retry connects again once the reconnect interval has passed
+	publisher.lastConnectTrialTime = time.Time{}
+	err = publisher.ProcessItem(context.Background(), request, "")
+	if err != nil {
+		t.Fatalf("failed to publish on retry - %v", err)
+	}
+
+	select {
+	case routingKey := <-broker.publishes:
+		if routingKey != request.Key {
+			t.Errorf("expected a message %s published, got %s", request.Key, routingKey)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a message published")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/antchfx/xmlquery"
@@ -13,6 +14,9 @@ import (
 	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
 	log "github.com/sirupsen/logrus"
 	amqp_mod "github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -22,10 +26,11 @@ const (
 )
 
 type BisQue struct {
-	service *AsyncExecCmdService
-	config  *commons.BisqueConfig
-	context context.Context
-	client  *http.Client
+	service    *AsyncExecCmdService
+	config     *commons.BisqueConfig
+	configLock sync.RWMutex
+	context    context.Context
+	client     *http.Client
 }
 
 // CreateBisque creates a BisQue service object
@@ -44,13 +49,43 @@ func CreateBisque(service *AsyncExecCmdService, config *commons.BisqueConfig) (*
 	}
 
 	return &BisQue{
-		service: service,
-		config:  config,
-		context: context,
-		client:  client,
+		service:    service,
+		config:     config,
+		configLock: sync.RWMutex{},
+		context:    context,
+		client:     client,
 	}, nil
 }
 
+// getConfig returns config in use
+func (bisque *BisQue) getConfig() *commons.BisqueConfig {
+	bisque.configLock.RLock()
+	defer bisque.configLock.RUnlock()
+
+	return bisque.config
+}
+
+// Reconfigure replaces config, requests in progress continue with the old config
+func (bisque *BisQue) Reconfigure(config *commons.BisqueConfig) {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "BisQue",
+		"function": "Reconfigure",
+	})
+
+	logger.Infof("reconfiguring BisQue %s", config.URL)
+
+	bisque.configLock.Lock()
+	defer bisque.configLock.Unlock()
+
+	bisque.config = config
+
+	// do not reuse connections to the old server
+	if bisque.client != nil {
+		bisque.client.CloseIdleConnections()
+	}
+}
+
 // Release releases all resources
 func (bisque *BisQue) Release() {
 	logger := log.WithFields(log.Fields{
@@ -108,6 +143,8 @@ func (bisque *BisQue) processAmqpAddMessage(msg amqp_mod.Delivery) {
 
 	defer commons.StackTraceFromPanic(logger)
 
+	config := bisque.getConfig()
+
 	logger.Debugf("received a message - %s", string(msg.Body))
 
 	msgStruct, err := GetIrodsMsgFromJson(msg.Body)
@@ -122,7 +159,7 @@ func (bisque *BisQue) processAmqpAddMessage(msg amqp_mod.Delivery) {
 		return
 	}
 
-	if user == bisque.config.IrodsUsername {
+	if user == config.IrodsUsername {
 		// raised by irods user via bisque interface
 		// we don't need to re-process as it's already processed by bisque.
 		logger.Debug("ignoring the request since the request is made by BisQue")
@@ -135,13 +172,13 @@ func (bisque *BisQue) processAmqpAddMessage(msg amqp_mod.Delivery) {
 		return
 	}
 
-	if !bisque.isIrodsPathForBisque(path) {
+	if !bisque.isIrodsPathForBisque(config, path) {
 		// ignore
-		logger.Debugf("ignoring the request since the iRODS path %s is out of BisQue's iRODS root path %s", path, bisque.config.IrodsRootPath)
+		logger.Debugf("ignoring the request since the iRODS path %s is out of BisQue's iRODS root path %s", path, config.IrodsRootPath)
 		return
 	}
 
-	bisqueUser := bisque.getHomeUser(path, user)
+	bisqueUser := bisque.getHomeUser(config, path, user)
 
 	logger.Debugf("turn-in a link bisque request %s, %s", bisqueUser, path)
 
@@ -162,6 +199,8 @@ func (bisque *BisQue) processAmqpMoveMessage(msg amqp_mod.Delivery) {
 
 	defer commons.StackTraceFromPanic(logger)
 
+	config := bisque.getConfig()
+
 	logger.Debugf("received a message - %s", string(msg.Body))
 
 	msgStruct, err := GetIrodsMsgFromJson(msg.Body)
@@ -176,7 +215,7 @@ func (bisque *BisQue) processAmqpMoveMessage(msg amqp_mod.Delivery) {
 		return
 	}
 
-	if user == bisque.config.IrodsUsername {
+	if user == config.IrodsUsername {
 		// raised by irods user via BisQue interface
 		// we don't need to re-process as it's already processed by BisQue.
 		logger.Debug("ignoring the request since the request is made by BisQue")
@@ -189,10 +228,10 @@ func (bisque *BisQue) processAmqpMoveMessage(msg amqp_mod.Delivery) {
 		return
 	}
 
-	if bisque.isIrodsPathForBisque(oldPath) {
-		if bisque.isIrodsPathForBisque(newPath) {
+	if bisque.isIrodsPathForBisque(config, oldPath) {
+		if bisque.isIrodsPathForBisque(config, newPath) {
 			// move
-			bisqueUser := bisque.getHomeUser(newPath, user)
+			bisqueUser := bisque.getHomeUser(config, newPath, user)
 
 			// instead of using move request, we use remove and link
 			// move request may not be designed to handle fs rename event
@@ -228,7 +267,7 @@ func (bisque *BisQue) processAmqpMoveMessage(msg amqp_mod.Delivery) {
 			return
 		} else {
 			// remove
-			bisqueUser := bisque.getHomeUser(oldPath, user)
+			bisqueUser := bisque.getHomeUser(config, oldPath, user)
 
 			logger.Debugf("turn-in a remove bisque request %s, %s", bisqueUser, oldPath)
 
@@ -241,9 +280,9 @@ func (bisque *BisQue) processAmqpMoveMessage(msg amqp_mod.Delivery) {
 			return
 		}
 	} else {
-		if bisque.isIrodsPathForBisque(newPath) {
+		if bisque.isIrodsPathForBisque(config, newPath) {
 			// link
-			bisqueUser := bisque.getHomeUser(newPath, user)
+			bisqueUser := bisque.getHomeUser(config, newPath, user)
 
 			logger.Debugf("turn-in a link bisque request %s, %s", bisqueUser, newPath)
 
@@ -256,7 +295,7 @@ func (bisque *BisQue) processAmqpMoveMessage(msg amqp_mod.Delivery) {
 			return
 		} else {
 			// ignore
-			logger.Debugf("ignoring the request since the iRODS path %s and %s are out of iRODS root path %s", oldPath, newPath, bisque.config.IrodsRootPath)
+			logger.Debugf("ignoring the request since the iRODS path %s and %s are out of iRODS root path %s", oldPath, newPath, config.IrodsRootPath)
 			return
 		}
 	}
@@ -271,6 +310,8 @@ func (bisque *BisQue) processAmqpModifyMessage(msg amqp_mod.Delivery) {
 
 	defer commons.StackTraceFromPanic(logger)
 
+	config := bisque.getConfig()
+
 	logger.Debugf("received a message - %s", string(msg.Body))
 
 	msgStruct, err := GetIrodsMsgFromJson(msg.Body)
@@ -285,7 +326,7 @@ func (bisque *BisQue) processAmqpModifyMessage(msg amqp_mod.Delivery) {
 		return
 	}
 
-	if user == bisque.config.IrodsUsername {
+	if user == config.IrodsUsername {
 		// raised by irods user via BisQue interface
 		// we don't need to re-process as it's already processed by BisQue.
 		logger.Debug("ignoring the request since the request is made by BisQue")
@@ -300,19 +341,19 @@ func (bisque *BisQue) processAmqpModifyMessage(msg amqp_mod.Delivery) {
 		return
 	}
 
-	path, err := bisque.service.irods.ResolveObjectUUIDIntoPath(objUuid)
+	path, err := bisque.service.irods.ResolveObjectUUIDIntoPath(bisque.context, objUuid)
 	if err != nil {
 		logger.WithError(err).Errorf("failed to resolve iRODS object UUID into path - %s", objUuid)
 		return
 	}
 
-	if !bisque.isIrodsPathForBisque(path) {
+	if !bisque.isIrodsPathForBisque(config, path) {
 		// ignore
-		logger.Debugf("ignoring the request since the iRODS path %s is out of BisQue's iRODS root path %s", path, bisque.config.IrodsRootPath)
+		logger.Debugf("ignoring the request since the iRODS path %s is out of BisQue's iRODS root path %s", path, config.IrodsRootPath)
 		return
 	}
 
-	bisqueUser := bisque.getHomeUser(path, user)
+	bisqueUser := bisque.getHomeUser(config, path, user)
 
 	// link (this updates the existing link as well)
 	logger.Debugf("turn-in a link bisque request %s, %s", bisqueUser, path)
@@ -334,6 +375,8 @@ func (bisque *BisQue) processAmqpRemoveMessage(msg amqp_mod.Delivery) {
 
 	defer commons.StackTraceFromPanic(logger)
 
+	config := bisque.getConfig()
+
 	logger.Debugf("received a message - %s", string(msg.Body))
 
 	msgStruct, err := GetIrodsMsgFromJson(msg.Body)
@@ -348,7 +391,7 @@ func (bisque *BisQue) processAmqpRemoveMessage(msg amqp_mod.Delivery) {
 		return
 	}
 
-	if user == bisque.config.IrodsUsername {
+	if user == config.IrodsUsername {
 		// raised by irods user via bisque interface
 		// we don't need to re-process as it's already processed by bisque.
 		logger.Debug("ignoring the request since the request is made by BisQue")
@@ -361,7 +404,7 @@ func (bisque *BisQue) processAmqpRemoveMessage(msg amqp_mod.Delivery) {
 		return
 	}
 
-	bisqueUser := bisque.getHomeUser(path, user)
+	bisqueUser := bisque.getHomeUser(config, path, user)
 
 	logger.Debugf("turn-in a remove bisque request %s, %s", bisqueUser, path)
 
@@ -374,64 +417,70 @@ func (bisque *BisQue) processAmqpRemoveMessage(msg amqp_mod.Delivery) {
 }
 
 // ProcessItem processes a turn-in request
-func (bisque *BisQue) ProcessItem(item turnin.TurnInItem) error {
+func (bisque *BisQue) ProcessItem(ctx context.Context, item turnin.TurnInItem) error {
 	logger := log.WithFields(log.Fields{
-		"package":  "service",
-		"struct":   "BisQue",
-		"function": "ProcessItem",
+		"package":    "service",
+		"struct":     "BisQue",
+		"function":   "ProcessItem",
+		"request_id": item.GetRequestID(),
 	})
 
+	// a request uses one config throughout, even if reconfigured in the middle
+	config := bisque.getConfig()
+
 	switch item.GetRequestType() {
 	case turnin.LinkBisqueRequestType:
 		request, ok := item.(*turnin.LinkBisqueRequest)
 		if !ok {
-			err := fmt.Errorf("failed to convert item to LinkBisqueRequest")
+			err := NewValidationErrorf("failed to convert item to LinkBisqueRequest")
 			logger.Error(err)
 			return err
 		}
-		return bisque.ProcessLinkBisqueRequest(request)
+		return bisque.processLinkBisqueRequest(ctx, config, request)
 	case turnin.RemoveBisqueRequestType:
 		request, ok := item.(*turnin.RemoveBisqueRequest)
 		if !ok {
-			err := fmt.Errorf("failed to convert item to RemoveBisqueRequest")
+			err := NewValidationErrorf("failed to convert item to RemoveBisqueRequest")
 			logger.Error(err)
 			return err
 		}
-		return bisque.ProcessRemoveBisqueRequest(request)
+		return bisque.processRemoveBisqueRequest(ctx, config, request)
 	case turnin.MoveBisqueRequestType:
 		request, ok := item.(*turnin.MoveBisqueRequest)
 		if !ok {
-			err := fmt.Errorf("failed to convert item to MoveBisqueRequest")
+			err := NewValidationErrorf("failed to convert item to MoveBisqueRequest")
 			logger.Error(err)
 			return err
 		}
-		return bisque.ProcessMoveBisqueRequest(request)
+		return bisque.processMoveBisqueRequest(ctx, config, request)
 	default:
-		err := fmt.Errorf("unknown item type %s", item.GetRequestType())
+		err := NewValidationErrorf("unknown item type %s", item.GetRequestType())
 		logger.Error(err)
 		return err
 	}
 }
 
 // ProcessLinkBisqueRequest processes a turn-in link_bisque request, sending a HTTP request
-func (bisque *BisQue) ProcessLinkBisqueRequest(request *turnin.LinkBisqueRequest) error {
+func (bisque *BisQue) ProcessLinkBisqueRequest(ctx context.Context, request *turnin.LinkBisqueRequest) error {
 	logger := log.WithFields(log.Fields{
-		"package":  "service",
-		"struct":   "BisQue",
-		"function": "ProcessLinkBisqueRequest",
+		"package":    "service",
+		"struct":     "BisQue",
+		"function":   "ProcessLinkBisqueRequest",
+		"request_id": request.RequestID,
 	})
 
 	defer commons.StackTraceFromPanic(logger)
 
-	return bisque.processLinkBisqueRequest(request)
+	return bisque.processLinkBisqueRequest(ctx, bisque.getConfig(), request)
 }
 
 // processLinkBisqueRequest processes a turn-in link_bisque request, sending a HTTP request
-func (bisque *BisQue) processLinkBisqueRequest(request *turnin.LinkBisqueRequest) error {
+func (bisque *BisQue) processLinkBisqueRequest(ctx context.Context, config *commons.BisqueConfig, request *turnin.LinkBisqueRequest) error {
 	logger := log.WithFields(log.Fields{
-		"package":  "service",
-		"struct":   "BisQue",
-		"function": "processLinkBisqueRequest",
+		"package":    "service",
+		"struct":     "BisQue",
+		"function":   "processLinkBisqueRequest",
+		"request_id": request.RequestID,
 	})
 
 	defer commons.StackTraceFromPanic(logger)
@@ -439,26 +488,26 @@ func (bisque *BisQue) processLinkBisqueRequest(request *turnin.LinkBisqueRequest
 	logger.Debugf("trying to send a HTTP request for linking an iRODS object %s", request.IRODSPath)
 
 	if len(request.IRODSPath) == 0 || len(request.IRODSUsername) == 0 {
-		err := fmt.Errorf("failed to send a HTTP request for linking an iRODS object %s", request.IRODSPath)
+		err := NewValidationErrorf("failed to send a HTTP request for linking an iRODS object %s", request.IRODSPath)
 		logger.Error(err)
 		return err
 	}
 
-	irodsPathFromBisque, err := bisque.getIrodsPath(request.IRODSPath)
+	irodsPathFromBisque, err := bisque.getIrodsPath(config, request.IRODSPath)
 	if err != nil {
 		logger.WithError(err).Errorf("failed to get iRODS URL for linking an iRODS object %s", request.IRODSPath)
 		return err
 	}
 
 	// we first remove the resource to not create duplicates
-	bisqueUrlForRemove := bisque.getApiUrl("/blob_service/paths/remove")
+	bisqueUrlForRemove := bisque.getApiUrl(config, "/blob_service/paths/remove")
 
 	paramsForRemove := map[string]string{
 		"path":        irodsPathFromBisque,
 		"delete_blob": "False",
 	}
 
-	_, err = bisque.get(bisqueUrlForRemove, paramsForRemove)
+	_, err = bisque.get(ctx, config, bisqueUrlForRemove, paramsForRemove)
 	if err != nil {
 		logger.WithError(err).Warnf("failed to send a HTTP request for removing an iRODS object %s, the object may not exist", request.IRODSPath)
 		// we continue
@@ -468,13 +517,13 @@ func (bisque *BisQue) processLinkBisqueRequest(request *turnin.LinkBisqueRequest
 	logger.Infof("published a HTTP request for removing an iRODS object %s", request.IRODSPath)
 
 	// insert now
-	bisqueUrlForLink := bisque.getApiUrl("/blob_service/paths/insert")
+	bisqueUrlForLink := bisque.getApiUrl(config, "/blob_service/paths/insert")
 
 	paramsForLink := map[string]string{
 		"user": request.IRODSUsername,
 	}
 
-	resourceName, err := bisque.getBisqueResourcePath(request.IRODSPath)
+	resourceName, err := bisque.getBisqueResourcePath(config, request.IRODSPath)
 	if err != nil {
 		logger.WithError(err).Errorf("failed to get resource name for linking an iRODS object %s", request.IRODSPath)
 		return err
@@ -482,7 +531,7 @@ func (bisque *BisQue) processLinkBisqueRequest(request *turnin.LinkBisqueRequest
 
 	body := fmt.Sprintf("<resource name=\"%s\" permission=\"%s\" value=\"%s\" />", resourceName, BisqueLinkPermissionDefault, irodsPathFromBisque)
 
-	resp, err := bisque.post(bisqueUrlForLink, paramsForLink, body)
+	resp, err := bisque.post(ctx, config, bisqueUrlForLink, paramsForLink, body)
 	if err != nil {
 		logger.WithError(err).Errorf("failed to send a HTTP request for linking an iRODS object %s to %s (%s in bisque)", request.IRODSPath, irodsPathFromBisque, resourceName)
 		return err
@@ -527,7 +576,7 @@ func (bisque *BisQue) processLinkBisqueRequest(request *turnin.LinkBisqueRequest
 
 	logger.Debugf("setting an iRODS key/val for BisqueID to an iRODS object %s", request.IRODSPath)
 
-	err = bisque.service.irods.SetKeyVal(request.IRODSPath, IRODSKeyValForBisqueID, resourceUniqAttr)
+	err = bisque.service.irods.SetKeyVal(ctx, request.IRODSPath, IRODSKeyValForBisqueID, resourceUniqAttr)
 	if err != nil {
 		logger.WithError(err).Errorf("failed to set iRODS key/val for BisqueID to an iRODS object %s", request.IRODSPath)
 		return err
@@ -539,24 +588,26 @@ func (bisque *BisQue) processLinkBisqueRequest(request *turnin.LinkBisqueRequest
 }
 
 // ProcessRemoveBisqueRequest processes a turn-in remove_bisque request, sending a HTTP request
-func (bisque *BisQue) ProcessRemoveBisqueRequest(request *turnin.RemoveBisqueRequest) error {
+func (bisque *BisQue) ProcessRemoveBisqueRequest(ctx context.Context, request *turnin.RemoveBisqueRequest) error {
 	logger := log.WithFields(log.Fields{
-		"package":  "service",
-		"struct":   "BisQue",
-		"function": "ProcessRemoveBisqueRequest",
+		"package":    "service",
+		"struct":     "BisQue",
+		"function":   "ProcessRemoveBisqueRequest",
+		"request_id": request.RequestID,
 	})
 
 	defer commons.StackTraceFromPanic(logger)
 
-	return bisque.processRemoveBisqueRequest(request)
+	return bisque.processRemoveBisqueRequest(ctx, bisque.getConfig(), request)
 }
 
 // processRemoveBisqueRequest processes a turn-in remove_bisque request, sending a HTTP request
-func (bisque *BisQue) processRemoveBisqueRequest(request *turnin.RemoveBisqueRequest) error {
+func (bisque *BisQue) processRemoveBisqueRequest(ctx context.Context, config *commons.BisqueConfig, request *turnin.RemoveBisqueRequest) error {
 	logger := log.WithFields(log.Fields{
-		"package":  "service",
-		"struct":   "BisQue",
-		"function": "processRemoveBisqueRequest",
+		"package":    "service",
+		"struct":     "BisQue",
+		"function":   "processRemoveBisqueRequest",
+		"request_id": request.RequestID,
 	})
 
 	defer commons.StackTraceFromPanic(logger)
@@ -564,14 +615,14 @@ func (bisque *BisQue) processRemoveBisqueRequest(request *turnin.RemoveBisqueReq
 	logger.Debugf("trying to send a HTTP request for removing an iRODS object %s", request.IRODSPath)
 
 	if len(request.IRODSPath) == 0 || len(request.IRODSUsername) == 0 {
-		err := fmt.Errorf("failed to send a HTTP request for removing an iRODS object %s", request.IRODSPath)
+		err := NewValidationErrorf("failed to send a HTTP request for removing an iRODS object %s", request.IRODSPath)
 		logger.Error(err)
 		return err
 	}
 
-	bisqueUrl := bisque.getApiUrl("/blob_service/paths/remove")
+	bisqueUrl := bisque.getApiUrl(config, "/blob_service/paths/remove")
 
-	irodsPathFromBisque, err := bisque.getIrodsPath(request.IRODSPath)
+	irodsPathFromBisque, err := bisque.getIrodsPath(config, request.IRODSPath)
 	if err != nil {
 		logger.WithError(err).Errorf("failed to get iRODS URL for removing an iRODS object %s", request.IRODSPath)
 		return err
@@ -582,7 +633,7 @@ func (bisque *BisQue) processRemoveBisqueRequest(request *turnin.RemoveBisqueReq
 		"delete_blob": "False",
 	}
 
-	_, err = bisque.get(bisqueUrl, params)
+	_, err = bisque.get(ctx, config, bisqueUrl, params)
 	if err != nil {
 		logger.WithError(err).Errorf("failed to send a HTTP request for removing an iRODS object %s", request.IRODSPath)
 		return err
@@ -594,24 +645,26 @@ func (bisque *BisQue) processRemoveBisqueRequest(request *turnin.RemoveBisqueReq
 }
 
 // ProcessMoveBisqueRequest processes a turn-in move_bisque request, sending a HTTP request
-func (bisque *BisQue) ProcessMoveBisqueRequest(request *turnin.MoveBisqueRequest) error {
+func (bisque *BisQue) ProcessMoveBisqueRequest(ctx context.Context, request *turnin.MoveBisqueRequest) error {
 	logger := log.WithFields(log.Fields{
-		"package":  "service",
-		"struct":   "BisQue",
-		"function": "ProcessMoveBisqueRequest",
+		"package":    "service",
+		"struct":     "BisQue",
+		"function":   "ProcessMoveBisqueRequest",
+		"request_id": request.RequestID,
 	})
 
 	defer commons.StackTraceFromPanic(logger)
 
-	return bisque.processMoveBisqueRequest(request)
+	return bisque.processMoveBisqueRequest(ctx, bisque.getConfig(), request)
 }
 
 // processMoveBisqueRequest processes a turn-in move_bisque request, sending a HTTP request
-func (bisque *BisQue) processMoveBisqueRequest(request *turnin.MoveBisqueRequest) error {
+func (bisque *BisQue) processMoveBisqueRequest(ctx context.Context, config *commons.BisqueConfig, request *turnin.MoveBisqueRequest) error {
 	logger := log.WithFields(log.Fields{
-		"package":  "service",
-		"struct":   "BisQue",
-		"function": "processMoveBisqueRequest",
+		"package":    "service",
+		"struct":     "BisQue",
+		"function":   "processMoveBisqueRequest",
+		"request_id": request.RequestID,
 	})
 
 	defer commons.StackTraceFromPanic(logger)
@@ -619,20 +672,20 @@ func (bisque *BisQue) processMoveBisqueRequest(request *turnin.MoveBisqueRequest
 	logger.Debugf("trying to send a HTTP request for moving an iRODS object %s to %s", request.SourceIRODSPath, request.DestIRODSPath)
 
 	if len(request.SourceIRODSPath) == 0 || len(request.DestIRODSPath) == 0 || len(request.IRODSUsername) == 0 {
-		err := fmt.Errorf("failed to send a HTTP request for moving an iRODS object %s to %s", request.SourceIRODSPath, request.DestIRODSPath)
+		err := NewValidationErrorf("failed to send a HTTP request for moving an iRODS object %s to %s", request.SourceIRODSPath, request.DestIRODSPath)
 		logger.Error(err)
 		return err
 	}
 
-	bisqueUrl := bisque.getApiUrl("/blob_service/paths/move")
+	bisqueUrl := bisque.getApiUrl(config, "/blob_service/paths/move")
 
-	sourceIrodsPathFromBisque, err := bisque.getIrodsPath(request.SourceIRODSPath)
+	sourceIrodsPathFromBisque, err := bisque.getIrodsPath(config, request.SourceIRODSPath)
 	if err != nil {
 		logger.WithError(err).Errorf("failed to get iRODS URL for moving an iRODS object %s", request.SourceIRODSPath)
 		return err
 	}
 
-	destIrodsPathFromBisque, err := bisque.getIrodsPath(request.DestIRODSPath)
+	destIrodsPathFromBisque, err := bisque.getIrodsPath(config, request.DestIRODSPath)
 	if err != nil {
 		logger.WithError(err).Errorf("failed to get iRODS URL for moving an iRODS object %s", request.DestIRODSPath)
 		return err
@@ -643,7 +696,7 @@ func (bisque *BisQue) processMoveBisqueRequest(request *turnin.MoveBisqueRequest
 		"destination": destIrodsPathFromBisque,
 	}
 
-	_, err = bisque.get(bisqueUrl, params)
+	_, err = bisque.get(ctx, config, bisqueUrl, params)
 	if err != nil {
 		logger.WithError(err).Errorf("failed to send a HTTP request for moving an iRODS object %s", request.SourceIRODSPath)
 		return err
@@ -654,17 +707,25 @@ func (bisque *BisQue) processMoveBisqueRequest(request *turnin.MoveBisqueRequest
 	return nil
 }
 
-func (bisque *BisQue) get(url string, params map[string]string) (string, error) {
+func (bisque *BisQue) get(ctx context.Context, config *commons.BisqueConfig, url string, params map[string]string) (string, error) {
 	logger := log.WithFields(log.Fields{
-		"package":  "service",
-		"struct":   "BisQue",
-		"function": "get",
+		"package":    "service",
+		"struct":     "BisQue",
+		"function":   "get",
+		"request_id": commons.GetRequestIDFromContext(ctx),
 	})
 
 	defer commons.StackTraceFromPanic(logger)
 
-	req, err := http.NewRequestWithContext(bisque.context, http.MethodGet, url, nil)
+	ctx, span := bisque.service.startSpan(ctx, "BisQue get", trace.SpanKindClient,
+		semconv.HTTPMethodKey.String(http.MethodGet),
+		semconv.HTTPURLKey.String(url),
+	)
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
+		commons.SetSpanError(span, err)
 		return "", err
 	}
 
@@ -676,16 +737,27 @@ func (bisque *BisQue) get(url string, params map[string]string) (string, error)
 	req.URL.RawQuery = query.Encode()
 
 	// basic-auth
-	req.SetBasicAuth(bisque.config.AdminUsername, bisque.config.AdminPassword)
+	req.SetBasicAuth(config.AdminUsername, config.AdminPassword)
+
+	requestID := commons.GetRequestIDFromContext(ctx)
+	if len(requestID) > 0 {
+		req.Header.Set(commons.RequestIDHeader, requestID)
+	}
+
+	injectTraceContext(ctx, propagation.HeaderCarrier(req.Header))
 
 	resp, err := bisque.client.Do(req)
 	if err != nil {
+		commons.SetSpanError(span, err)
 		return "", err
 	}
 
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+
 	// read body
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
+		commons.SetSpanError(span, err)
 		return "", err
 	}
 	resp.Body.Close()
@@ -693,24 +765,34 @@ func (bisque *BisQue) get(url string, params map[string]string) (string, error)
 	// check if status is ok
 	if resp.StatusCode != http.StatusOK {
 		// error
-		return "", fmt.Errorf("BisQue responded an error %s (%d) - %s", resp.Status, resp.StatusCode, string(resBody))
+		err = NewRemoteResponseErrorf(resp.StatusCode, "BisQue responded an error %s (%d) - %s", resp.Status, resp.StatusCode, string(resBody))
+		commons.SetSpanError(span, err)
+		return "", err
 	}
 
 	// success, return body
 	return string(resBody), nil
 }
 
-func (bisque *BisQue) post(url string, params map[string]string, body string) (string, error) {
+func (bisque *BisQue) post(ctx context.Context, config *commons.BisqueConfig, url string, params map[string]string, body string) (string, error) {
 	logger := log.WithFields(log.Fields{
-		"package":  "service",
-		"struct":   "BisQue",
-		"function": "post",
+		"package":    "service",
+		"struct":     "BisQue",
+		"function":   "post",
+		"request_id": commons.GetRequestIDFromContext(ctx),
 	})
 
 	defer commons.StackTraceFromPanic(logger)
 
-	req, err := http.NewRequestWithContext(bisque.context, http.MethodPost, url, nil)
+	ctx, span := bisque.service.startSpan(ctx, "BisQue post", trace.SpanKindClient,
+		semconv.HTTPMethodKey.String(http.MethodPost),
+		semconv.HTTPURLKey.String(url),
+	)
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
 	if err != nil {
+		commons.SetSpanError(span, err)
 		return "", err
 	}
 
@@ -722,18 +804,29 @@ func (bisque *BisQue) post(url string, params map[string]string, body string) (s
 	req.URL.RawQuery = query.Encode()
 
 	// basic-auth
-	req.SetBasicAuth(bisque.config.AdminUsername, bisque.config.AdminPassword)
+	req.SetBasicAuth(config.AdminUsername, config.AdminPassword)
+
+	requestID := commons.GetRequestIDFromContext(ctx)
+	if len(requestID) > 0 {
+		req.Header.Set(commons.RequestIDHeader, requestID)
+	}
+
+	injectTraceContext(ctx, propagation.HeaderCarrier(req.Header))
 	req.Header.Add("content-type", "application/xml")
 
 	req.Body = io.NopCloser(strings.NewReader(body))
 	resp, err := bisque.client.Do(req)
 	if err != nil {
+		commons.SetSpanError(span, err)
 		return "", err
 	}
 
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+
 	// read body
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
+		commons.SetSpanError(span, err)
 		return "", err
 	}
 	resp.Body.Close()
@@ -741,32 +834,34 @@ func (bisque *BisQue) post(url string, params map[string]string, body string) (s
 	// check if status is ok
 	if resp.StatusCode != http.StatusOK {
 		// error
-		return "", fmt.Errorf("BisQue responded an error %s (%d) - %s", resp.Status, resp.StatusCode, string(resBody))
+		err = NewRemoteResponseErrorf(resp.StatusCode, "BisQue responded an error %s (%d) - %s", resp.Status, resp.StatusCode, string(resBody))
+		commons.SetSpanError(span, err)
+		return "", err
 	}
 
 	// success, return body
 	return string(resBody), nil
 }
 
-func (bisque *BisQue) getApiUrl(path string) string {
-	return fmt.Sprintf("%s/%s", strings.TrimRight(bisque.config.URL, "/"), strings.TrimLeft(path, "/"))
+func (bisque *BisQue) getApiUrl(config *commons.BisqueConfig, path string) string {
+	return fmt.Sprintf("%s/%s", strings.TrimRight(config.URL, "/"), strings.TrimLeft(path, "/"))
 }
 
-func (bisque *BisQue) getIrodsPath(irodsPath string) (string, error) {
-	base := fmt.Sprintf("%s/", strings.TrimRight(bisque.config.IrodsRootPath, "/"))
+func (bisque *BisQue) getIrodsPath(config *commons.BisqueConfig, irodsPath string) (string, error) {
+	base := fmt.Sprintf("%s/", strings.TrimRight(config.IrodsRootPath, "/"))
 	if !strings.HasPrefix(irodsPath, base) {
-		return "", fmt.Errorf("iRODS Path %s is not under iRODS root path %s", irodsPath, bisque.config.IrodsRootPath)
+		return "", NewValidationErrorf("iRODS Path %s is not under iRODS root path %s", irodsPath, config.IrodsRootPath)
 	}
 
 	rel := irodsPath[len(base):]
 
-	return fmt.Sprintf("%s/%s", strings.TrimRight(bisque.config.IrodsBaseURL, "/"), strings.TrimLeft(rel, "/")), nil
+	return fmt.Sprintf("%s/%s", strings.TrimRight(config.IrodsBaseURL, "/"), strings.TrimLeft(rel, "/")), nil
 }
 
-func (bisque *BisQue) getBisqueResourcePath(irodsPath string) (string, error) {
-	base := fmt.Sprintf("%s/", strings.TrimRight(bisque.config.IrodsRootPath, "/"))
+func (bisque *BisQue) getBisqueResourcePath(config *commons.BisqueConfig, irodsPath string) (string, error) {
+	base := fmt.Sprintf("%s/", strings.TrimRight(config.IrodsRootPath, "/"))
 	if !strings.HasPrefix(irodsPath, base) {
-		return "", fmt.Errorf("iRODS Path %s is not under iRODS root path %s", irodsPath, bisque.config.IrodsRootPath)
+		return "", NewValidationErrorf("iRODS Path %s is not under iRODS root path %s", irodsPath, config.IrodsRootPath)
 	}
 
 	rel := irodsPath[len(base):]
@@ -783,12 +878,12 @@ func (bisque *BisQue) getBisqueResourcePath(irodsPath string) (string, error) {
 	return strings.TrimLeft(rel, "/"), nil
 }
 
-func (bisque *BisQue) isIrodsPathForBisque(irodsPath string) bool {
-	base := fmt.Sprintf("%s/", strings.TrimRight(bisque.config.IrodsRootPath, "/"))
+func (bisque *BisQue) isIrodsPathForBisque(config *commons.BisqueConfig, irodsPath string) bool {
+	base := fmt.Sprintf("%s/", strings.TrimRight(config.IrodsRootPath, "/"))
 	return strings.HasPrefix(irodsPath, base)
 }
 
-func (bisque *BisQue) getHomeUser(irodsPath string, defaultUser string) string {
+func (bisque *BisQue) getHomeUser(config *commons.BisqueConfig, irodsPath string, defaultUser string) string {
 	logger := log.WithFields(log.Fields{
 		"package":  "service",
 		"struct":   "BisQue",
@@ -797,8 +892,8 @@ func (bisque *BisQue) getHomeUser(irodsPath string, defaultUser string) string {
 
 	defer commons.StackTraceFromPanic(logger)
 
-	homePrefix := fmt.Sprintf("/%s/home/", bisque.config.IrodsZone)
-	trashHomePrefix := fmt.Sprintf("/%s/trash/home/", bisque.config.IrodsZone)
+	homePrefix := fmt.Sprintf("/%s/home/", config.IrodsZone)
+	trashHomePrefix := fmt.Sprintf("/%s/trash/home/", config.IrodsZone)
 	if strings.HasPrefix(irodsPath, trashHomePrefix) {
 		// starts with /zone/trash/home/
 		rest := irodsPath[len(trashHomePrefix):]
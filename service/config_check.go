@@ -0,0 +1,342 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/antchfx/xmlquery"
+	irods_connection "github.com/cyverse/go-irodsclient/irods/connection"
+	irods_types "github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/control"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+	"github.com/nats-io/nats.go"
+	amqp_mod "github.com/streadway/amqp"
+)
+
+const (
+	// ConfigCheckTimeoutDefault is the default timeout of a connectivity check
+	ConfigCheckTimeoutDefault time.Duration = 30 * time.Second
+)
+
+// ConfigCheckResult is a result of a config check
+type ConfigCheckResult struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Message string `json:"message"`
+}
+
+func newConfigCheckResult(name string, err error, message string) ConfigCheckResult {
+	if err != nil {
+		return ConfigCheckResult{
+			Name:    name,
+			OK:      false,
+			Message: err.Error(),
+		}
+	}
+
+	return ConfigCheckResult{
+		Name:    name,
+		OK:      true,
+		Message: message,
+	}
+}
+
+// CheckConfig validates the config and tests connections to remote services, without starting the service
+func CheckConfig(config *commons.ServerConfig, timeout time.Duration) []ConfigCheckResult {
+	if timeout <= 0 {
+		timeout = ConfigCheckTimeoutDefault
+	}
+
+	results := []ConfigCheckResult{}
+	results = append(results, newConfigCheckResult("config", config.Validate(), "valid"))
+	results = append(results, checkTurnInDir(config))
+	if len(config.AmqpConfig.URL) > 0 || config.HasMessageOutput(commons.MessageOutputAMQP) {
+		results = append(results, checkAmqp(control.ComponentAMQP, &config.AmqpConfig, timeout))
+	} else {
+		results = append(results, ConfigCheckResult{
+			Name:    control.ComponentAMQP,
+			OK:      true,
+			Skipped: true,
+			Message: "not configured",
+		})
+	}
+	for idx := range config.AmqpDestinations {
+		destination := &config.AmqpDestinations[idx]
+		results = append(results, checkAmqp(control.ComponentAMQPDestinationPrefix+destination.Name, &destination.AmqpConfig, timeout))
+	}
+	results = append(results, checkKafka(&config.KafkaConfig, timeout))
+	eventSource, _ := config.GetEventSource()
+	results = append(results, checkNats(&config.NatsConfig, len(config.BisqueConfig.URL) > 0 && eventSource == commons.EventSourceNATS, timeout))
+	results = append(results, checkIrods(&config.IrodsConfig, timeout))
+	results = append(results, checkBisque(&config.BisqueConfig, timeout))
+	return results
+}
+
+// checkTurnInDir checks if turn in dir is writable, or can be made
+func checkTurnInDir(config *commons.ServerConfig) ConfigCheckResult {
+	name := "turnin_dir"
+	dir := config.GetTurnInRootDirPath()
+
+	_, err := os.Stat(dir)
+	if err == nil {
+		ti := turnin.NewTurnIn(dir)
+		err = ti.CheckCapacity()
+		return newConfigCheckResult(name, err, fmt.Sprintf("%s is writable", dir))
+	}
+
+	if !os.IsNotExist(err) {
+		return newConfigCheckResult(name, err, "")
+	}
+
+	// the service makes the dir, check the closest parent existing
+	parent := filepath.Dir(dir)
+	for {
+		_, statErr := os.Stat(parent)
+		if statErr == nil {
+			break
+		}
+
+		if filepath.Dir(parent) == parent {
+			break
+		}
+		parent = filepath.Dir(parent)
+	}
+
+	err = syscall.Access(parent, 0x2) // W_OK
+	if err != nil {
+		return newConfigCheckResult(name, fmt.Errorf("%s does not exist, and cannot be made in %s - %v", dir, parent, err), "")
+	}
+
+	return newConfigCheckResult(name, nil, fmt.Sprintf("%s does not exist, will be made", dir))
+}
+
+// checkAmqp connects to AMQP and checks if the exchange exists
+func checkAmqp(name string, config *commons.AmqpConfig, timeout time.Duration) ConfigCheckResult {
+
+	if len(config.URL) == 0 {
+		return newConfigCheckResult(name, fmt.Errorf("AMQP URL is not given"), "")
+	}
+
+	connection, err := amqp_mod.DialConfig(config.URL, amqp_mod.Config{
+		Dial: amqp_mod.DefaultDial(timeout),
+	})
+	if err != nil {
+		return newConfigCheckResult(name, fmt.Errorf("failed to connect to AMQP %s - %v", commons.RedactURL(config.URL), err), "")
+	}
+	defer connection.Close()
+
+	channel, err := connection.Channel()
+	if err != nil {
+		return newConfigCheckResult(name, fmt.Errorf("failed to open a channel - %v", err), "")
+	}
+	defer channel.Close()
+
+	// kind and other options are not checked in passive mode
+	err = channel.ExchangeDeclarePassive(config.Exchange, amqp_mod.ExchangeTopic, true, false, false, false, nil)
+	if err != nil {
+		return newConfigCheckResult(name, fmt.Errorf("failed to find exchange %s - %v", config.Exchange, err), "")
+	}
+
+	return newConfigCheckResult(name, nil, fmt.Sprintf("connected to %s, exchange %s exists", commons.RedactURL(config.URL), config.Exchange))
+}
+
+// checkKafka connects to Kafka and checks if topics configured exist
+func checkKafka(config *commons.KafkaConfig, timeout time.Duration) ConfigCheckResult {
+	name := control.ComponentKafka
+
+	if !config.IsConfigured() {
+		return ConfigCheckResult{
+			Name:    name,
+			OK:      true,
+			Skipped: true,
+			Message: "not configured",
+		}
+	}
+
+	saramaConfig, err := newSaramaConfig(config)
+	if err != nil {
+		return newConfigCheckResult(name, err, "")
+	}
+
+	saramaConfig.Net.DialTimeout = timeout
+	saramaConfig.Net.ReadTimeout = timeout
+	saramaConfig.Net.WriteTimeout = timeout
+
+	brokers := strings.Join(config.Brokers, ",")
+
+	client, err := sarama.NewClient(config.Brokers, saramaConfig)
+	if err != nil {
+		return newConfigCheckResult(name, fmt.Errorf("failed to connect to Kafka %s - %v", brokers, err), "")
+	}
+	defer client.Close()
+
+	existingTopics, err := client.Topics()
+	if err != nil {
+		return newConfigCheckResult(name, fmt.Errorf("failed to list topics of Kafka %s - %v", brokers, err), "")
+	}
+
+	existing := map[string]bool{}
+	for _, topic := range existingTopics {
+		existing[topic] = true
+	}
+
+	// topics derived from keys are not known until messages are sent
+	topics := []string{}
+	if len(config.Topic) > 0 {
+		topics = append(topics, config.Topic)
+	}
+	for _, topic := range config.Topics {
+		topics = append(topics, topic.Topic)
+	}
+
+	for _, topic := range topics {
+		if !existing[topic] {
+			return newConfigCheckResult(name, fmt.Errorf("failed to find topic %s in Kafka %s", topic, brokers), "")
+		}
+	}
+
+	return newConfigCheckResult(name, nil, fmt.Sprintf("connected to %s, %d topics configured exist", brokers, len(topics)))
+}
+
+// checkNats connects to NATS and checks if JetStream and streams configured exist
+// the stream of iRODS events is checked if events are consumed from NATS
+func checkNats(config *commons.NatsConfig, consumeEvents bool, timeout time.Duration) ConfigCheckResult {
+	name := control.ComponentNATS
+
+	if !config.IsConfigured() {
+		return ConfigCheckResult{
+			Name:    name,
+			OK:      true,
+			Skipped: true,
+			Message: "not configured",
+		}
+	}
+
+	checkConfig := *config
+	checkConfig.Timeout = timeout
+
+	connection, err := connectNats(&checkConfig, "config check")
+	if err != nil {
+		return newConfigCheckResult(name, err, "")
+	}
+	defer connection.Close()
+
+	url := commons.RedactURL(connection.ConnectedUrl())
+
+	jetstream, err := connection.JetStream(nats.MaxWait(timeout))
+	if err != nil {
+		return newConfigCheckResult(name, fmt.Errorf("failed to get a JetStream context - %v", err), "")
+	}
+
+	_, err = jetstream.AccountInfo()
+	if err != nil {
+		return newConfigCheckResult(name, fmt.Errorf("failed to get JetStream account info from NATS %s - %v", url, err), "")
+	}
+
+	if len(config.Stream) > 0 {
+		_, err = jetstream.StreamInfo(config.Stream)
+		if err != nil {
+			return newConfigCheckResult(name, fmt.Errorf("failed to find stream %s in NATS %s - %v", config.Stream, url, err), "")
+		}
+	}
+
+	if consumeEvents {
+		eventStream := config.EventStream
+		if len(eventStream) > 0 {
+			_, err = jetstream.StreamInfo(eventStream)
+		} else {
+			eventStream, err = jetstream.StreamNameBySubject(config.GetEventSubjects())
+		}
+
+		if err != nil {
+			return newConfigCheckResult(name, fmt.Errorf("failed to find a stream of iRODS events %s in NATS %s - %v", config.GetEventSubjects(), url, err), "")
+		}
+
+		return newConfigCheckResult(name, nil, fmt.Sprintf("connected to %s, iRODS events are in stream %s", url, eventStream))
+	}
+
+	return newConfigCheckResult(name, nil, fmt.Sprintf("connected to %s, JetStream is enabled", url))
+}
+
+// checkIrods logs in to iRODS
+func checkIrods(config *commons.IrodsConfig, timeout time.Duration) ConfigCheckResult {
+	name := "irods"
+
+	account, err := irods_types.CreateIRODSAccount(config.Host, config.Port, config.AdminUsername, config.Zone, irods_types.AuthSchemeNative, config.AdminPassword, "")
+	if err != nil {
+		return newConfigCheckResult(name, fmt.Errorf("failed to create an iRODS account - %v", err), "")
+	}
+
+	connection := irods_connection.NewIRODSConnection(account, timeout, irodsClientName)
+	err = connection.Connect()
+	if err != nil {
+		return newConfigCheckResult(name, fmt.Errorf("failed to log in to iRODS host %s:%d, zone %s, user %s - %v", config.Host, config.Port, config.Zone, config.AdminUsername, err), "")
+	}
+	defer connection.Disconnect()
+
+	return newConfigCheckResult(name, nil, fmt.Sprintf("logged in to iRODS host %s:%d, zone %s, user %s", config.Host, config.Port, config.Zone, config.AdminUsername))
+}
+
+// checkBisque authenticates to BisQue
+func checkBisque(config *commons.BisqueConfig, timeout time.Duration) ConfigCheckResult {
+	name := "bisque"
+
+	if len(config.URL) == 0 {
+		return ConfigCheckResult{
+			Name:    name,
+			OK:      true,
+			Skipped: true,
+			Message: "not configured",
+		}
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+	}
+	defer client.CloseIdleConnections()
+
+	url := fmt.Sprintf("%s/auth_service/whoami", strings.TrimRight(config.URL, "/"))
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return newConfigCheckResult(name, err, "")
+	}
+
+	req.SetBasicAuth(config.AdminUsername, config.AdminPassword)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return newConfigCheckResult(name, fmt.Errorf("failed to connect to BisQue %s - %v", config.URL, err), "")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return newConfigCheckResult(name, fmt.Errorf("failed to read a response from BisQue %s - %v", config.URL, err), "")
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newConfigCheckResult(name, fmt.Errorf("failed to authenticate to BisQue %s as %s - %s", config.URL, config.AdminUsername, resp.Status), "")
+	}
+
+	// whoami returns an empty response for anonymous users
+	doc, err := xmlquery.Parse(strings.NewReader(string(body)))
+	if err != nil {
+		return newConfigCheckResult(name, fmt.Errorf("failed to parse a response from BisQue %s - %v", config.URL, err), "")
+	}
+
+	user := xmlquery.FindOne(doc, "//user")
+	if user == nil {
+		return newConfigCheckResult(name, fmt.Errorf("failed to authenticate to BisQue %s as %s, not logged in", config.URL, config.AdminUsername), "")
+	}
+
+	return newConfigCheckResult(name, nil, fmt.Sprintf("authenticated to BisQue %s as %s", config.URL, user.SelectAttr("name")))
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/control"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ControlIdleTimeout is the time a control connection can stay idle
+	ControlIdleTimeout time.Duration = 1 * time.Minute
+)
+
+// ControlServer serves requests over the control socket
+type ControlServer struct {
+	service    *AsyncExecCmdService
+	socketPath string
+	listener   net.Listener
+	waitGroup  sync.WaitGroup
+}
+
+// CreateControlServer creates a control server, listening on the control socket
+// if a listener is given, e.g., passed by systemd socket activation, it is used instead
+func CreateControlServer(service *AsyncExecCmdService, config *commons.ServerConfig, listener net.Listener) (*ControlServer, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"function": "CreateControlServer",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	if listener != nil {
+		// the owner of the listener manages the socket file and its permission
+		socketPath := listener.Addr().String()
+		logger.Infof("listening on control socket %s given", socketPath)
+
+		server := &ControlServer{
+			service:    service,
+			socketPath: socketPath,
+			listener:   listener,
+		}
+
+		server.waitGroup.Add(1)
+		go server.serve()
+
+		return server, nil
+	}
+
+	socketPath := config.GetControlSocketPath()
+
+	mode, err := config.GetControlSocketMode()
+	if err != nil {
+		return nil, err
+	}
+
+	err = removeStaleControlSocket(socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err = net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket %s - %v", socketPath, err)
+	}
+
+	err = setControlSocketPermission(socketPath, mode, config.ControlSocketGroup)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	logger.Infof("listening on control socket %s", socketPath)
+
+	server := &ControlServer{
+		service:    service,
+		socketPath: socketPath,
+		listener:   listener,
+	}
+
+	server.waitGroup.Add(1)
+	go server.serve()
+
+	return server, nil
+}
+
+// removeStaleControlSocket removes a control socket left by a service not running
+func removeStaleControlSocket(socketPath string) error {
+	socketInfo, err := os.Lstat(socketPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to stat control socket %s - %v", socketPath, err)
+	}
+
+	if socketInfo.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("control socket %s exist, but not a socket", socketPath)
+	}
+
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("control socket %s is in use by another service", socketPath)
+	}
+
+	err = os.Remove(socketPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale control socket %s - %v", socketPath, err)
+	}
+
+	return nil
+}
+
+// setControlSocketPermission sets permission and group of the control socket
+func setControlSocketPermission(socketPath string, mode os.FileMode, group string) error {
+	err := os.Chmod(socketPath, mode)
+	if err != nil {
+		return fmt.Errorf("failed to change mode of control socket %s - %v", socketPath, err)
+	}
+
+	if len(group) > 0 {
+		groupInfo, err := user.LookupGroup(group)
+		if err != nil {
+			return fmt.Errorf("failed to find group %s for control socket - %v", group, err)
+		}
+
+		gid, err := strconv.Atoi(groupInfo.Gid)
+		if err != nil {
+			return fmt.Errorf("failed to parse gid %s of group %s - %v", groupInfo.Gid, group, err)
+		}
+
+		err = os.Chown(socketPath, -1, gid)
+		if err != nil {
+			return fmt.Errorf("failed to change group of control socket %s to %s - %v", socketPath, group, err)
+		}
+	}
+
+	return nil
+}
+
+// Release stops serving and removes the control socket
+func (server *ControlServer) Release() {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "ControlServer",
+		"function": "Release",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Infof("closing control socket %s", server.socketPath)
+
+	// unix listener removes the socket file on close, unless it is given
+	server.listener.Close()
+	server.waitGroup.Wait()
+}
+
+func (server *ControlServer) serve() {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "ControlServer",
+		"function": "serve",
+	})
+
+	defer server.waitGroup.Done()
+
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				// released
+				return
+			}
+
+			logger.WithError(err).Warn("failed to accept a control connection, will retry")
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		go server.handleConnection(conn)
+	}
+}
+
+func (server *ControlServer) handleConnection(conn net.Conn) {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "ControlServer",
+		"function": "handleConnection",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+	defer conn.Close()
+
+	for {
+		conn.SetDeadline(time.Now().Add(ControlIdleTimeout))
+
+		request := control.Request{}
+		err := control.ReadMessage(conn, &request)
+		if err != nil {
+			if err != io.EOF {
+				logger.WithError(err).Warn("failed to read a control request")
+			}
+			return
+		}
+
+		response := server.handleRequest(&request)
+
+		err = control.WriteMessage(conn, response)
+		if err != nil {
+			logger.WithError(err).Warnf("failed to write a response of a control request %s", request.Command)
+			return
+		}
+	}
+}
+
+func (server *ControlServer) handleRequest(request *control.Request) *control.Response {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "ControlServer",
+		"function": "handleRequest",
+	})
+
+	logger.Debugf("handling a control request %s %s", request.Command, request.Target)
+
+	svc := server.service
+	response := &control.Response{}
+
+	var err error
+	switch request.Command {
+	case control.CommandStatus:
+		response.Status = svc.GetStatus()
+	case control.CommandPause:
+		err = svc.PauseLane(request.Target)
+		response.Message = fmt.Sprintf("paused lane %s", request.Target)
+	case control.CommandResume:
+		err = svc.ResumeLane(request.Target)
+		response.Message = fmt.Sprintf("resumed lane %s", request.Target)
+	case control.CommandScrape:
+		svc.TriggerScrape()
+		response.Message = "triggered scrape"
+	case control.CommandDrain:
+		svc.Drain()
+		response.Message = "draining turn-ins, the service stops when drained"
+	case control.CommandReconnect:
+		err = svc.Reconnect(request.Target)
+		response.Message = fmt.Sprintf("reconnected %s", request.Target)
+	case control.CommandErrors:
+		response.Errors = svc.GetRecentErrors(request.Limit)
+	case control.CommandEnqueue:
+		var item turnin.TurnInItem
+		item, err = svc.Enqueue(request.Item)
+		if err == nil {
+			response.ID = turnin.GetItemID(item)
+			response.FilePath = item.GetItemFilePath()
+		}
+	default:
+		err = NewValidationErrorf("unknown control command %s", request.Command)
+	}
+
+	if err != nil {
+		logger.WithError(err).Errorf("failed to handle a control request %s %s", request.Command, request.Target)
+		return &control.Response{
+			Error:      err.Error(),
+			ErrorClass: getControlErrorClass(err),
+		}
+	}
+
+	logger.Infof("handled a control request %s %s", request.Command, request.Target)
+	return response
+}
+
+// getControlErrorClass returns class of the error occurred while handling a control request
+func getControlErrorClass(err error) string {
+	switch {
+	case turnin.IsCapacityError(err):
+		return string(err.(*turnin.CapacityError).GetKind())
+	case turnin.IsDecodeError(err):
+		return string(turnin.ErrorClassDecode)
+	case IsValidationError(err):
+		return string(turnin.ErrorClassValidation)
+	default:
+		return string(turnin.ErrorClassUnknown)
+	}
+}
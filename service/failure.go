@@ -0,0 +1,158 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/control"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+)
+
+const (
+	// MaxAttemptRecords is the max number of attempts recorded per turn-in, older attempts are dropped
+	MaxAttemptRecords int = 20
+	// MaxRecentErrors is the max number of recent errors kept for the control socket
+	MaxRecentErrors int = 100
+)
+
+// classifyError returns error class of the error occurred while processing the item
+func (svc *AsyncExecCmdService) classifyError(item turnin.TurnInItem, err error) turnin.ErrorClass {
+	if err == nil {
+		return ""
+	}
+
+	switch {
+	case turnin.IsDecodeError(err):
+		return turnin.ErrorClassDecode
+	case IsValidationError(err):
+		return turnin.ErrorClassValidation
+	case IsServiceNotReadyError(err):
+		return turnin.ErrorClassNotReady
+	case IsIRODSError(err):
+		return turnin.ErrorClassIRODS
+	case IsRemoteResponseError(err):
+		statusCode := err.(*RemoteResponseError).GetStatusCode()
+		if statusCode >= http.StatusInternalServerError {
+			return turnin.ErrorClassRemote5xx
+		} else if statusCode >= http.StatusBadRequest {
+			return turnin.ErrorClassRemote4xx
+		}
+		return turnin.ErrorClassRemote
+	case IsMessageOutputError(err):
+		switch err.(*MessageOutputError).GetOutput() {
+		case commons.MessageOutputAMQP:
+			return turnin.ErrorClassAMQP
+		case commons.MessageOutputKafka:
+			return turnin.ErrorClassKafka
+		case commons.MessageOutputNATS:
+			return turnin.ErrorClassNats
+		}
+		return turnin.ErrorClassUnknown
+	}
+
+	// other errors are raised by clients of the destination
+	switch item.GetRequestType() {
+	case turnin.SendMessageRequestType:
+		// errors of message outputs are classified above, others are raised before delivering, e.g., outputs not configured
+		return turnin.ErrorClassNotConfigured
+	case turnin.LinkBisqueRequestType, turnin.RemoveBisqueRequestType, turnin.MoveBisqueRequestType:
+		if svc.bisque == nil {
+			return turnin.ErrorClassNotConfigured
+		}
+		return turnin.ErrorClassRemote
+	case turnin.IRODSMetadataRequestType:
+		return turnin.ErrorClassIRODS
+	default:
+		return turnin.ErrorClassUnknown
+	}
+}
+
+// recordAttempt records an attempt to process the item
+func (svc *AsyncExecCmdService) recordAttempt(item turnin.TurnInItem, err error) {
+	attempt := turnin.AttemptRecord{
+		Time: time.Now(),
+	}
+
+	if err != nil {
+		attempt.Error = err.Error()
+		attempt.ErrorClass = svc.classifyError(item, err)
+	}
+
+	svc.attemptsLock.Lock()
+	defer svc.attemptsLock.Unlock()
+
+	key := item.GetItemFilePath()
+	attempts := append(svc.attempts[key], attempt)
+	if len(attempts) > MaxAttemptRecords {
+		attempts = attempts[len(attempts)-MaxAttemptRecords:]
+	}
+
+	svc.attempts[key] = attempts
+
+	if err != nil {
+		svc.addRecentError(item, attempt)
+	}
+}
+
+// addRecentError keeps the failed attempt as a recent error
+func (svc *AsyncExecCmdService) addRecentError(item turnin.TurnInItem, attempt turnin.AttemptRecord) {
+	record := control.ErrorRecord{
+		Time:        attempt.Time,
+		ID:          turnin.GetItemID(item),
+		RequestID:   item.GetRequestID(),
+		RequestType: string(item.GetRequestType()),
+		Error:       attempt.Error,
+		ErrorClass:  string(attempt.ErrorClass),
+	}
+
+	svc.recentErrorsLock.Lock()
+	defer svc.recentErrorsLock.Unlock()
+
+	recentErrors := append(svc.recentErrors, record)
+	if len(recentErrors) > MaxRecentErrors {
+		recentErrors = recentErrors[len(recentErrors)-MaxRecentErrors:]
+	}
+
+	svc.recentErrors = recentErrors
+}
+
+// GetRecentErrors returns recent errors, newest first, up to limit, 0 for all
+func (svc *AsyncExecCmdService) GetRecentErrors(limit int) []control.ErrorRecord {
+	svc.recentErrorsLock.Lock()
+	defer svc.recentErrorsLock.Unlock()
+
+	records := []control.ErrorRecord{}
+	for idx := len(svc.recentErrors) - 1; idx >= 0; idx-- {
+		if limit > 0 && len(records) >= limit {
+			break
+		}
+
+		records = append(records, svc.recentErrors[idx])
+	}
+
+	return records
+}
+
+// takeAttempts returns attempts recorded for the item and forgets them
+func (svc *AsyncExecCmdService) takeAttempts(item turnin.TurnInItem) []turnin.AttemptRecord {
+	svc.attemptsLock.Lock()
+	defer svc.attemptsLock.Unlock()
+
+	key := item.GetItemFilePath()
+	attempts, ok := svc.attempts[key]
+	if !ok {
+		return []turnin.AttemptRecord{}
+	}
+
+	delete(svc.attempts, key)
+	return attempts
+}
+
+// newFailureRecord creates a failure record of the item with attempts recorded
+func (svc *AsyncExecCmdService) newFailureRecord(item turnin.TurnInItem, err error) *turnin.FailureRecord {
+	record := turnin.NewFailureRecord(item, err, svc.classifyError(item, err))
+	record.ServiceVersion = commons.GetReleaseVersion()
+	record.Attempts = svc.takeAttempts(item)
+	return record
+}
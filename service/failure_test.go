@@ -0,0 +1,46 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+)
+
+func TestClassifyError(t *testing.T) {
+	sendMessage := turnin.NewSendMessageRequest("irods.data-object.add", "{}")
+	linkBisque := turnin.NewLinkBisqueRequest("user", "/zone/home/user/file")
+	irodsMetadata := turnin.NewIRODSMetadataRequest(turnin.IRODSMetadataOperationAdd, "/zone/home/user", nil)
+
+	tests := []struct {
+		name     string
+		item     turnin.TurnInItem
+		err      error
+		expected turnin.ErrorClass
+	}{
+		{name: "no error", item: sendMessage, expected: ""},
+		{name: "validation", item: sendMessage, err: NewValidationErrorf("bad"), expected: turnin.ErrorClassValidation},
+		{name: "not ready", item: sendMessage, err: NewServiceNotReadyErrorf("later"), expected: turnin.ErrorClassNotReady},
+		{name: "amqp", item: sendMessage, err: wrapMessageOutputError(commons.MessageOutputAMQP, errors.New("closed")), expected: turnin.ErrorClassAMQP},
+		{name: "kafka", item: sendMessage, err: wrapMessageOutputError(commons.MessageOutputKafka, errors.New("too large")), expected: turnin.ErrorClassKafka},
+		{name: "nats", item: sendMessage, err: wrapMessageOutputError(commons.MessageOutputNATS, errors.New("no stream")), expected: turnin.ErrorClassNats},
+		{name: "output not ready", item: sendMessage, err: wrapMessageOutputError(commons.MessageOutputKafka, NewServiceNotReadyErrorf("later")), expected: turnin.ErrorClassNotReady},
+		{name: "output validation", item: sendMessage, err: wrapMessageOutputError(commons.MessageOutputNATS, NewValidationErrorf("bad")), expected: turnin.ErrorClassValidation},
+		{name: "output not configured", item: sendMessage, err: errors.New("not configured"), expected: turnin.ErrorClassNotConfigured},
+		{name: "bisque not configured", item: linkBisque, err: errors.New("not configured"), expected: turnin.ErrorClassNotConfigured},
+		{name: "bisque 5xx", item: linkBisque, err: NewRemoteResponseErrorf(503, "unavailable"), expected: turnin.ErrorClassRemote5xx},
+		{name: "irods", item: irodsMetadata, err: errors.New("no such path"), expected: turnin.ErrorClassIRODS},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &AsyncExecCmdService{}
+
+			errorClass := svc.classifyError(test.item, test.err)
+			if errorClass != test.expected {
+				t.Errorf("expected error class %q, got %q", test.expected, errorClass)
+			}
+		})
+	}
+}
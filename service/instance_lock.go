@@ -0,0 +1,141 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// InstanceLock is an exclusive lock held by a running service, not to run two services on the same data root dir
+type InstanceLock struct {
+	lockFile    *os.File
+	pidFilePath string
+}
+
+// AcquireInstanceLock acquires the instance lock and writes the PID file
+// returns InstanceLockedError if another instance holds the lock
+func AcquireInstanceLock(lockFilePath string, pidFilePath string) (*InstanceLock, error) {
+	lockFile, err := os.OpenFile(lockFilePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %s - %v", lockFilePath, err)
+	}
+
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		lockFile.Close()
+
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			pid, _ := readPID(lockFilePath)
+			return nil, NewInstanceLockedErrorf(pid, "another instance of the service (pid %d) is running with lock file %s", pid, lockFilePath)
+		}
+
+		return nil, fmt.Errorf("failed to lock %s - %v", lockFilePath, err)
+	}
+
+	// the lock file also has the pid, to find the holder if the PID file is removed
+	err = writePID(lockFile)
+	if err != nil {
+		lockFile.Close()
+		return nil, fmt.Errorf("failed to write pid to lock file %s - %v", lockFilePath, err)
+	}
+
+	if len(pidFilePath) > 0 {
+		pidFile, err := os.OpenFile(pidFilePath, os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			lockFile.Close()
+			return nil, fmt.Errorf("failed to open PID file %s - %v", pidFilePath, err)
+		}
+
+		err = writePID(pidFile)
+		pidFile.Close()
+		if err != nil {
+			lockFile.Close()
+			return nil, fmt.Errorf("failed to write PID file %s - %v", pidFilePath, err)
+		}
+	}
+
+	return &InstanceLock{
+		lockFile:    lockFile,
+		pidFilePath: pidFilePath,
+	}, nil
+}
+
+// Release removes the PID file and releases the lock
+func (lock *InstanceLock) Release() {
+	if len(lock.pidFilePath) > 0 {
+		// do not remove a PID file replaced by others
+		pid, err := readPID(lock.pidFilePath)
+		if err == nil && pid == os.Getpid() {
+			os.Remove(lock.pidFilePath)
+		}
+	}
+
+	if lock.lockFile != nil {
+		// the lock file is kept, removing it would let two instances lock different files
+		lock.lockFile.Close()
+		lock.lockFile = nil
+	}
+}
+
+// GetInstanceLockHolder returns pid of the instance holding the lock, false if no instance holds the lock
+func GetInstanceLockHolder(lockFilePath string) (int, bool, error) {
+	lockFile, err := os.Open(lockFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to open lock file %s - %v", lockFilePath, err)
+	}
+	defer lockFile.Close()
+
+	// shared lock is enough to test, and does not block others testing
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	if err != nil {
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			pid, _ := readPID(lockFilePath)
+			return pid, true, nil
+		}
+
+		return 0, false, fmt.Errorf("failed to test lock %s - %v", lockFilePath, err)
+	}
+
+	syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+	return 0, false, nil
+}
+
+// ReadPIDFile reads pid from the PID file
+func ReadPIDFile(pidFilePath string) (int, error) {
+	return readPID(pidFilePath)
+}
+
+func readPID(path string) (int, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	pidString := strings.TrimSpace(string(bytes))
+	pid, err := strconv.Atoi(pidString)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse pid %s in %s - %v", pidString, path, err)
+	}
+
+	return pid, nil
+}
+
+func writePID(file *os.File) error {
+	err := file.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteAt([]byte(fmt.Sprintf("%d\n", os.Getpid())), 0)
+	if err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
@@ -0,0 +1,35 @@
+package service
+
+import "fmt"
+
+// InstanceLockedError is an error returned when another instance of the service holds the instance lock
+type InstanceLockedError struct {
+	message string
+	pid     int
+}
+
+// NewInstanceLockedErrorf creates InstanceLockedError struct
+func NewInstanceLockedErrorf(pid int, format string, v ...interface{}) *InstanceLockedError {
+	return &InstanceLockedError{
+		message: fmt.Sprintf(format, v...),
+		pid:     pid,
+	}
+}
+
+func (e *InstanceLockedError) Error() string {
+	return e.message
+}
+
+// GetPID returns pid of the instance holding the lock, 0 if unknown
+func (e *InstanceLockedError) GetPID() int {
+	return e.pid
+}
+
+// IsInstanceLockedError evaluates if the given error is InstanceLockedError
+func IsInstanceLockedError(err error) bool {
+	if _, ok := err.(*InstanceLockedError); ok {
+		return true
+	}
+
+	return false
+}
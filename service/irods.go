@@ -1,15 +1,24 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
 
 	irods_fs "github.com/cyverse/go-irodsclient/fs"
+	irods_common "github.com/cyverse/go-irodsclient/irods/common"
+	irods_connection "github.com/cyverse/go-irodsclient/irods/connection"
+	irods_lowfs "github.com/cyverse/go-irodsclient/irods/fs"
+	irods_message "github.com/cyverse/go-irodsclient/irods/message"
 	irods_types "github.com/cyverse/go-irodsclient/irods/types"
+	irods_util "github.com/cyverse/go-irodsclient/irods/util"
 	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
 
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -105,6 +114,62 @@ func (irods *IRODS) connect() error {
 	return nil
 }
 
+// IsConnected returns true if connected to iRODS
+func (irods *IRODS) IsConnected() bool {
+	irods.connectionLock.Lock()
+	defer irods.connectionLock.Unlock()
+
+	return irods.fsClient != nil
+}
+
+// Reconfigure replaces config and reconnects, waiting for operations in progress
+func (irods *IRODS) Reconfigure(config *commons.IrodsConfig) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "IRODS",
+		"function": "Reconfigure",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Infof("reconfiguring iRODS host %s:%d", config.Host, config.Port)
+
+	irods.connectionLock.Lock()
+	defer irods.connectionLock.Unlock()
+
+	if irods.fsClient != nil {
+		irods.fsClient.Release()
+		irods.fsClient = nil
+	}
+
+	irods.config = config
+
+	return irods.connect()
+}
+
+// Reconnect disconnects from iRODS and connects again immediately, ignoring reconnect interval
+func (irods *IRODS) Reconnect() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "IRODS",
+		"function": "Reconnect",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Infof("reconnecting to iRODS host %s:%d", irods.config.Host, irods.config.Port)
+
+	irods.connectionLock.Lock()
+	defer irods.connectionLock.Unlock()
+
+	if irods.fsClient != nil {
+		irods.fsClient.Release()
+		irods.fsClient = nil
+	}
+
+	return irods.connect()
+}
+
 // Release releases all resources, disconnecting from IRODS
 func (irods *IRODS) Release() {
 	logger := log.WithFields(log.Fields{
@@ -127,11 +192,25 @@ func (irods *IRODS) Release() {
 }
 
 // SetKeyVal sets a new key val to a data object/collection
-func (irods *IRODS) SetKeyVal(irodsPath string, key string, val string) error {
+func (irods *IRODS) SetKeyVal(ctx context.Context, irodsPath string, key string, val string) error {
+	_, span := irods.service.startSpan(ctx, "iRODS SetKeyVal", trace.SpanKindClient,
+		attribute.String("irods.path", irodsPath),
+		attribute.String("irods.meta.key", key),
+	)
+	defer span.End()
+
+	err := irods.setKeyVal(ctx, irodsPath, key, val)
+	commons.SetSpanError(span, err)
+	return err
+}
+
+// setKeyVal sets a new key val to a data object/collection
+func (irods *IRODS) setKeyVal(ctx context.Context, irodsPath string, key string, val string) error {
 	logger := log.WithFields(log.Fields{
-		"package":  "service",
-		"struct":   "IRODS",
-		"function": "SetKeyVal",
+		"package":    "service",
+		"struct":     "IRODS",
+		"function":   "setKeyVal",
+		"request_id": commons.GetRequestIDFromContext(ctx),
 	})
 
 	defer commons.StackTraceFromPanic(logger)
@@ -139,42 +218,280 @@ func (irods *IRODS) SetKeyVal(irodsPath string, key string, val string) error {
 	err := irods.ensureConnected()
 	if err != nil {
 		logger.Error(err)
-		return err
+		return NewIRODSError(err)
 	}
 
 	irods.connectionLock.Lock()
 	defer irods.connectionLock.Unlock()
 
+	if irods.fsClient == nil {
+		// disconnected by reconnect in the middle
+		err = NewServiceNotReadyErrorf("iRODS is disconnected. will retry")
+		logger.Error(err)
+		return err
+	}
+
 	logger.Debugf("trying to set a key/val to an iRODS collection/data-object %s, key: %s", irodsPath, key)
 
 	entry, err := irods.fsClient.Stat(irodsPath)
 	if err != nil {
 		logger.WithError(err).Errorf("failed to find an iRODS collection/data-object %s", irodsPath)
-		return err
+		return NewIRODSError(err)
 	}
 
 	if entry.ID == 0 {
 		err = fmt.Errorf("failed to find an iRODS collection/data-object %s", irodsPath)
 		logger.Error(err)
-		return err
+		return NewIRODSError(err)
 	}
 
 	err = irods.fsClient.AddMetadata(irodsPath, key, val, "")
 	if err != nil {
 		logger.WithError(err).Errorf("failed to set a key/val to an iRODS collection/data-object %s, key: %s", irodsPath, key)
-		return err
+		return NewIRODSError(err)
 	}
 
 	logger.Infof("set a key/val to an iRODS collection/data-object %s, key: %s", irodsPath, key)
 	return nil
 }
 
+// ModifyMetadata applies a metadata operation with AVUs to a data object/collection, and all under the collection if recursive
+func (irods *IRODS) ModifyMetadata(ctx context.Context, irodsPath string, operation turnin.IRODSMetadataOperation, avus []turnin.IRODSAVU, recursive bool) error {
+	_, span := irods.service.startSpan(ctx, "iRODS ModifyMetadata", trace.SpanKindClient,
+		attribute.String("irods.path", irodsPath),
+		attribute.String("irods.meta.operation", string(operation)),
+		attribute.Int("irods.meta.avus", len(avus)),
+		attribute.Bool("irods.meta.recursive", recursive),
+	)
+	defer span.End()
+
+	err := irods.modifyMetadata(ctx, irodsPath, operation, avus, recursive)
+	commons.SetSpanError(span, err)
+	return err
+}
+
+// modifyMetadata applies a metadata operation with AVUs to a data object/collection, and all under the collection if recursive
+// entries are looked up without the cache of the FileSystem Client, they may be made just before the request
+func (irods *IRODS) modifyMetadata(ctx context.Context, irodsPath string, operation turnin.IRODSMetadataOperation, avus []turnin.IRODSAVU, recursive bool) error {
+	logger := log.WithFields(log.Fields{
+		"package":    "service",
+		"struct":     "IRODS",
+		"function":   "modifyMetadata",
+		"request_id": commons.GetRequestIDFromContext(ctx),
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	err := irods.ensureConnected()
+	if err != nil {
+		logger.Error(err)
+		return NewServiceNotReadyErrorf("iRODS is not connected. will retry - %v", err)
+	}
+
+	// hold the lock only to get a connection, not to block other iRODS calls while walking a large collection
+	// if reconnected in the middle, the connection fails and the request is retried
+	irods.connectionLock.Lock()
+	fsClient := irods.fsClient
+	if fsClient == nil {
+		irods.connectionLock.Unlock()
+
+		// disconnected by reconnect in the middle
+		err = NewServiceNotReadyErrorf("iRODS is disconnected. will retry")
+		logger.Error(err)
+		return err
+	}
+
+	conn, err := fsClient.GetMetadataConnection()
+	irods.connectionLock.Unlock()
+	if err != nil {
+		logger.WithError(err).Error("failed to get an iRODS connection for metadata")
+		return NewServiceNotReadyErrorf("failed to get an iRODS connection for metadata. will retry - %v", err)
+	}
+	defer fsClient.ReturnMetadataConnection(conn)
+
+	irodsPath = irods_util.GetCorrectIRODSPath(irodsPath)
+
+	logger.Debugf("trying to %s metadata of an iRODS collection/data-object %s, recursive: %t", operation, irodsPath, recursive)
+
+	itemType, err := getIrodsMetaItemType(conn, irodsPath)
+	if err != nil {
+		err = newIrodsMetadataError(err, "failed to find an iRODS collection/data-object %s", irodsPath)
+		logger.Error(err)
+		return err
+	}
+
+	err = modifyIrodsAVUs(conn, itemType, irodsPath, operation, avus)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	entries := 1
+	if recursive && itemType == irods_types.IRODSCollectionMetaItemType {
+		applied, err := modifyIrodsAVUsUnder(conn, irodsPath, operation, avus, irods.touchAlive)
+		entries += applied
+		if err != nil {
+			logger.WithError(err).Errorf("failed to %s metadata under an iRODS collection %s, applied to %d entries", operation, irodsPath, entries)
+			return err
+		}
+	}
+
+	logger.Infof("applied %s of %d AVUs to %d iRODS collections/data-objects at %s", operation, len(avus), entries, irodsPath)
+	return nil
+}
+
+// getIrodsMetaItemType returns if the path is a collection or a data object
+func getIrodsMetaItemType(conn *irods_connection.IRODSConnection, irodsPath string) (irods_types.IRODSMetaItemType, error) {
+	_, err := irods_lowfs.GetCollection(conn, irodsPath)
+	if err == nil {
+		return irods_types.IRODSCollectionMetaItemType, nil
+	}
+
+	if !irods_types.IsFileNotFoundError(err) {
+		return "", err
+	}
+
+	collection, err := irods_lowfs.GetCollection(conn, irods_util.GetIRODSPathDirname(irodsPath))
+	if err != nil {
+		return "", err
+	}
+
+	_, err = irods_lowfs.GetDataObjectMasterReplica(conn, collection, irods_util.GetIRODSPathFileName(irodsPath))
+	if err != nil {
+		return "", err
+	}
+
+	return irods_types.IRODSDataObjectMetaItemType, nil
+}
+
+// touchAlive marks the scrape loop alive while processing a long request, not to be killed by the watchdog
+func (irods *IRODS) touchAlive() {
+	if irods.service != nil {
+		irods.service.touchAlive()
+	}
+}
+
+// modifyIrodsAVUsUnder applies a metadata operation to all data objects and collections under the collection
+// progress is called after each entry is applied
+// returns the number of entries applied
+func modifyIrodsAVUsUnder(conn *irods_connection.IRODSConnection, collectionPath string, operation turnin.IRODSMetadataOperation, avus []turnin.IRODSAVU, progress func()) (int, error) {
+	collection, err := irods_lowfs.GetCollection(conn, collectionPath)
+	if err != nil {
+		return 0, newIrodsMetadataError(err, "failed to find an iRODS collection %s", collectionPath)
+	}
+
+	dataObjects, err := irods_lowfs.ListDataObjectsMasterReplica(conn, collection)
+	if err != nil {
+		return 0, newIrodsMetadataError(err, "failed to list data-objects of an iRODS collection %s", collectionPath)
+	}
+
+	applied := 0
+	for _, dataObject := range dataObjects {
+		err = modifyIrodsAVUs(conn, irods_types.IRODSDataObjectMetaItemType, dataObject.Path, operation, avus)
+		if err != nil {
+			return applied, err
+		}
+		applied++
+		progress()
+	}
+
+	subCollections, err := irods_lowfs.ListSubCollections(conn, collectionPath)
+	if err != nil {
+		return applied, newIrodsMetadataError(err, "failed to list sub-collections of an iRODS collection %s", collectionPath)
+	}
+
+	for _, subCollection := range subCollections {
+		err = modifyIrodsAVUs(conn, irods_types.IRODSCollectionMetaItemType, subCollection.Path, operation, avus)
+		if err != nil {
+			return applied, err
+		}
+		applied++
+		progress()
+
+		appliedUnder, err := modifyIrodsAVUsUnder(conn, subCollection.Path, operation, avus, progress)
+		applied += appliedUnder
+		if err != nil {
+			return applied, err
+		}
+	}
+
+	return applied, nil
+}
+
+// modifyIrodsAVUs applies a metadata operation with AVUs to a data object/collection
+// operations are idempotent, not to fail when retried after applied partially
+func modifyIrodsAVUs(conn *irods_connection.IRODSConnection, itemType irods_types.IRODSMetaItemType, irodsPath string, operation turnin.IRODSMetadataOperation, avus []turnin.IRODSAVU) error {
+	for _, avu := range avus {
+		request := &irods_message.IRODSMessageModifyMetadataRequest{
+			Operation: string(operation),
+			ItemType:  string(itemType),
+			ItemName:  irodsPath,
+			AttrName:  avu.Attribute,
+			AttrValue: avu.Value,
+			AttrUnits: avu.Unit,
+		}
+
+		if operation == turnin.IRODSMetadataOperationRemoveWildcard && len(avu.Unit) == 0 {
+			// any unit
+			request.AttrUnits = "%"
+		}
+
+		response := irods_message.IRODSMessageModifyMetadataResponse{}
+
+		conn.Lock()
+		err := conn.RequestAndCheck(request, &response, nil)
+		conn.Unlock()
+
+		if err != nil {
+			errorCode := irods_types.GetIRODSErrorCode(err)
+			switch operation {
+			case turnin.IRODSMetadataOperationAdd:
+				if errorCode == irods_common.CATALOG_ALREADY_HAS_ITEM_BY_THAT_NAME {
+					// added already, e.g., by an earlier attempt
+					continue
+				}
+			case turnin.IRODSMetadataOperationRemove, turnin.IRODSMetadataOperationRemoveWildcard:
+				if errorCode == irods_common.CAT_SUCCESS_BUT_WITH_NO_INFO || errorCode == irods_common.CAT_NO_ROWS_FOUND {
+					// removed already, or never added
+					continue
+				}
+			}
+
+			return newIrodsMetadataError(err, "failed to %s metadata of an iRODS collection/data-object %s, attribute: %s", operation, irodsPath, avu.Attribute)
+		}
+	}
+
+	return nil
+}
+
+// newIrodsMetadataError returns IRODSError if iRODS rejects the operation, ServiceNotReadyError to retry if the connection fails
+func newIrodsMetadataError(err error, format string, args ...interface{}) error {
+	message := fmt.Sprintf(format, args...)
+	if irods_types.IsFileNotFoundError(err) || irods_types.GetIRODSErrorCode(err) != 0 {
+		return NewIRODSError(fmt.Errorf("%s - %v", message, err))
+	}
+
+	return NewServiceNotReadyErrorf("%s. will retry - %v", message, err)
+}
+
 // ResolveObjectUUIDIntoPath resolves object uuid into path
-func (irods *IRODS) ResolveObjectUUIDIntoPath(uuid string) (string, error) {
+func (irods *IRODS) ResolveObjectUUIDIntoPath(ctx context.Context, uuid string) (string, error) {
+	_, span := irods.service.startSpan(ctx, "iRODS ResolveObjectUUIDIntoPath", trace.SpanKindClient,
+		attribute.String("irods.uuid", uuid),
+	)
+	defer span.End()
+
+	path, err := irods.resolveObjectUUIDIntoPath(uuid)
+	commons.SetSpanError(span, err)
+	return path, err
+}
+
+// resolveObjectUUIDIntoPath resolves object uuid into path
+func (irods *IRODS) resolveObjectUUIDIntoPath(uuid string) (string, error) {
 	logger := log.WithFields(log.Fields{
 		"package":  "service",
 		"struct":   "IRODS",
-		"function": "ResolveObjectUUIDIntoPath",
+		"function": "resolveObjectUUIDIntoPath",
 	})
 
 	defer commons.StackTraceFromPanic(logger)
@@ -0,0 +1,31 @@
+package service
+
+// IRODSError is an error returned when an iRODS operation fails
+type IRODSError struct {
+	err error
+}
+
+// NewIRODSError creates IRODSError struct
+func NewIRODSError(err error) *IRODSError {
+	return &IRODSError{
+		err: err,
+	}
+}
+
+func (e *IRODSError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the original error
+func (e *IRODSError) Unwrap() error {
+	return e.err
+}
+
+// IsIRODSError evaluates if the given error is IRODSError
+func IsIRODSError(err error) bool {
+	if _, ok := err.(*IRODSError); ok {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+	log "github.com/sirupsen/logrus"
+)
+
+func getRetentionPolicy(config *commons.RetentionPolicyConfig) turnin.RetentionPolicy {
+	return turnin.RetentionPolicy{
+		MaxAge:        config.MaxAge,
+		MaxFileCount:  config.MaxFileCount,
+		MaxTotalBytes: config.MaxTotalBytes,
+		Archive:       config.Archive,
+	}
+}
+
+// CleanUp prunes failed, expired, quarantined and archived turn-ins and results following retention policies
+func (svc *AsyncExecCmdService) CleanUp() {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AsyncExecCmdService",
+		"function": "CleanUp",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	retentionConfig := &svc.getConfig().RetentionConfig
+
+	archivePolicy := getRetentionPolicy(&retentionConfig.Archive)
+	// do not archive archives
+	archivePolicy.Archive = false
+
+	resultPolicy := getRetentionPolicy(&retentionConfig.Results)
+	resultPolicy.Archive = false
+
+	dirPolicies := []struct {
+		dir    string
+		policy turnin.RetentionPolicy
+	}{
+		{svc.turnin.FailedDir, getRetentionPolicy(&retentionConfig.Failed)},
+		{svc.turnin.ExpiredDir, getRetentionPolicy(&retentionConfig.Expired)},
+		{svc.turnin.QuarantineDir, getRetentionPolicy(&retentionConfig.Quarantine)},
+		{svc.turnin.ResultDir, resultPolicy},
+		// archive last, to count archives created above
+		{svc.turnin.ArchiveDir, archivePolicy},
+	}
+
+	for _, dirPolicy := range dirPolicies {
+		if dirPolicy.policy.IsUnlimited() {
+			continue
+		}
+
+		pruned, err := svc.turnin.Prune(dirPolicy.dir, dirPolicy.policy)
+		if err != nil {
+			logger.WithError(err).Errorf("failed to prune turn-ins in %s", dirPolicy.dir)
+			// continue
+		}
+
+		if pruned > 0 {
+			if dirPolicy.policy.Archive {
+				logger.Infof("archived %d turn-ins in %s to %s", pruned, dirPolicy.dir, svc.turnin.ArchiveDir)
+			} else {
+				logger.Infof("deleted %d turn-ins in %s", pruned, dirPolicy.dir)
+			}
+		}
+	}
+}
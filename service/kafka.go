@@ -0,0 +1,545 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+	log "github.com/sirupsen/logrus"
+	"github.com/xdg-go/scram"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// KafkaRequestIDHeader is a record header having the request ID of a send_message turn-in
+	KafkaRequestIDHeader string = "request_id"
+	// KafkaContentTypeHeader is a record header having the content type of the body
+	KafkaContentTypeHeader string = "content-type"
+	// KafkaCorrelationIDHeader is a record header having the correlation ID given
+	KafkaCorrelationIDHeader string = "correlation_id"
+	// KafkaMessageIDHeader is a record header having the message ID given
+	KafkaMessageIDHeader string = "message_id"
+)
+
+// Kafka produces send_message requests to Kafka topics, with an idempotent producer waiting for all in-sync replicas
+type Kafka struct {
+	service              *AsyncExecCmdService
+	config               *commons.KafkaConfig
+	client               sarama.Client
+	producer             sarama.SyncProducer
+	lastConnectTrialTime time.Time
+	connectionLock       sync.Mutex
+}
+
+// CreateKafka creates a Kafka service object and connects to Kafka
+func CreateKafka(service *AsyncExecCmdService, config *commons.KafkaConfig) (*Kafka, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"function": "CreateKafka",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	// invalid configs are not retried
+	_, err := newSaramaConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// lazy connect
+	kafka := &Kafka{
+		service:              service,
+		config:               config,
+		lastConnectTrialTime: time.Time{},
+		connectionLock:       sync.Mutex{},
+	}
+
+	err = kafka.ensureConnected()
+	if err != nil {
+		logger.WithError(err).Warn("will retry again")
+		// ignore error
+	}
+
+	return kafka, nil
+}
+
+// newSaramaConfig creates a producer config, idempotent producer requires acks from all in-sync replicas
+func newSaramaConfig(config *commons.KafkaConfig) (*sarama.Config, error) {
+	version, err := sarama.ParseKafkaVersion(config.GetVersion())
+	if err != nil {
+		return nil, fmt.Errorf("Kafka version %s is not valid - %v", config.GetVersion(), err)
+	}
+
+	timeout := config.GetTimeout()
+
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.ClientID = config.GetClientID()
+	saramaConfig.Version = version
+
+	saramaConfig.Net.DialTimeout = timeout
+	saramaConfig.Net.ReadTimeout = timeout
+	saramaConfig.Net.WriteTimeout = timeout
+	// idempotent producer requires one in-flight request per connection
+	saramaConfig.Net.MaxOpenRequests = 1
+
+	saramaConfig.Producer.Idempotent = true
+	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	saramaConfig.Producer.Timeout = timeout
+	saramaConfig.Producer.Return.Successes = true
+	saramaConfig.Producer.Return.Errors = true
+	saramaConfig.Producer.Partitioner = sarama.NewHashPartitioner
+
+	mechanism, err := config.SASL.GetSASLMechanism()
+	if err != nil {
+		return nil, err
+	}
+
+	if mechanism != commons.KafkaSASLMechanismNone {
+		saramaConfig.Net.SASL.Enable = true
+		saramaConfig.Net.SASL.Handshake = true
+		saramaConfig.Net.SASL.User = config.SASL.Username
+		saramaConfig.Net.SASL.Password = config.SASL.Password
+
+		switch mechanism {
+		case commons.KafkaSASLMechanismPlain:
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case commons.KafkaSASLMechanismSCRAMSHA256:
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &kafkaSCRAMClient{hashGenerator: sha256.New}
+			}
+		case commons.KafkaSASLMechanismSCRAMSHA512:
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &kafkaSCRAMClient{hashGenerator: sha512.New}
+			}
+		}
+	}
+
+	if config.TLS.Enabled {
+		tlsConfig, err := newKafkaTLSConfig(&config.TLS)
+		if err != nil {
+			return nil, err
+		}
+
+		saramaConfig.Net.TLS.Enable = true
+		saramaConfig.Net.TLS.Config = tlsConfig
+	}
+
+	err = saramaConfig.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kafka producer config - %v", err)
+	}
+
+	return saramaConfig, nil
+}
+
+// newKafkaTLSConfig creates a TLS config, loading CA and client certificates given
+func newKafkaTLSConfig(config *commons.KafkaTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	if len(config.CACertPath) > 0 {
+		caCert, err := os.ReadFile(config.CACertPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Kafka CA cert %s - %v", config.CACertPath, err)
+		}
+
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse Kafka CA cert %s", config.CACertPath)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	if len(config.CertPath) > 0 {
+		cert, err := tls.LoadX509KeyPair(config.CertPath, config.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Kafka client cert %s - %v", config.CertPath, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// kafkaSCRAMClient implements sarama.SCRAMClient
+type kafkaSCRAMClient struct {
+	hashGenerator scram.HashGeneratorFcn
+	conversation  *scram.ClientConversation
+}
+
+// Begin starts a SCRAM conversation
+func (client *kafkaSCRAMClient) Begin(username string, password string, authzID string) error {
+	scramClient, err := client.hashGenerator.NewClient(username, password, authzID)
+	if err != nil {
+		return err
+	}
+
+	client.conversation = scramClient.NewConversation()
+	return nil
+}
+
+// Step returns a response to the challenge
+func (client *kafkaSCRAMClient) Step(challenge string) (string, error) {
+	return client.conversation.Step(challenge)
+}
+
+// Done returns true if the conversation is completed
+func (client *kafkaSCRAMClient) Done() bool {
+	return client.conversation.Done()
+}
+
+func (kafka *Kafka) ensureConnected() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "Kafka",
+		"function": "ensureConnected",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	kafka.connectionLock.Lock()
+	defer kafka.connectionLock.Unlock()
+
+	if kafka.client != nil && kafka.client.Closed() {
+		// clear
+		kafka.closeConnection()
+	}
+
+	if kafka.client == nil || kafka.producer == nil {
+		// disconnected - try to connect
+		if time.Now().After(kafka.lastConnectTrialTime.Add(commons.ReconnectInterval)) {
+			// passed reconnect interval
+			return kafka.connect()
+		} else {
+			// too early to reconnect
+			return NewServiceNotReadyErrorf("ignore reconnect request. will try after %f seconds from last trial", commons.ReconnectInterval.Seconds())
+		}
+	}
+
+	return nil
+}
+
+func (kafka *Kafka) connect() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "Kafka",
+		"function": "connect",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	brokers := strings.Join(kafka.config.Brokers, ",")
+	logger.Infof("connecting to Kafka %s", brokers)
+
+	kafka.lastConnectTrialTime = time.Now()
+
+	kafka.client = nil
+	kafka.producer = nil
+
+	saramaConfig, err := newSaramaConfig(kafka.config)
+	if err != nil {
+		logger.WithError(err).Error("failed to create a Kafka producer config")
+		return err
+	}
+
+	client, err := sarama.NewClient(kafka.config.Brokers, saramaConfig)
+	if err != nil {
+		logger.WithError(err).Errorf("failed to connect to %s", brokers)
+		return NewServiceNotReadyErrorf("failed to connect to Kafka %s - %v", brokers, err)
+	}
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		logger.WithError(err).Error("failed to create a producer")
+		return NewServiceNotReadyErrorf("failed to create a Kafka producer - %v", err)
+	}
+
+	kafka.client = client
+	kafka.producer = producer
+
+	logger.Infof("connected to Kafka %s", brokers)
+	return nil
+}
+
+// IsConnected returns true if connected to Kafka and brokers are known
+func (kafka *Kafka) IsConnected() bool {
+	kafka.connectionLock.Lock()
+	defer kafka.connectionLock.Unlock()
+
+	return kafka.client != nil && !kafka.client.Closed() && kafka.producer != nil && len(kafka.client.Brokers()) > 0
+}
+
+// Reconfigure replaces config and reconnects, waiting for messages being produced
+func (kafka *Kafka) Reconfigure(config *commons.KafkaConfig) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "Kafka",
+		"function": "Reconfigure",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Infof("reconfiguring Kafka %s", strings.Join(config.Brokers, ","))
+
+	kafka.connectionLock.Lock()
+	defer kafka.connectionLock.Unlock()
+
+	kafka.closeConnection()
+	kafka.config = config
+
+	return kafka.connect()
+}
+
+// closeConnection closes the producer and the client, connectionLock must be held
+func (kafka *Kafka) closeConnection() {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "Kafka",
+		"function": "closeConnection",
+	})
+
+	if kafka.producer != nil {
+		err := kafka.producer.Close()
+		if err != nil {
+			logger.WithError(err).Warn("failed to close a Kafka producer")
+		}
+		kafka.producer = nil
+	}
+
+	if kafka.client != nil {
+		if !kafka.client.Closed() {
+			kafka.client.Close()
+		}
+		kafka.client = nil
+	}
+}
+
+// Reconnect disconnects from Kafka and connects again immediately, ignoring reconnect interval
+func (kafka *Kafka) Reconnect() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "Kafka",
+		"function": "Reconnect",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Infof("reconnecting to Kafka %s", strings.Join(kafka.config.Brokers, ","))
+
+	kafka.connectionLock.Lock()
+	defer kafka.connectionLock.Unlock()
+
+	kafka.closeConnection()
+
+	return kafka.connect()
+}
+
+// Release releases all resources, disconnecting from Kafka
+func (kafka *Kafka) Release() {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "Kafka",
+		"function": "Release",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Infof("trying to disconnect from %s", strings.Join(kafka.config.Brokers, ","))
+
+	kafka.connectionLock.Lock()
+	defer kafka.connectionLock.Unlock()
+
+	kafka.closeConnection()
+}
+
+// ProcessItem processes a turn-in send_message request, producing a Kafka record to the topic mapped from the key
+func (kafka *Kafka) ProcessItem(ctx context.Context, item turnin.TurnInItem) error {
+	logger := log.WithFields(log.Fields{
+		"package":    "service",
+		"struct":     "Kafka",
+		"function":   "ProcessItem",
+		"request_id": item.GetRequestID(),
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	request, ok := item.(*turnin.SendMessageRequest)
+	if !ok {
+		err := NewValidationErrorf("failed to convert item to SendMessageRequest")
+		logger.Error(err)
+		return err
+	}
+
+	if len(request.Key) == 0 {
+		err := NewValidationErrorf("failed to send a Kafka record due to an empty key")
+		logger.Error(err)
+		return err
+	}
+
+	topic := kafka.config.GetTopic(request.Key)
+	if !commons.IsValidKafkaTopicName(topic) {
+		err := NewValidationErrorf("failed to send a Kafka record with a key %s, topic %s is not a valid topic name", request.Key, topic)
+		logger.Error(err)
+		return err
+	}
+
+	err := kafka.ensureConnected()
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	kafka.connectionLock.Lock()
+	defer kafka.connectionLock.Unlock()
+
+	if kafka.producer == nil {
+		// disconnected by reconnect in the middle
+		err = NewServiceNotReadyErrorf("Kafka is disconnected. will retry")
+		logger.Error(err)
+		return err
+	}
+
+	logger.Debugf("trying to produce a Kafka record with a key %s to topic %s", request.Key, topic)
+
+	ctx, span := kafka.service.startSpan(ctx, "Kafka produce", trace.SpanKindProducer,
+		semconv.MessagingSystemKey.String("kafka"),
+		semconv.MessagingDestinationKey.String(topic),
+		semconv.MessagingKafkaMessageKeyKey.String(request.Key),
+	)
+	defer span.End()
+
+	msg, err := newKafkaProducerMessage(ctx, topic, request)
+	if err != nil {
+		commons.SetSpanError(span, err)
+		logger.Error(err)
+		return err
+	}
+
+	partition, offset, err := kafka.producer.SendMessage(msg)
+	if err != nil {
+		commons.SetSpanError(span, err)
+		logger.WithError(err).Errorf("failed to send a Kafka record with a key %s to topic %s", request.Key, topic)
+
+		if isKafkaRetriableError(err) {
+			return NewServiceNotReadyErrorf("failed to send a Kafka record with a key %s to topic %s, will retry - %v", request.Key, topic, err)
+		}
+		return err
+	}
+
+	logger.Infof("produced a Kafka record with a key %s to topic %s, partition %d, offset %d", request.Key, topic, partition, offset)
+	return nil
+}
+
+// newKafkaProducerMessage creates a record of the request, properties are sent in headers
+// the key of the request is the record key, records with the same key go to the same partition
+func newKafkaProducerMessage(ctx context.Context, topic string, request *turnin.SendMessageRequest) (*sarama.ProducerMessage, error) {
+	contentType := request.ContentType
+	if len(contentType) == 0 {
+		contentType = AMQPContentTypeDefault
+	}
+
+	if turnin.IsJSONContentType(contentType) && !json.Valid([]byte(request.Body)) {
+		return nil, NewValidationErrorf("failed to send a Kafka record with a key %s, body is not a valid JSON for content type %s", request.Key, contentType)
+	}
+
+	headers := kafkaHeaderCarrier{}
+	for key, val := range request.Headers {
+		headers[key] = val
+	}
+
+	headers[KafkaContentTypeHeader] = contentType
+
+	if len(request.CorrelationID) > 0 {
+		headers[KafkaCorrelationIDHeader] = request.CorrelationID
+	}
+
+	if len(request.MessageID) > 0 {
+		headers[KafkaMessageIDHeader] = request.MessageID
+	}
+
+	// set last, not to be overridden by headers given
+	headers[KafkaRequestIDHeader] = request.RequestID
+	injectTraceContext(ctx, headers)
+
+	recordHeaders := []sarama.RecordHeader{}
+	for key, val := range headers {
+		recordHeaders = append(recordHeaders, sarama.RecordHeader{
+			Key:   []byte(key),
+			Value: []byte(val),
+		})
+	}
+
+	return &sarama.ProducerMessage{
+		Topic:     topic,
+		Key:       sarama.StringEncoder(request.Key),
+		Value:     sarama.StringEncoder(request.Body),
+		Headers:   recordHeaders,
+		Timestamp: time.Now(),
+	}, nil
+}
+
+// isKafkaRetriableError returns true if producing may succeed later, e.g., brokers are down or leaders are moving
+func isKafkaRetriableError(err error) bool {
+	if errors.Is(err, sarama.ErrOutOfBrokers) || errors.Is(err, sarama.ErrClosedClient) || errors.Is(err, sarama.ErrNotConnected) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var kafkaErr sarama.KError
+	if errors.As(err, &kafkaErr) {
+		switch kafkaErr {
+		case sarama.ErrLeaderNotAvailable, sarama.ErrNotLeaderForPartition, sarama.ErrRequestTimedOut,
+			sarama.ErrNetworkException, sarama.ErrNotEnoughReplicas, sarama.ErrNotEnoughReplicasAfterAppend,
+			sarama.ErrBrokerNotAvailable, sarama.ErrReplicaNotAvailable, sarama.ErrNotController,
+			sarama.ErrKafkaStorageError:
+			return true
+		}
+	}
+
+	return false
+}
+
+// kafkaHeaderCarrier carries W3C trace context in Kafka record headers
+type kafkaHeaderCarrier map[string]string
+
+// Get returns the value of the key
+func (carrier kafkaHeaderCarrier) Get(key string) string {
+	return carrier[key]
+}
+
+// Set sets the value of the key
+func (carrier kafkaHeaderCarrier) Set(key string, value string) {
+	carrier[key] = value
+}
+
+// Keys returns all keys
+func (carrier kafkaHeaderCarrier) Keys() []string {
+	keys := []string{}
+	for key := range carrier {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+)
+
+// writeTestKafkaCert writes a self-signed cert and its key in PEM, returns their paths
+func writeTestKafkaCert(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	err = os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certPath, keyPath
+}
+
+func TestNewSaramaConfigSASL(t *testing.T) {
+	tests := []struct {
+		name          string
+		mechanism     string
+		expectEnabled bool
+		expected      sarama.SASLMechanism
+		hashSize      int // size of the SCRAM hash, 0 if not SCRAM
+		expectErr     bool
+	}{
+		{name: "none", mechanism: ""},
+		{name: "plain", mechanism: "PLAIN", expectEnabled: true, expected: sarama.SASLTypePlaintext},
+		{name: "scram-sha-256", mechanism: "SCRAM-SHA-256", expectEnabled: true, expected: sarama.SASLTypeSCRAMSHA256, hashSize: 32},
+		{name: "scram-sha-512", mechanism: "SCRAM-SHA-512", expectEnabled: true, expected: sarama.SASLTypeSCRAMSHA512, hashSize: 64},
+		{name: "lower case", mechanism: "scram-sha-512", expectEnabled: true, expected: sarama.SASLTypeSCRAMSHA512, hashSize: 64},
+		{name: "unknown", mechanism: "GSSAPI", expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := commons.NewDefaultKafkaConfig()
+			config.Brokers = []string{"localhost:9092"}
+			config.SASL = commons.KafkaSASLConfig{
+				Mechanism: test.mechanism,
+				Username:  "user",
+				Password:  "password",
+			}
+
+			saramaConfig, err := newSaramaConfig(&config)
+			if test.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+
+			sasl := saramaConfig.Net.SASL
+			if sasl.Enable != test.expectEnabled {
+				t.Fatalf("expected SASL enabled %t, got %t", test.expectEnabled, sasl.Enable)
+			}
+
+			if !test.expectEnabled {
+				return
+			}
+
+			if sasl.Mechanism != test.expected {
+				t.Errorf("expected SASL mechanism %s, got %s", test.expected, sasl.Mechanism)
+			}
+
+			if !sasl.Handshake || sasl.User != "user" || sasl.Password != "password" {
+				t.Errorf("SASL credentials are not set, handshake %t, user %s", sasl.Handshake, sasl.User)
+			}
+
+			if test.hashSize == 0 {
+				if sasl.SCRAMClientGeneratorFunc != nil {
+					t.Error("SCRAM client generator is set for a non-SCRAM mechanism")
+				}
+				return
+			}
+
+			if sasl.SCRAMClientGeneratorFunc == nil {
+				t.Fatal("SCRAM client generator is not set")
+			}
+
+			client, ok := sasl.SCRAMClientGeneratorFunc().(*kafkaSCRAMClient)
+			if !ok {
+				t.Fatal("SCRAM client generator does not make kafkaSCRAMClient")
+			}
+
+			if size := client.hashGenerator().Size(); size != test.hashSize {
+				t.Errorf("expected SCRAM hash size %d, got %d", test.hashSize, size)
+			}
+		})
+	}
+}
+
+func TestNewSaramaConfigTLS(t *testing.T) {
+	certPath, keyPath := writeTestKafkaCert(t)
+
+	badCACertPath := filepath.Join(t.TempDir(), "bad.pem")
+	err := os.WriteFile(badCACertPath, []byte("not a cert"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		tls          commons.KafkaTLSConfig
+		expectCAs    bool
+		expectCerts  int
+		expectVerify bool
+		expectErr    bool
+	}{
+		{name: "disabled", tls: commons.KafkaTLSConfig{CACertPath: "/nonexistent/ca.pem"}},
+		{name: "system CAs", tls: commons.KafkaTLSConfig{Enabled: true}, expectVerify: true},
+		{name: "insecure", tls: commons.KafkaTLSConfig{Enabled: true, InsecureSkipVerify: true}},
+		{name: "CA cert", tls: commons.KafkaTLSConfig{Enabled: true, CACertPath: certPath}, expectCAs: true, expectVerify: true},
+		{name: "mutual TLS", tls: commons.KafkaTLSConfig{Enabled: true, CACertPath: certPath, CertPath: certPath, KeyPath: keyPath}, expectCAs: true, expectCerts: 1, expectVerify: true},
+		{name: "missing CA cert", tls: commons.KafkaTLSConfig{Enabled: true, CACertPath: "/nonexistent/ca.pem"}, expectErr: true},
+		{name: "bad CA cert", tls: commons.KafkaTLSConfig{Enabled: true, CACertPath: badCACertPath}, expectErr: true},
+		{name: "missing key", tls: commons.KafkaTLSConfig{Enabled: true, CertPath: certPath, KeyPath: "/nonexistent/key.pem"}, expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := commons.NewDefaultKafkaConfig()
+			config.Brokers = []string{"localhost:9093"}
+			config.TLS = test.tls
+
+			saramaConfig, err := newSaramaConfig(&config)
+			if test.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+
+			if saramaConfig.Net.TLS.Enable != test.tls.Enabled {
+				t.Fatalf("expected TLS enabled %t, got %t", test.tls.Enabled, saramaConfig.Net.TLS.Enable)
+			}
+
+			if !test.tls.Enabled {
+				if saramaConfig.Net.TLS.Config != nil {
+					t.Error("TLS config is set while TLS is disabled")
+				}
+				return
+			}
+
+			tlsConfig := saramaConfig.Net.TLS.Config
+			if tlsConfig == nil {
+				t.Fatal("TLS config is not set")
+			}
+
+			if tlsConfig.MinVersion != tls.VersionTLS12 {
+				t.Errorf("expected min TLS version 1.2, got %x", tlsConfig.MinVersion)
+			}
+
+			if tlsConfig.InsecureSkipVerify == test.expectVerify {
+				t.Errorf("expected InsecureSkipVerify %t, got %t", !test.expectVerify, tlsConfig.InsecureSkipVerify)
+			}
+
+			if (tlsConfig.RootCAs != nil) != test.expectCAs {
+				t.Errorf("expected root CAs set %t", test.expectCAs)
+			}
+
+			if len(tlsConfig.Certificates) != test.expectCerts {
+				t.Errorf("expected %d client certs, got %d", test.expectCerts, len(tlsConfig.Certificates))
+			}
+		})
+	}
+}
+
+func TestNewSaramaConfigProducer(t *testing.T) {
+	tests := []struct {
+		name            string
+		version         string
+		timeout         time.Duration
+		expectedVersion sarama.KafkaVersion
+		expectedTimeout time.Duration
+		expectErr       bool
+	}{
+		{name: "defaults", expectedVersion: sarama.V2_1_0_0, expectedTimeout: commons.KafkaTimeoutDefault},
+		{name: "version and timeout", version: "2.8.0", timeout: 5 * time.Second, expectedVersion: sarama.V2_8_0_0, expectedTimeout: 5 * time.Second},
+		{name: "invalid version", version: "two", expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := commons.KafkaConfig{
+				Brokers: []string{"localhost:9092"},
+				Version: test.version,
+				Timeout: test.timeout,
+			}
+
+			saramaConfig, err := newSaramaConfig(&config)
+			if test.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+
+			if saramaConfig.Version != test.expectedVersion {
+				t.Errorf("expected version %s, got %s", test.expectedVersion, saramaConfig.Version)
+			}
+
+			if saramaConfig.ClientID != commons.KafkaClientIDDefault {
+				t.Errorf("expected client ID %s, got %s", commons.KafkaClientIDDefault, saramaConfig.ClientID)
+			}
+
+			// idempotent producer
+			if !saramaConfig.Producer.Idempotent {
+				t.Error("producer is not idempotent")
+			}
+
+			if saramaConfig.Producer.RequiredAcks != sarama.WaitForAll {
+				t.Errorf("expected required acks WaitForAll, got %d", saramaConfig.Producer.RequiredAcks)
+			}
+
+			if saramaConfig.Net.MaxOpenRequests != 1 {
+				t.Errorf("expected max open requests 1, got %d", saramaConfig.Net.MaxOpenRequests)
+			}
+
+			if !saramaConfig.Producer.Return.Successes || !saramaConfig.Producer.Return.Errors {
+				t.Error("producer does not return successes and errors")
+			}
+
+			timeouts := []time.Duration{saramaConfig.Net.DialTimeout, saramaConfig.Net.ReadTimeout, saramaConfig.Net.WriteTimeout, saramaConfig.Producer.Timeout}
+			for _, timeout := range timeouts {
+				if timeout != test.expectedTimeout {
+					t.Errorf("expected timeout %s, got %s", test.expectedTimeout, timeout)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"github.com/cyverse/irods-rule-async-exec-cmd/control"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetLanes returns all lanes, turn-ins in different lanes are processed in parallel
+func GetLanes() []string {
+	return []string{
+		control.LaneSendMessage,
+		control.LaneBisque,
+		control.LaneIRODS,
+	}
+}
+
+// getItemLane returns a lane that processes the item, empty if unknown
+func getItemLane(item turnin.TurnInItem) string {
+	if turnin.IsItemTypeSendMessage(item) {
+		return control.LaneSendMessage
+	} else if turnin.IsItemTypeBisque(item) {
+		return control.LaneBisque
+	} else if turnin.IsItemTypeIRODS(item) {
+		return control.LaneIRODS
+	}
+	return ""
+}
+
+// getTargetLanes returns lanes selected by the target
+func getTargetLanes(target string) ([]string, error) {
+	if target == control.LaneAll {
+		return GetLanes(), nil
+	}
+
+	for _, lane := range GetLanes() {
+		if lane == target {
+			return []string{lane}, nil
+		}
+	}
+
+	return nil, NewValidationErrorf("unknown lane %s", target)
+}
+
+// PauseLane pauses processing turn-ins in the lane, turn-ins are left in the turn in dir
+func (svc *AsyncExecCmdService) PauseLane(target string) error {
+	return svc.setLanePaused(target, true)
+}
+
+// ResumeLane resumes processing turn-ins in the lane
+func (svc *AsyncExecCmdService) ResumeLane(target string) error {
+	err := svc.setLanePaused(target, false)
+	if err != nil {
+		return err
+	}
+
+	svc.TriggerScrape()
+	return nil
+}
+
+func (svc *AsyncExecCmdService) setLanePaused(target string, paused bool) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AsyncExecCmdService",
+		"function": "setLanePaused",
+	})
+
+	lanes, err := getTargetLanes(target)
+	if err != nil {
+		return err
+	}
+
+	svc.pausedLanesLock.Lock()
+	defer svc.pausedLanesLock.Unlock()
+
+	for _, lane := range lanes {
+		if paused {
+			logger.Infof("pausing lane %s", lane)
+			svc.pausedLanes[lane] = true
+		} else {
+			logger.Infof("resuming lane %s", lane)
+			delete(svc.pausedLanes, lane)
+		}
+	}
+
+	return nil
+}
+
+// IsLanePaused returns true if the lane is paused
+func (svc *AsyncExecCmdService) IsLanePaused(lane string) bool {
+	svc.pausedLanesLock.Lock()
+	defer svc.pausedLanesLock.Unlock()
+
+	return svc.pausedLanes[lane]
+}
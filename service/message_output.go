@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+	log "github.com/sirupsen/logrus"
+)
+
+// sendMessage delivers a send_message request to all message outputs selected
+// outputs the request is delivered to are remembered while the request is retried, not to deliver it twice
+func (svc *AsyncExecCmdService) sendMessage(ctx context.Context, request *turnin.SendMessageRequest) error {
+	logger := log.WithFields(log.Fields{
+		"package":    "service",
+		"struct":     "AsyncExecCmdService",
+		"function":   "sendMessage",
+		"request_id": request.GetRequestID(),
+	})
+
+	outputs, err := svc.getConfig().GetMessageOutputs()
+	if err != nil {
+		return err
+	}
+
+	for _, output := range outputs {
+		if svc.isDeliveredToOutput(request, output) {
+			logger.Debugf("skipping message output %s, delivered in an earlier attempt", output)
+			continue
+		}
+
+		switch output {
+		case commons.MessageOutputAMQP:
+			amqp, exchange, routeErr := svc.routeSendMessage(request)
+			if routeErr != nil {
+				err = routeErr
+				break
+			}
+
+			logger.Debugf("Sending an AMQP request to destination %s", amqp.GetName())
+			err = wrapMessageOutputError(output, amqp.ProcessItem(ctx, request, exchange))
+		case commons.MessageOutputKafka:
+			if svc.kafka == nil {
+				err = fmt.Errorf("failed to send a send_message request because Kafka is not configured")
+				break
+			}
+
+			logger.Debug("Sending a Kafka request")
+			err = wrapMessageOutputError(output, svc.kafka.ProcessItem(ctx, request))
+		case commons.MessageOutputNATS:
+			if svc.nats == nil {
+				err = fmt.Errorf("failed to send a send_message request because NATS is not configured")
+				break
+			}
+
+			logger.Debug("Sending a NATS request")
+			err = wrapMessageOutputError(output, svc.nats.ProcessItem(ctx, request))
+		default:
+			err = NewValidationErrorf("failed to send a send_message request to unknown message output %s", output)
+		}
+
+		if err != nil {
+			if !IsServiceNotReadyError(err) {
+				// not retried
+				svc.forgetDeliveredOutputs(request)
+			}
+			return err
+		}
+
+		svc.setDeliveredToOutput(request, output)
+	}
+
+	svc.forgetDeliveredOutputs(request)
+	return nil
+}
+
+// wrapMessageOutputError wraps an error raised by the client of the message output, to classify it by the output
+// errors classified already, e.g., not ready to retry, are returned as they are
+func wrapMessageOutputError(output commons.MessageOutput, err error) error {
+	if err == nil || IsServiceNotReadyError(err) || IsValidationError(err) || IsRemoteResponseError(err) {
+		return err
+	}
+
+	return NewMessageOutputError(output, err)
+}
+
+// hasMessageOutputs returns true if the service has components of all message outputs selected
+func (svc *AsyncExecCmdService) hasMessageOutputs(config *commons.ServerConfig) bool {
+	if config.HasMessageOutput(commons.MessageOutputAMQP) && svc.amqp == nil {
+		return false
+	}
+
+	if config.HasMessageOutput(commons.MessageOutputKafka) && svc.kafka == nil {
+		return false
+	}
+
+	if config.HasMessageOutput(commons.MessageOutputNATS) && svc.nats == nil {
+		return false
+	}
+
+	return true
+}
+
+// getDeliveredOutputsKey returns a key of outputs the request is delivered to
+func getDeliveredOutputsKey(item turnin.TurnInItem) string {
+	if len(item.GetItemFilePath()) > 0 {
+		return item.GetItemFilePath()
+	}
+	return item.GetRequestID()
+}
+
+func (svc *AsyncExecCmdService) isDeliveredToOutput(item turnin.TurnInItem, output commons.MessageOutput) bool {
+	svc.deliveredOutputsLock.Lock()
+	defer svc.deliveredOutputsLock.Unlock()
+
+	return svc.deliveredOutputs[getDeliveredOutputsKey(item)][output]
+}
+
+func (svc *AsyncExecCmdService) setDeliveredToOutput(item turnin.TurnInItem, output commons.MessageOutput) {
+	svc.deliveredOutputsLock.Lock()
+	defer svc.deliveredOutputsLock.Unlock()
+
+	key := getDeliveredOutputsKey(item)
+	if _, ok := svc.deliveredOutputs[key]; !ok {
+		svc.deliveredOutputs[key] = map[commons.MessageOutput]bool{}
+	}
+	svc.deliveredOutputs[key][output] = true
+}
+
+// forgetDeliveredOutputs forgets outputs the request is delivered to, once the request is done
+func (svc *AsyncExecCmdService) forgetDeliveredOutputs(item turnin.TurnInItem) {
+	svc.deliveredOutputsLock.Lock()
+	defer svc.deliveredOutputsLock.Unlock()
+
+	delete(svc.deliveredOutputs, getDeliveredOutputsKey(item))
+}
@@ -0,0 +1,40 @@
+package service
+
+import "github.com/cyverse/irods-rule-async-exec-cmd/commons"
+
+// MessageOutputError is an error returned when a message output fails to deliver a send_message request
+type MessageOutputError struct {
+	output commons.MessageOutput
+	err    error
+}
+
+// NewMessageOutputError creates MessageOutputError struct
+func NewMessageOutputError(output commons.MessageOutput, err error) *MessageOutputError {
+	return &MessageOutputError{
+		output: output,
+		err:    err,
+	}
+}
+
+func (e *MessageOutputError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the original error
+func (e *MessageOutputError) Unwrap() error {
+	return e.err
+}
+
+// GetOutput returns the message output failed
+func (e *MessageOutputError) GetOutput() commons.MessageOutput {
+	return e.output
+}
+
+// IsMessageOutputError evaluates if the given error is MessageOutputError
+func IsMessageOutputError(err error) bool {
+	if _, ok := err.(*MessageOutputError); ok {
+		return true
+	}
+
+	return false
+}
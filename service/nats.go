@@ -0,0 +1,419 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// NatsRequestIDHeader is a message header having the request ID of a send_message turn-in
+	NatsRequestIDHeader string = "request_id"
+	// NatsContentTypeHeader is a message header having the content type of the body
+	NatsContentTypeHeader string = "Content-Type"
+	// NatsCorrelationIDHeader is a message header having the correlation ID given
+	NatsCorrelationIDHeader string = "correlation_id"
+	// NatsReconnectWait is the wait between reconnect trials of NATS client, it reconnects by itself once connected
+	NatsReconnectWait time.Duration = 2 * time.Second
+)
+
+// Nats publishes send_message requests to NATS JetStream, with deduplication IDs
+type Nats struct {
+	service              *AsyncExecCmdService
+	config               *commons.NatsConfig
+	connection           *nats.Conn
+	jetstream            nats.JetStreamContext
+	lastConnectTrialTime time.Time
+	connectionLock       sync.Mutex
+}
+
+// CreateNats creates a NATS service object and connects to NATS
+func CreateNats(service *AsyncExecCmdService, config *commons.NatsConfig) (*Nats, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"function": "CreateNats",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	// lazy connect
+	natsClient := &Nats{
+		service:              service,
+		config:               config,
+		lastConnectTrialTime: time.Time{},
+		connectionLock:       sync.Mutex{},
+	}
+
+	err := natsClient.ensureConnected()
+	if err != nil {
+		logger.WithError(err).Warn("will retry again")
+		// ignore error
+	}
+
+	return natsClient, nil
+}
+
+// connectNats connects to NATS, the connection reconnects by itself once connected
+func connectNats(config *commons.NatsConfig, purpose string) (*nats.Conn, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"function": "connectNats",
+	})
+
+	url := commons.RedactNatsURL(config.URL)
+
+	options := []nats.Option{
+		nats.Name(config.GetName()),
+		nats.Timeout(config.GetTimeout()),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(NatsReconnectWait),
+		nats.DisconnectErrHandler(func(conn *nats.Conn, err error) {
+			if err != nil {
+				logger.WithError(err).Warnf("NATS %s is disconnected from %s, reconnecting", purpose, url)
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			logger.Infof("NATS %s is reconnected to %s", purpose, commons.RedactURL(conn.ConnectedUrl()))
+		}),
+	}
+
+	if len(config.CredsFile) > 0 {
+		options = append(options, nats.UserCredentials(config.CredsFile))
+	}
+
+	if len(config.CACertPath) > 0 {
+		options = append(options, nats.RootCAs(config.CACertPath))
+	}
+
+	if len(config.CertPath) > 0 {
+		options = append(options, nats.ClientCert(config.CertPath, config.KeyPath))
+	}
+
+	connection, err := nats.Connect(config.URL, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS %s - %v", url, err)
+	}
+
+	return connection, nil
+}
+
+func (natsClient *Nats) ensureConnected() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "Nats",
+		"function": "ensureConnected",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	natsClient.connectionLock.Lock()
+	defer natsClient.connectionLock.Unlock()
+
+	if natsClient.connection != nil && natsClient.connection.IsClosed() {
+		// clear
+		natsClient.connection = nil
+		natsClient.jetstream = nil
+	}
+
+	if natsClient.connection == nil || natsClient.jetstream == nil {
+		// disconnected - try to connect
+		if time.Now().After(natsClient.lastConnectTrialTime.Add(commons.ReconnectInterval)) {
+			// passed reconnect interval
+			return natsClient.connect()
+		} else {
+			// too early to reconnect
+			return NewServiceNotReadyErrorf("ignore reconnect request. will try after %f seconds from last trial", commons.ReconnectInterval.Seconds())
+		}
+	}
+
+	return nil
+}
+
+func (natsClient *Nats) connect() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "Nats",
+		"function": "connect",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Infof("connecting to NATS %s", commons.RedactNatsURL(natsClient.config.URL))
+
+	natsClient.lastConnectTrialTime = time.Now()
+
+	natsClient.connection = nil
+	natsClient.jetstream = nil
+
+	connection, err := connectNats(natsClient.config, "publisher")
+	if err != nil {
+		logger.Error(err)
+		return NewServiceNotReadyErrorf("%v", err)
+	}
+
+	jetstream, err := connection.JetStream(nats.MaxWait(natsClient.config.GetTimeout()))
+	if err != nil {
+		connection.Close()
+		logger.WithError(err).Error("failed to get a JetStream context")
+		return err
+	}
+
+	natsClient.connection = connection
+	natsClient.jetstream = jetstream
+
+	logger.Infof("connected to NATS %s", commons.RedactURL(connection.ConnectedUrl()))
+	return nil
+}
+
+// IsConnected returns true if connected to NATS
+func (natsClient *Nats) IsConnected() bool {
+	natsClient.connectionLock.Lock()
+	defer natsClient.connectionLock.Unlock()
+
+	return natsClient.connection != nil && natsClient.connection.IsConnected() && natsClient.jetstream != nil
+}
+
+// Reconfigure replaces config and reconnects, waiting for messages being published
+func (natsClient *Nats) Reconfigure(config *commons.NatsConfig) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "Nats",
+		"function": "Reconfigure",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Infof("reconfiguring NATS %s", commons.RedactNatsURL(config.URL))
+
+	natsClient.connectionLock.Lock()
+	defer natsClient.connectionLock.Unlock()
+
+	natsClient.closeConnection()
+	natsClient.config = config
+
+	return natsClient.connect()
+}
+
+// closeConnection closes the connection, connectionLock must be held
+func (natsClient *Nats) closeConnection() {
+	if natsClient.connection != nil && !natsClient.connection.IsClosed() {
+		natsClient.connection.Close()
+	}
+
+	natsClient.connection = nil
+	natsClient.jetstream = nil
+}
+
+// Reconnect disconnects from NATS and connects again immediately, ignoring reconnect interval
+func (natsClient *Nats) Reconnect() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "Nats",
+		"function": "Reconnect",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Infof("reconnecting to NATS %s", commons.RedactNatsURL(natsClient.config.URL))
+
+	natsClient.connectionLock.Lock()
+	defer natsClient.connectionLock.Unlock()
+
+	natsClient.closeConnection()
+
+	return natsClient.connect()
+}
+
+// Release releases all resources, disconnecting from NATS
+func (natsClient *Nats) Release() {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "Nats",
+		"function": "Release",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Infof("trying to disconnect from %s", commons.RedactNatsURL(natsClient.config.URL))
+
+	natsClient.connectionLock.Lock()
+	defer natsClient.connectionLock.Unlock()
+
+	natsClient.closeConnection()
+}
+
+// ProcessItem processes a turn-in send_message request, publishing a JetStream message to the subject mapped from the key
+// the message ID, or the request ID if not given, is the deduplication ID, JetStream drops messages published twice in its duplicate window
+func (natsClient *Nats) ProcessItem(ctx context.Context, item turnin.TurnInItem) error {
+	logger := log.WithFields(log.Fields{
+		"package":    "service",
+		"struct":     "Nats",
+		"function":   "ProcessItem",
+		"request_id": item.GetRequestID(),
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	request, ok := item.(*turnin.SendMessageRequest)
+	if !ok {
+		err := NewValidationErrorf("failed to convert item to SendMessageRequest")
+		logger.Error(err)
+		return err
+	}
+
+	if len(request.Key) == 0 {
+		err := NewValidationErrorf("failed to send a NATS message due to an empty key")
+		logger.Error(err)
+		return err
+	}
+
+	subject := natsClient.config.GetSubject(request.Key)
+	if !commons.IsValidNatsSubject(subject) {
+		err := NewValidationErrorf("failed to send a NATS message with a key %s, subject %s is not a valid subject", request.Key, subject)
+		logger.Error(err)
+		return err
+	}
+
+	err := natsClient.ensureConnected()
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	natsClient.connectionLock.Lock()
+	defer natsClient.connectionLock.Unlock()
+
+	if natsClient.jetstream == nil {
+		// disconnected by reconnect in the middle
+		err = NewServiceNotReadyErrorf("NATS is disconnected. will retry")
+		logger.Error(err)
+		return err
+	}
+
+	logger.Debugf("trying to publish a NATS message to subject %s", subject)
+
+	ctx, span := natsClient.service.startSpan(ctx, "NATS publish", trace.SpanKindProducer,
+		semconv.MessagingSystemKey.String("nats"),
+		semconv.MessagingDestinationKey.String(subject),
+	)
+	defer span.End()
+
+	msg, err := newNatsMsg(ctx, subject, request)
+	if err != nil {
+		commons.SetSpanError(span, err)
+		logger.Error(err)
+		return err
+	}
+
+	dedupID := getNatsDedupID(request)
+	publishOptions := []nats.PubOpt{
+		nats.MsgId(dedupID),
+		nats.AckWait(natsClient.config.GetTimeout()),
+	}
+
+	if len(natsClient.config.Stream) > 0 {
+		publishOptions = append(publishOptions, nats.ExpectStream(natsClient.config.Stream))
+	}
+
+	ack, err := natsClient.jetstream.PublishMsg(msg, publishOptions...)
+	if err != nil {
+		commons.SetSpanError(span, err)
+		logger.WithError(err).Errorf("failed to send a NATS message to subject %s", subject)
+
+		if isNatsRetriableError(err) {
+			return NewServiceNotReadyErrorf("failed to send a NATS message to subject %s, will retry - %v", subject, err)
+		}
+		return err
+	}
+
+	if ack.Duplicate {
+		logger.Infof("NATS message with deduplication ID %s to subject %s is already in stream %s, dropped as duplicate", dedupID, subject, ack.Stream)
+		return nil
+	}
+
+	logger.Infof("published a NATS message to subject %s, stream %s, sequence %d", subject, ack.Stream, ack.Sequence)
+	return nil
+}
+
+// getNatsDedupID returns the deduplication ID of the request, the message ID given or the request ID
+func getNatsDedupID(request *turnin.SendMessageRequest) string {
+	if len(request.MessageID) > 0 {
+		return request.MessageID
+	}
+
+	if len(request.RequestID) > 0 {
+		return request.RequestID
+	}
+
+	// items written by old clients do not have request IDs
+	return turnin.GetItemID(request)
+}
+
+// newNatsMsg creates a message of the request, properties are sent in headers
+func newNatsMsg(ctx context.Context, subject string, request *turnin.SendMessageRequest) (*nats.Msg, error) {
+	contentType := request.ContentType
+	if len(contentType) == 0 {
+		contentType = AMQPContentTypeDefault
+	}
+
+	if turnin.IsJSONContentType(contentType) && !json.Valid([]byte(request.Body)) {
+		return nil, NewValidationErrorf("failed to send a NATS message with a key %s, body is not a valid JSON for content type %s", request.Key, contentType)
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = []byte(request.Body)
+
+	for key, val := range request.Headers {
+		msg.Header.Set(key, val)
+	}
+
+	msg.Header.Set(NatsContentTypeHeader, contentType)
+
+	if len(request.CorrelationID) > 0 {
+		msg.Header.Set(NatsCorrelationIDHeader, request.CorrelationID)
+	}
+
+	// set last, not to be overridden by headers given
+	msg.Header.Set(NatsRequestIDHeader, request.RequestID)
+	injectTraceContext(ctx, natsHeaderCarrier(msg.Header))
+
+	return msg, nil
+}
+
+// isNatsRetriableError returns true if publishing may succeed later, e.g., servers are down or reconnecting
+func isNatsRetriableError(err error) bool {
+	return errors.Is(err, nats.ErrTimeout) || errors.Is(err, nats.ErrNoResponders) || errors.Is(err, nats.ErrConnectionClosed) ||
+		errors.Is(err, nats.ErrConnectionReconnecting) || errors.Is(err, nats.ErrDisconnected) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// natsHeaderCarrier carries W3C trace context in NATS message headers
+type natsHeaderCarrier nats.Header
+
+// Get returns the value of the key
+func (carrier natsHeaderCarrier) Get(key string) string {
+	return nats.Header(carrier).Get(key)
+}
+
+// Set sets the value of the key
+func (carrier natsHeaderCarrier) Set(key string, value string) {
+	nats.Header(carrier).Set(key, value)
+}
+
+// Keys returns all keys
+func (carrier natsHeaderCarrier) Keys() []string {
+	keys := []string{}
+	for key := range carrier {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	amqp_mod "github.com/streadway/amqp"
+)
+
+// NatsConsumer consumes iRODS events from NATS JetStream with a durable consumer, and passes them to the handler as AMQP deliveries
+// it connects again with backoff until subscribed, then the NATS client reconnects and resubscribes by itself
+type NatsConsumer struct {
+	service      *AsyncExecCmdService
+	config       *commons.NatsConfig
+	consumerName string
+	eventHandler AmqpEventHandler
+
+	connection       *nats.Conn
+	subscription     *nats.Subscription
+	consumeStartTime time.Time
+	lastDeliveryTime time.Time
+	lastError        error
+	stateLock        sync.Mutex
+	reconnectChan    chan bool
+	terminateChan    chan bool
+	terminateOnce    sync.Once
+	waitGroup        sync.WaitGroup
+}
+
+// CreateNatsConsumer creates a NATS consumer, call Start to consume
+func CreateNatsConsumer(service *AsyncExecCmdService, config *commons.NatsConfig, consumerName string, handler AmqpEventHandler) *NatsConsumer {
+	return &NatsConsumer{
+		service:       service,
+		config:        config,
+		consumerName:  consumerName,
+		eventHandler:  handler,
+		reconnectChan: make(chan bool, 1),
+		terminateChan: make(chan bool),
+	}
+}
+
+// Start starts consuming in background, connecting to NATS and reconnecting when closed
+func (consumer *NatsConsumer) Start() {
+	consumer.waitGroup.Add(1)
+	go func() {
+		defer consumer.waitGroup.Done()
+		consumer.run()
+	}()
+}
+
+func (consumer *NatsConsumer) run() {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "NatsConsumer",
+		"function": "run",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	backoff := EventConsumerBackoffMin
+	for {
+		consumed, err := consumer.consumeOnce()
+		consumer.setSubscription(nil, nil, err)
+
+		if consumed {
+			// subscribed successfully, start over
+			backoff = EventConsumerBackoffMin
+		}
+
+		select {
+		case <-consumer.terminateChan:
+			return
+		case <-consumer.reconnectChan:
+			// reconnect immediately
+			backoff = EventConsumerBackoffMin
+			continue
+		default:
+		}
+
+		if err != nil {
+			logger.WithError(err).Warnf("NATS consumer is not subscribed, will reconnect after %s", backoff.String())
+		}
+
+		select {
+		case <-consumer.terminateChan:
+			return
+		case <-consumer.reconnectChan:
+			backoff = EventConsumerBackoffMin
+		case <-time.After(backoff):
+			backoff *= 2
+			if backoff > EventConsumerBackoffMax {
+				backoff = EventConsumerBackoffMax
+			}
+		}
+	}
+}
+
+// consumeOnce connects to NATS and consumes events until the connection is closed
+// returns true if it subscribed, with an error that stopped consuming
+// returns nil error if asked to terminate or reconnect
+func (consumer *NatsConsumer) consumeOnce() (bool, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "NatsConsumer",
+		"function": "consumeOnce",
+	})
+
+	config, consumerName := consumer.getConfig()
+
+	logger.Infof("connecting NATS consumer to %s", commons.RedactNatsURL(config.URL))
+
+	connection, err := connectNats(config, "consumer")
+	if err != nil {
+		return false, err
+	}
+	defer connection.Close()
+
+	closedChan := make(chan bool)
+	connection.SetClosedHandler(func(conn *nats.Conn) {
+		close(closedChan)
+	})
+
+	jetstream, err := connection.JetStream(nats.MaxWait(config.GetTimeout()))
+	if err != nil {
+		return false, fmt.Errorf("failed to get a JetStream context - %v", err)
+	}
+
+	subjects := config.GetEventSubjects()
+	subscribeOptions := []nats.SubOpt{
+		nats.Durable(consumerName),
+		nats.ManualAck(),
+		nats.AckExplicit(),
+		// events before the durable consumer is created are not interested
+		nats.DeliverNew(),
+	}
+
+	if len(config.EventStream) > 0 {
+		subscribeOptions = append(subscribeOptions, nats.BindStream(config.EventStream))
+	}
+
+	subscription, err := jetstream.Subscribe(subjects, func(msg *nats.Msg) {
+		consumer.handleMsg(config, msg)
+	}, subscribeOptions...)
+	if err != nil {
+		return false, fmt.Errorf("failed to subscribe to %s with durable consumer %s - %v", subjects, consumerName, err)
+	}
+
+	consumer.setSubscription(connection, subscription, nil)
+	logger.Infof("NATS consumer is connected to %s, consuming %s with durable consumer %s", commons.RedactURL(connection.ConnectedUrl()), subjects, consumerName)
+
+	select {
+	case <-consumer.terminateChan:
+		// do not unsubscribe, it deletes the durable consumer. resume from the last event acked on restart
+		return true, nil
+	case <-consumer.reconnectChan:
+		logger.Info("reconnecting NATS consumer")
+		// let run loop reconnect immediately
+		consumer.reconnectChan <- true
+		return true, nil
+	case <-closedChan:
+		lastErr := connection.LastError()
+		if lastErr == nil {
+			lastErr = nats.ErrConnectionClosed
+		}
+		return true, fmt.Errorf("NATS connection is closed - %v", lastErr)
+	}
+}
+
+// handleMsg passes an iRODS event to the handler, routing key is the subject without the event subject prefix
+func (consumer *NatsConsumer) handleMsg(config *commons.NatsConfig, msg *nats.Msg) {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "NatsConsumer",
+		"function": "handleMsg",
+	})
+
+	consumer.setLastDeliveryTime(time.Now())
+
+	delivery := amqp_mod.Delivery{
+		Headers:     amqp_mod.Table{},
+		ContentType: msg.Header.Get(NatsContentTypeHeader),
+		MessageId:   msg.Header.Get(nats.MsgIdHdr),
+		RoutingKey:  config.GetEventRoutingKey(msg.Subject),
+		Body:        msg.Data,
+	}
+
+	for key := range msg.Header {
+		delivery.Headers[key] = msg.Header.Get(key)
+	}
+
+	metadata, err := msg.Metadata()
+	if err == nil {
+		delivery.Timestamp = metadata.Timestamp
+		delivery.Redelivered = metadata.NumDelivered > 1
+	}
+
+	logger.Debugf("consumed a message %s from NATS", delivery.RoutingKey)
+	// pass to handlers registered
+	if consumer.eventHandler != nil {
+		consumer.eventHandler(delivery)
+	}
+
+	err = msg.Ack()
+	if err != nil {
+		logger.WithError(err).Warnf("failed to ack a NATS message %s, it will be redelivered", msg.Subject)
+	}
+}
+
+func (consumer *NatsConsumer) getConfig() (*commons.NatsConfig, string) {
+	consumer.stateLock.Lock()
+	defer consumer.stateLock.Unlock()
+
+	return consumer.config, consumer.consumerName
+}
+
+func (consumer *NatsConsumer) setSubscription(connection *nats.Conn, subscription *nats.Subscription, err error) {
+	consumer.stateLock.Lock()
+	defer consumer.stateLock.Unlock()
+
+	if subscription != nil && consumer.subscription == nil {
+		consumer.consumeStartTime = time.Now()
+	}
+
+	consumer.connection = connection
+	consumer.subscription = subscription
+	consumer.lastError = err
+}
+
+func (consumer *NatsConsumer) setLastDeliveryTime(t time.Time) {
+	consumer.stateLock.Lock()
+	defer consumer.stateLock.Unlock()
+
+	consumer.lastDeliveryTime = t
+}
+
+// IsConsuming returns true if the consumer is connected and subscribed
+func (consumer *NatsConsumer) IsConsuming() bool {
+	consumer.stateLock.Lock()
+	defer consumer.stateLock.Unlock()
+
+	return consumer.connection != nil && consumer.connection.IsConnected() && consumer.subscription != nil && consumer.subscription.IsValid()
+}
+
+// GetLastActivityTime returns the last time an event is delivered, or the consumer subscribed if later
+// zero time if the consumer is not subscribed
+func (consumer *NatsConsumer) GetLastActivityTime() time.Time {
+	consumer.stateLock.Lock()
+	defer consumer.stateLock.Unlock()
+
+	if consumer.subscription == nil {
+		return time.Time{}
+	}
+
+	if consumer.lastDeliveryTime.After(consumer.consumeStartTime) {
+		return consumer.lastDeliveryTime
+	}
+	return consumer.consumeStartTime
+}
+
+// GetLastError returns an error that stopped the consumer last, or the NATS client is disconnected with
+func (consumer *NatsConsumer) GetLastError() error {
+	consumer.stateLock.Lock()
+	defer consumer.stateLock.Unlock()
+
+	if consumer.lastError == nil && consumer.connection != nil && !consumer.connection.IsConnected() {
+		return consumer.connection.LastError()
+	}
+	return consumer.lastError
+}
+
+// Reconfigure replaces config and reconnects
+func (consumer *NatsConsumer) Reconfigure(config *commons.NatsConfig, consumerName string) {
+	consumer.stateLock.Lock()
+	consumer.config = config
+	consumer.consumerName = consumerName
+	consumer.stateLock.Unlock()
+
+	consumer.Reconnect()
+}
+
+// Reconnect disconnects and connects again immediately, ignoring backoff
+func (consumer *NatsConsumer) Reconnect() {
+	select {
+	case consumer.reconnectChan <- true:
+	default:
+		// reconnect is already requested
+	}
+}
+
+// Release stops consuming and disconnects from NATS
+func (consumer *NatsConsumer) Release() {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "NatsConsumer",
+		"function": "Release",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	logger.Info("stopping NATS consumer")
+
+	consumer.terminateOnce.Do(func() {
+		close(consumer.terminateChan)
+	})
+
+	consumer.waitGroup.Wait()
+	consumer.eventHandler = nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/nats-io/nats.go"
+	amqp_mod "github.com/streadway/amqp"
+)
+
+func TestNatsConsumerHandleMsg(t *testing.T) {
+	config := commons.NewDefaultNatsConfig()
+	config.EventSubjectPrefix = "irods.events."
+
+	timestamp := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                string
+		subject             string
+		header              nats.Header
+		reply               string // JetStream ack subject, having metadata
+		expectedRoutingKey  string
+		expectedContentType string
+		expectedMessageID   string
+		expectedTimestamp   time.Time
+		expectedRedelivered bool
+	}{
+		{
+			name:               "core message",
+			subject:            "irods.events.data-object.add",
+			header:             nats.Header{},
+			expectedRoutingKey: "data-object.add",
+		},
+		{
+			name:    "headers",
+			subject: "irods.events.collection.rm",
+			header: nats.Header{
+				NatsContentTypeHeader:   []string{"application/json"},
+				nats.MsgIdHdr:           []string{"msg-1"},
+				NatsCorrelationIDHeader: []string{"corr-1"},
+			},
+			expectedRoutingKey:  "collection.rm",
+			expectedContentType: "application/json",
+			expectedMessageID:   "msg-1",
+		},
+		{
+			name:               "subject without prefix",
+			subject:            "other.data-object.add",
+			header:             nats.Header{},
+			expectedRoutingKey: "other.data-object.add",
+		},
+		{
+			name:               "first delivery",
+			subject:            "irods.events.data-object.mod",
+			header:             nats.Header{},
+			reply:              fmt.Sprintf("$JS.ACK.IRODS_EVENTS.consumer.1.10.5.%d.0", timestamp.UnixNano()),
+			expectedRoutingKey: "data-object.mod",
+			expectedTimestamp:  timestamp,
+		},
+		{
+			name:                "redelivery",
+			subject:             "irods.events.data-object.mod",
+			header:              nats.Header{},
+			reply:               fmt.Sprintf("$JS.ACK.IRODS_EVENTS.consumer.2.10.5.%d.0", timestamp.UnixNano()),
+			expectedRoutingKey:  "data-object.mod",
+			expectedTimestamp:   timestamp,
+			expectedRedelivered: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deliveries := []amqp_mod.Delivery{}
+			consumer := &NatsConsumer{
+				config: &config,
+				eventHandler: func(delivery amqp_mod.Delivery) {
+					deliveries = append(deliveries, delivery)
+				},
+			}
+
+			msg := &nats.Msg{
+				Subject: test.subject,
+				Reply:   test.reply,
+				Header:  test.header,
+				Data:    []byte(`{"path": "/zone/home/user/file"}`),
+				// not connected, ack fails and is logged
+				Sub: &nats.Subscription{},
+			}
+
+			consumer.handleMsg(&config, msg)
+
+			if len(deliveries) != 1 {
+				t.Fatalf("expected 1 delivery, got %d", len(deliveries))
+			}
+
+			delivery := deliveries[0]
+			if delivery.RoutingKey != test.expectedRoutingKey {
+				t.Errorf("expected routing key %q, got %q", test.expectedRoutingKey, delivery.RoutingKey)
+			}
+
+			if delivery.ContentType != test.expectedContentType {
+				t.Errorf("expected content type %q, got %q", test.expectedContentType, delivery.ContentType)
+			}
+
+			if delivery.MessageId != test.expectedMessageID {
+				t.Errorf("expected message ID %q, got %q", test.expectedMessageID, delivery.MessageId)
+			}
+
+			if string(delivery.Body) != string(msg.Data) {
+				t.Errorf("expected body %q, got %q", msg.Data, delivery.Body)
+			}
+
+			if !delivery.Timestamp.Equal(test.expectedTimestamp) {
+				t.Errorf("expected timestamp %s, got %s", test.expectedTimestamp, delivery.Timestamp)
+			}
+
+			if delivery.Redelivered != test.expectedRedelivered {
+				t.Errorf("expected redelivered %t, got %t", test.expectedRedelivered, delivery.Redelivered)
+			}
+
+			if len(delivery.Headers) != len(test.header) {
+				t.Errorf("expected %d headers, got %d", len(test.header), len(delivery.Headers))
+			}
+
+			for key := range test.header {
+				if delivery.Headers[key] != test.header.Get(key) {
+					t.Errorf("expected header %s %q, got %v", key, test.header.Get(key), delivery.Headers[key])
+				}
+			}
+
+			if consumer.lastDeliveryTime.IsZero() {
+				t.Error("last delivery time is not set")
+			}
+		})
+	}
+}
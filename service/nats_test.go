@@ -0,0 +1,36 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+)
+
+func TestGetNatsDedupID(t *testing.T) {
+	tests := []struct {
+		name      string
+		messageID string
+		requestID string
+		filePath  string
+		expected  string
+	}{
+		{name: "message ID", messageID: "msg-1", requestID: "req-1", filePath: "/turnin/1665000000000000-100-000001", expected: "msg-1"},
+		{name: "request ID", requestID: "req-1", filePath: "/turnin/1665000000000000-100-000001", expected: "req-1"},
+		{name: "file name", filePath: "/turnin/inflight/host1/1665000000000000-100-000001", expected: "1665000000000000-100-000001"},
+		{name: "nothing", expected: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := turnin.NewSendMessageRequest("data-object.add", "{}")
+			request.MessageID = test.messageID
+			request.RequestID = test.requestID
+			request.SetItemFilePath(test.filePath)
+
+			dedupID := getNatsDedupID(request)
+			if dedupID != test.expected {
+				t.Errorf("expected dedup ID %q, got %q", test.expected, dedupID)
+			}
+		})
+	}
+}
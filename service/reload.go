@@ -0,0 +1,208 @@
+package service
+
+import (
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	log "github.com/sirupsen/logrus"
+)
+
+// Reload applies the new config, reconnecting only components whose config is changed
+// items in progress are not interrupted, components wait for them before reconnecting
+// changes that require restart are ignored with warnings
+func (svc *AsyncExecCmdService) Reload(config *commons.ServerConfig) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AsyncExecCmdService",
+		"function": "Reload",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	svc.reloadLock.Lock()
+	defer svc.reloadLock.Unlock()
+
+	err := config.Validate()
+	if err != nil {
+		logger.WithError(err).Error("invalid configuration, keep running with the current configuration")
+		return err
+	}
+
+	oldConfig := svc.getConfig()
+
+	// runtime options are not given in config files
+	config.Foreground = oldConfig.Foreground
+	config.Systemd = oldConfig.Systemd
+	config.ChildProcess = oldConfig.ChildProcess
+	config.ConfigFilePath = oldConfig.ConfigFilePath
+
+	changes := oldConfig.Diff(config)
+	if len(changes) == 0 {
+		logger.Info("configuration is not changed")
+		return nil
+	}
+
+	changed := map[commons.ServerConfigSection]bool{}
+	for _, section := range changes {
+		switch section {
+		case commons.DataRootPathSection:
+			logger.Warnf("changing %s requires restart, ignored", section)
+			config.DataRootPath = oldConfig.DataRootPath
+		case commons.TurnInDirPathSection:
+			logger.Warnf("changing %s requires restart, ignored", section)
+			config.TurnInDirPath = oldConfig.TurnInDirPath
+		case commons.InstanceSection:
+			logger.Warnf("changing %s requires restart, ignored", section)
+			config.InstanceName = oldConfig.InstanceName
+			config.TurnInLeaseDuration = oldConfig.TurnInLeaseDuration
+		case commons.ControlSocketSection:
+			logger.Warnf("changing %s requires restart, ignored", section)
+			config.ControlSocketPath = oldConfig.ControlSocketPath
+			config.ControlSocketMode = oldConfig.ControlSocketMode
+			config.ControlSocketGroup = oldConfig.ControlSocketGroup
+		case commons.PIDFilePathSection:
+			logger.Warnf("changing %s requires restart, ignored", section)
+			config.PIDFilePath = oldConfig.PIDFilePath
+		case commons.LogPathSection:
+			logger.Warnf("changing %s requires restart, ignored", section)
+			config.LogPath = oldConfig.LogPath
+		case commons.LogFormatSection:
+			logger.Warnf("changing %s requires restart, ignored", section)
+			config.LogFormat = oldConfig.LogFormat
+		case commons.TracingConfigSection:
+			logger.Warnf("changing %s requires restart, ignored", section)
+			config.TracingConfig = oldConfig.TracingConfig
+		case commons.AmqpDestinationsSection:
+			if !svc.hasAmqpDestinations(config) {
+				logger.Warnf("adding or removing AMQP destinations requires restart, ignored")
+				config.AmqpDestinations = oldConfig.AmqpDestinations
+				// routes may refer to destinations added
+				config.AmqpRoutes = oldConfig.AmqpRoutes
+				continue
+			}
+			changed[section] = true
+		case commons.AmqpConfigSection:
+			if (len(oldConfig.AmqpConfig.URL) > 0) != (len(config.AmqpConfig.URL) > 0) {
+				logger.Warnf("enabling or disabling AMQP requires restart, ignored")
+				config.AmqpConfig = oldConfig.AmqpConfig
+				continue
+			}
+			changed[section] = true
+		case commons.KafkaConfigSection:
+			if oldConfig.KafkaConfig.IsConfigured() != config.KafkaConfig.IsConfigured() {
+				logger.Warnf("enabling or disabling Kafka requires restart, ignored")
+				config.KafkaConfig = oldConfig.KafkaConfig
+				continue
+			}
+			changed[section] = true
+		case commons.NatsConfigSection:
+			if oldConfig.NatsConfig.IsConfigured() != config.NatsConfig.IsConfigured() {
+				logger.Warnf("enabling or disabling NATS requires restart, ignored")
+				config.NatsConfig = oldConfig.NatsConfig
+				continue
+			}
+			changed[section] = true
+		case commons.EventSourceSection:
+			logger.Warnf("changing %s requires restart, ignored", section)
+			config.EventSource = oldConfig.EventSource
+		case commons.MessageOutputsSection:
+			if !svc.hasMessageOutputs(config) {
+				logger.Warnf("selecting message outputs not configured at start requires restart, ignored")
+				config.MessageOutputs = oldConfig.MessageOutputs
+				continue
+			}
+			changed[section] = true
+		case commons.BisqueConfigSection:
+			if (len(oldConfig.BisqueConfig.URL) > 0) != (len(config.BisqueConfig.URL) > 0) {
+				logger.Warnf("enabling or disabling BisQue requires restart, ignored")
+				config.BisqueConfig = oldConfig.BisqueConfig
+				continue
+			}
+			changed[section] = true
+		default:
+			changed[section] = true
+		}
+	}
+
+	logger.Infof("reloading configuration, changed %v", changes)
+
+	svc.configLock.Lock()
+	svc.config = config
+	svc.configLock.Unlock()
+
+	svc.turnin.PriorityAging = config.TurnInPriorityAging
+	svc.turnin.ScrapeLimit = config.TurnInScrapeLimit
+
+	if changed[commons.DebugSection] {
+		if config.Debug {
+			log.SetLevel(log.DebugLevel)
+		} else {
+			log.SetLevel(log.InfoLevel)
+		}
+		logger.Infof("set log level to %s", log.GetLevel().String())
+	}
+
+	// reconnect failures are not fatal, components connect again lazily
+	if changed[commons.AmqpConfigSection] && svc.amqp != nil {
+		err = svc.amqp.Reconfigure(&config.AmqpConfig)
+		if err != nil {
+			logger.WithError(err).Warn("failed to reconnect to AMQP, will retry again")
+		}
+	}
+
+	// message defaults do not matter to consuming
+	if changed[commons.AmqpConfigSection] && svc.amqpConsumer != nil {
+		if oldConfig.AmqpConfig.URL != config.AmqpConfig.URL || oldConfig.AmqpConfig.Exchange != config.AmqpConfig.Exchange {
+			svc.amqpConsumer.Reconfigure(&config.AmqpConfig)
+		}
+	}
+
+	if changed[commons.AmqpDestinationsSection] {
+		svc.reconfigureAmqpDestinations(oldConfig, config)
+	}
+
+	if changed[commons.KafkaConfigSection] && svc.kafka != nil {
+		err = svc.kafka.Reconfigure(&config.KafkaConfig)
+		if err != nil {
+			logger.WithError(err).Warn("failed to reconnect to Kafka, will retry again")
+		}
+	}
+
+	if changed[commons.NatsConfigSection] && svc.nats != nil {
+		err = svc.nats.Reconfigure(&config.NatsConfig)
+		if err != nil {
+			logger.WithError(err).Warn("failed to reconnect to NATS, will retry again")
+		}
+	}
+
+	// subjects and stream of send_message requests do not matter to consuming
+	if changed[commons.NatsConfigSection] && svc.natsConsumer != nil {
+		if getNatsConsumerConfig(oldConfig.NatsConfig) != getNatsConsumerConfig(config.NatsConfig) {
+			instanceName, err := config.GetInstanceName()
+			if err != nil {
+				logger.WithError(err).Warn("failed to get instance name, NATS consumer is not reconfigured")
+			} else {
+				svc.natsConsumer.Reconfigure(&config.NatsConfig, config.NatsConfig.GetEventConsumer(instanceName))
+			}
+		}
+	}
+
+	if changed[commons.IrodsConfigSection] && svc.irods != nil {
+		err = svc.irods.Reconfigure(&config.IrodsConfig)
+		if err != nil {
+			logger.WithError(err).Warn("failed to reconnect to iRODS, will retry again")
+		}
+	}
+
+	if changed[commons.BisqueConfigSection] && svc.bisque != nil {
+		svc.bisque.Reconfigure(&config.BisqueConfig)
+	}
+
+	logger.Info("reloaded configuration")
+	return nil
+}
+
+// getNatsConsumerConfig returns NATS config without fields of publishing
+func getNatsConsumerConfig(config commons.NatsConfig) commons.NatsConfig {
+	config.SubjectPrefix = ""
+	config.Stream = ""
+	return config
+}
@@ -0,0 +1,35 @@
+package service
+
+import "fmt"
+
+// RemoteResponseError is an error returned when a remote service responds an error status
+type RemoteResponseError struct {
+	statusCode int
+	message    string
+}
+
+// NewRemoteResponseErrorf creates RemoteResponseError struct
+func NewRemoteResponseErrorf(statusCode int, format string, v ...interface{}) *RemoteResponseError {
+	return &RemoteResponseError{
+		statusCode: statusCode,
+		message:    fmt.Sprintf(format, v...),
+	}
+}
+
+func (e *RemoteResponseError) Error() string {
+	return e.message
+}
+
+// GetStatusCode returns status code responded
+func (e *RemoteResponseError) GetStatusCode() int {
+	return e.statusCode
+}
+
+// IsRemoteResponseError evaluates if the given error is RemoteResponseError
+func IsRemoteResponseError(err error) bool {
+	if _, ok := err.(*RemoteResponseError); ok {
+		return true
+	}
+
+	return false
+}
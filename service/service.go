@@ -1,30 +1,97 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/control"
 	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	ScrapeInterval = 3 * time.Second
+
+	// LeaseRenewalsPerDuration is the number of times a lease is renewed in the lease duration, to tolerate failures
+	LeaseRenewalsPerDuration = 3
+
+	// MaxInterruptedAttempts is the max number of times a turn-in is interrupted while in-flight, e.g., by crashes, before it is failed
+	// a turn-in killing the service every time is not retried forever
+	MaxInterruptedAttempts = 3
+
+	// EnqueueCapacityCheckInterval is the time a successful capacity check is reused for requests enqueued directly
+	EnqueueCapacityCheckInterval = 1 * time.Second
 )
 
 // AsyncExecCmdService is a service object
 type AsyncExecCmdService struct {
-	config *commons.ServerConfig
-	turnin *turnin.TurnIn
+	config     *commons.ServerConfig
+	configLock sync.RWMutex
+	reloadLock sync.Mutex
+	turnin     *turnin.TurnIn
 
 	bisque *BisQue
 	amqp   *AMQP
+	// consumes iRODS events for BisQue, with a connection separated from publishing
+	amqpConsumer *AmqpConsumer
+	// AMQP destinations other than the default, keyed by name
+	amqpDestinations map[string]*AMQP
+
+	kafka *Kafka
+
+	nats *Nats
+	// consumes iRODS events for BisQue when events are on NATS
+	natsConsumer *NatsConsumer
 
 	irods *IRODS
 
-	terminateChan chan bool
+	control *ControlServer
+	// listener for the control server, created if not given
+	controlListener net.Listener
+
+	tracing *commons.Tracing
+
+	instanceLock *InstanceLock
+
+	// attempts to process turn-ins, keyed by turn-in file path
+	attempts     map[string][]turnin.AttemptRecord
+	attemptsLock sync.Mutex
+
+	// message outputs send_message requests being retried are delivered to, keyed by turn-in file path
+	deliveredOutputs     map[string]map[commons.MessageOutput]bool
+	deliveredOutputsLock sync.Mutex
+
+	// recent errors occurred while processing turn-ins, oldest first
+	recentErrors     []control.ErrorRecord
+	recentErrorsLock sync.Mutex
+
+	// time the turn in dir had capacity for requests enqueued directly
+	capacityCheckTime time.Time
+	capacityCheckLock sync.Mutex
+
+	// lanes paused, keyed by lane name
+	pausedLanes     map[string]bool
+	pausedLanesLock sync.Mutex
+
+	startTime         time.Time
+	lastAliveTime     int64 // unix nano time the scrape loop was alive at
+	draining          int32
+	scrapeTriggerChan chan bool
+	drainedChan       chan bool
+	drainedOnce       sync.Once
+	terminateChan     chan bool
+	terminateOnce     sync.Once
+	// scrape loop, waited by Stop not to release clients and turn-ins claimed while processing them
+	scrapeWaitGroup sync.WaitGroup
 }
 
 // NewService creates a new Service
@@ -40,9 +107,61 @@ func NewService(config *commons.ServerConfig) (*AsyncExecCmdService, error) {
 		config: config,
 		turnin: turnin.NewTurnIn(config.GetTurnInRootDirPath()),
 
-		terminateChan: make(chan bool),
+		attempts:     map[string][]turnin.AttemptRecord{},
+		attemptsLock: sync.Mutex{},
+
+		deliveredOutputs:     map[string]map[commons.MessageOutput]bool{},
+		deliveredOutputsLock: sync.Mutex{},
+
+		recentErrors:     []control.ErrorRecord{},
+		recentErrorsLock: sync.Mutex{},
+
+		pausedLanes:     map[string]bool{},
+		pausedLanesLock: sync.Mutex{},
+
+		scrapeTriggerChan: make(chan bool, 1),
+		drainedChan:       make(chan bool),
+		terminateChan:     make(chan bool),
+	}
+
+	service.turnin.PriorityAging = config.TurnInPriorityAging
+	service.turnin.ServiceVersion = commons.GetReleaseVersion()
+
+	// instances sharing the turn-in dir claim turn-ins not to process them twice
+	instanceName, err := config.GetInstanceName()
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	service.turnin.Instance = instanceName
+	service.turnin.LeaseDuration = config.TurnInLeaseDuration
+	service.turnin.ScrapeLimit = config.TurnInScrapeLimit
+
+	// two services running on the same data root dir would claim turn-ins as the same instance
+	instanceLock, err := AcquireInstanceLock(config.GetLockFilePath(), config.GetPIDFilePath())
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	service.instanceLock = instanceLock
+
+	created := false
+	defer func() {
+		if !created {
+			service.releaseOnCreateFailure()
+		}
+	}()
+
+	tracing, err := commons.NewTracing(&config.TracingConfig, commons.TracingServiceNameService)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
 	}
 
+	service.tracing = tracing
+
 	irods, err := CreateIrods(service, &config.IrodsConfig)
 	if err != nil {
 		logger.Error(err)
@@ -51,8 +170,6 @@ func NewService(config *commons.ServerConfig) (*AsyncExecCmdService, error) {
 
 	service.irods = irods
 
-	var amqpEventHandler AmqpEventHandler
-
 	if len(config.BisqueConfig.URL) > 0 {
 		bisque, err := CreateBisque(service, &config.BisqueConfig)
 		if err != nil {
@@ -61,16 +178,57 @@ func NewService(config *commons.ServerConfig) (*AsyncExecCmdService, error) {
 		}
 
 		service.bisque = bisque
-		amqpEventHandler = bisque.HandleAmqpEvent
+
+		eventSource, err := config.GetEventSource()
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+
+		switch eventSource {
+		case commons.EventSourceNATS:
+			service.natsConsumer = CreateNatsConsumer(service, &config.NatsConfig, config.NatsConfig.GetEventConsumer(instanceName), bisque.HandleAmqpEvent)
+		default:
+			service.amqpConsumer = CreateAmqpConsumer(service, &config.AmqpConfig, bisque.HandleAmqpEvent)
+		}
+	}
+
+	// AMQP is optional if send_message requests are delivered only to Kafka
+	if len(config.AmqpConfig.URL) > 0 {
+		amqp, err := CreateAmqp(service, &config.AmqpConfig)
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+
+		service.amqp = amqp
 	}
 
-	amqp, err := CreateAmqp(service, &config.AmqpConfig, amqpEventHandler)
+	err = service.createAmqpDestinations(config)
 	if err != nil {
 		logger.Error(err)
 		return nil, err
 	}
 
-	service.amqp = amqp
+	if config.KafkaConfig.IsConfigured() {
+		kafka, err := CreateKafka(service, &config.KafkaConfig)
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+
+		service.kafka = kafka
+	}
+
+	if config.NatsConfig.IsConfigured() {
+		natsClient, err := CreateNats(service, &config.NatsConfig)
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+
+		service.nats = natsClient
+	}
 
 	err = service.turnin.MakeTurnInDir()
 	if err != nil {
@@ -78,10 +236,19 @@ func NewService(config *commons.ServerConfig) (*AsyncExecCmdService, error) {
 		return nil, err
 	}
 
+	created = true
 	return service, nil
 }
 
-// Release releases the service
+// getConfig returns config in use, replaced on reload
+func (svc *AsyncExecCmdService) getConfig() *commons.ServerConfig {
+	svc.configLock.RLock()
+	defer svc.configLock.RUnlock()
+
+	return svc.config
+}
+
+// Release releases the service, call Stop first if started
 func (svc *AsyncExecCmdService) Release() {
 	logger := log.WithFields(log.Fields{
 		"package":  "service",
@@ -93,11 +260,61 @@ func (svc *AsyncExecCmdService) Release() {
 
 	defer commons.StackTraceFromPanic(logger)
 
+	if svc.control != nil {
+		svc.control.Release()
+		svc.control = nil
+	}
+
+	svc.releaseClients()
+
+	// let other instances process turn-ins claimed but not processed
+	err := svc.turnin.ReleaseLease()
+	if err != nil {
+		logger.WithError(err).Warn("failed to release turn-ins claimed")
+	}
+
+	// flush spans of turn-ins processed
+	svc.releaseTracing()
+
+	// release at last, turn-ins are not processed any more
+	if svc.instanceLock != nil {
+		svc.instanceLock.Release()
+		svc.instanceLock = nil
+	}
+}
+
+// releaseClients releases clients of remote services
+func (svc *AsyncExecCmdService) releaseClients() {
+	if svc.amqpConsumer != nil {
+		svc.amqpConsumer.Release()
+		svc.amqpConsumer = nil
+	}
+
+	if svc.natsConsumer != nil {
+		svc.natsConsumer.Release()
+		svc.natsConsumer = nil
+	}
+
 	if svc.amqp != nil {
 		svc.amqp.Release()
 		svc.amqp = nil
 	}
 
+	for name, amqp := range svc.amqpDestinations {
+		amqp.Release()
+		delete(svc.amqpDestinations, name)
+	}
+
+	if svc.kafka != nil {
+		svc.kafka.Release()
+		svc.kafka = nil
+	}
+
+	if svc.nats != nil {
+		svc.nats.Release()
+		svc.nats = nil
+	}
+
 	if svc.bisque != nil {
 		svc.bisque.Release()
 		svc.bisque = nil
@@ -109,6 +326,35 @@ func (svc *AsyncExecCmdService) Release() {
 	}
 }
 
+// releaseTracing exports spans not exported yet, and releases tracing
+func (svc *AsyncExecCmdService) releaseTracing() {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AsyncExecCmdService",
+		"function": "releaseTracing",
+	})
+
+	if svc.tracing != nil {
+		err := svc.tracing.Release()
+		if err != nil {
+			logger.WithError(err).Warn("failed to export spans")
+		}
+		svc.tracing = nil
+	}
+}
+
+// releaseOnCreateFailure releases what NewService acquired, not to leave the instance lock and the PID file
+// turn-ins in-flight are left for RecoverInflight at the next start
+func (svc *AsyncExecCmdService) releaseOnCreateFailure() {
+	svc.releaseClients()
+	svc.releaseTracing()
+
+	if svc.instanceLock != nil {
+		svc.instanceLock.Release()
+		svc.instanceLock = nil
+	}
+}
+
 // Start starts the service
 func (svc *AsyncExecCmdService) Start() error {
 	logger := log.WithFields(log.Fields{
@@ -121,7 +367,48 @@ func (svc *AsyncExecCmdService) Start() error {
 
 	logger.Info("Starting the Async Exec Cmd Service")
 
+	svc.startTime = time.Now()
+
+	svc.touchAlive()
+
+	// this instance is the only one claiming as the instance, turn-ins in-flight are left by a previous run
+	recovered, err := svc.turnin.RecoverInflight()
+	svc.logRecoveredItems(recovered, "left in-flight by a previous run")
+	if err != nil {
+		logger.WithError(err).Error("failed to recover turn-ins left in-flight by a previous run")
+		return err
+	}
+
+	err = svc.turnin.RenewLease()
+	if err != nil {
+		logger.WithError(err).Error("failed to write a lease")
+		return err
+	}
+
+	controlServer, err := CreateControlServer(svc, svc.getConfig(), svc.controlListener)
+	if err != nil {
+		logger.WithError(err).Error("failed to create a control server")
+		return err
+	}
+
+	svc.control = controlServer
+
+	if svc.turnin.IsClaimEnabled() {
+		go svc.renewLease()
+	}
+
+	if svc.amqpConsumer != nil {
+		svc.amqpConsumer.Start()
+	}
+
+	if svc.natsConsumer != nil {
+		svc.natsConsumer.Start()
+	}
+
+	svc.scrapeWaitGroup.Add(1)
 	go func() {
+		defer svc.scrapeWaitGroup.Done()
+
 		scrapeTicker := time.NewTicker(ScrapeInterval)
 		defer scrapeTicker.Stop()
 
@@ -131,15 +418,143 @@ func (svc *AsyncExecCmdService) Start() error {
 				// terminate
 				return
 			case <-scrapeTicker.C:
-				svc.Scrape()
+			case <-svc.scrapeTriggerChan:
+			}
+
+			svc.touchAlive()
+
+			processed := svc.Scrape()
+			if svc.IsDraining() && processed == 0 {
+				// nothing more can be processed
+				logger.Info("drained turn-ins")
+				svc.drainedOnce.Do(func() {
+					close(svc.drainedChan)
+				})
+				return
 			}
 		}
 	}()
 
+	go func() {
+		checkInterval := svc.getConfig().RetentionConfig.CheckInterval
+		cleanUpTicker := time.NewTicker(checkInterval)
+		defer cleanUpTicker.Stop()
+
+		svc.CleanUp()
+
+		for {
+			select {
+			case <-svc.terminateChan:
+				// terminate
+				return
+			case <-cleanUpTicker.C:
+				svc.CleanUp()
+
+				// check interval may be changed by reload
+				newCheckInterval := svc.getConfig().RetentionConfig.CheckInterval
+				if newCheckInterval != checkInterval {
+					checkInterval = newCheckInterval
+					cleanUpTicker.Reset(checkInterval)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// renewLease renews the lease of this instance a few times in the lease duration, until the service stops
+// turn-ins claimed are not processed if the lease is expired
+func (svc *AsyncExecCmdService) renewLease() {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AsyncExecCmdService",
+		"function": "renewLease",
+	})
+
+	defer commons.StackTraceFromPanic(logger)
+
+	renewTicker := time.NewTicker(svc.turnin.LeaseDuration / LeaseRenewalsPerDuration)
+	defer renewTicker.Stop()
+
+	for {
+		select {
+		case <-svc.terminateChan:
+			// terminate
+			return
+		case <-renewTicker.C:
+			err := svc.turnin.RenewLease()
+			if err != nil {
+				logger.WithError(err).Errorf("failed to renew the lease of instance %s", svc.turnin.Instance)
+			}
+		}
+	}
+}
+
+// logRecoveredItems logs turn-ins recovered from in-flight state back to pending
+func (svc *AsyncExecCmdService) logRecoveredItems(items []turnin.TurnInItem, reason string) {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AsyncExecCmdService",
+		"function": "logRecoveredItems",
+	})
+
+	for _, item := range items {
+		logger.WithField("request_id", item.GetRequestID()).Warnf("recovered a turn-in %s (%s) %s, attempts %d", turnin.GetItemID(item), item.GetRequestType(), reason, item.GetAttempts())
+	}
+
+	if len(items) > 0 {
+		logger.Warnf("recovered %d turn-ins %s", len(items), reason)
+	}
+}
+
+// SetControlListener sets a listener for the control server, must be called before Start
+func (svc *AsyncExecCmdService) SetControlListener(listener net.Listener) {
+	svc.controlListener = listener
+}
+
+// checkEnqueueCapacity checks capacity of the turn in dir for requests enqueued directly
+// a successful check is reused for EnqueueCapacityCheckInterval to not stat the turn in dir per request
+func (svc *AsyncExecCmdService) checkEnqueueCapacity() error {
+	svc.capacityCheckLock.Lock()
+	defer svc.capacityCheckLock.Unlock()
+
+	now := time.Now()
+	if now.Sub(svc.capacityCheckTime) < EnqueueCapacityCheckInterval {
+		return nil
+	}
+
+	err := svc.turnin.CheckCapacity()
+	if err != nil {
+		return err
+	}
+
+	svc.capacityCheckTime = now
 	return nil
 }
 
-// Stop stops the service
+// touchAlive marks the scrape loop alive
+func (svc *AsyncExecCmdService) touchAlive() {
+	atomic.StoreInt64(&svc.lastAliveTime, time.Now().UnixNano())
+}
+
+// GetLastAliveTime returns the last time the scrape loop was alive, scraping or processing turn-ins
+func (svc *AsyncExecCmdService) GetLastAliveTime() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&svc.lastAliveTime))
+}
+
+// isTerminating returns true if the service is stopping
+func (svc *AsyncExecCmdService) isTerminating() bool {
+	select {
+	case <-svc.terminateChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop stops the service, waiting for turn-ins being processed
+// turn-ins claimed but not processed yet are left to Release
 func (svc *AsyncExecCmdService) Stop() {
 	logger := log.WithFields(log.Fields{
 		"package":  "service",
@@ -151,86 +566,505 @@ func (svc *AsyncExecCmdService) Stop() {
 
 	defer commons.StackTraceFromPanic(logger)
 
-	svc.terminateChan <- true
+	// close to terminate all goroutines
+	svc.terminateOnce.Do(func() {
+		close(svc.terminateChan)
+	})
+
+	svc.scrapeWaitGroup.Wait()
+}
+
+// Enqueue persists a turn-in request given over the control socket into the turn in dir
+// the request is still written as a file, so it survives crashes and is claimed like other turn-ins
+func (svc *AsyncExecCmdService) Enqueue(itemBytes []byte) (turnin.TurnInItem, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AsyncExecCmdService",
+		"function": "Enqueue",
+	})
+
+	if len(itemBytes) == 0 {
+		return nil, NewValidationErrorf("failed to enqueue an empty request")
+	}
+
+	item, err := turnin.NewTurnInRequest(itemBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = item.Validate()
+	if err != nil {
+		return nil, NewValidationErrorf("invalid %s request - %v", item.GetRequestType(), err)
+	}
+
+	if item.GetCreationTime().IsZero() {
+		item.SetCreationTime(time.Now().Local())
+	}
+
+	requestID := turnin.EnsureRequestID(item)
+
+	err = svc.checkEnqueueCapacity()
+	if err != nil {
+		return nil, err
+	}
+
+	err = svc.turnin.TurninUnchecked(item)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.WithField("request_id", requestID).Debugf("enqueued a turn-in %s at %s", item.GetRequestType(), item.GetItemFilePath())
+
+	svc.TriggerScrape()
+	return item, nil
+}
+
+// TriggerScrape lets the service scrape turn-ins immediately
+func (svc *AsyncExecCmdService) TriggerScrape() {
+	select {
+	case svc.scrapeTriggerChan <- true:
+	default:
+		// already triggered
+	}
+}
+
+// Drain lets the service process all turn-ins processable, then stop
+// turn-ins in paused lanes or pending due to services not ready are left for the next run
+func (svc *AsyncExecCmdService) Drain() {
+	logger := log.WithFields(log.Fields{
+		"package":  "service",
+		"struct":   "AsyncExecCmdService",
+		"function": "Drain",
+	})
+
+	logger.Info("Draining turn-ins")
+
+	atomic.StoreInt32(&svc.draining, 1)
+	svc.TriggerScrape()
+}
+
+// IsDraining returns true if the service is draining turn-ins to stop
+func (svc *AsyncExecCmdService) IsDraining() bool {
+	return atomic.LoadInt32(&svc.draining) != 0
+}
+
+// GetDrainedChan returns a channel closed when the service drained turn-ins
+func (svc *AsyncExecCmdService) GetDrainedChan() <-chan bool {
+	return svc.drainedChan
+}
+
+// Reconnect reconnects to AMQP, Kafka, NATS or iRODS immediately
+func (svc *AsyncExecCmdService) Reconnect(target string) error {
+	switch target {
+	case control.ComponentAMQP:
+		if svc.amqp == nil {
+			return NewValidationErrorf("AMQP is not configured")
+		}
+
+		err := svc.amqp.Reconnect()
+		if err != nil {
+			return err
+		}
+
+		for _, amqp := range svc.amqpDestinations {
+			err = amqp.Reconnect()
+			if err != nil {
+				return err
+			}
+		}
+
+		if svc.amqpConsumer != nil {
+			svc.amqpConsumer.Reconnect()
+		}
+		return nil
+	case control.ComponentAMQPConsumer:
+		if svc.amqpConsumer == nil {
+			return NewValidationErrorf("AMQP consumer is not configured, it consumes iRODS events for BisQue")
+		}
+
+		// the consumer reconnects in background
+		svc.amqpConsumer.Reconnect()
+		return nil
+	case control.ComponentIRODS:
+		if svc.irods == nil {
+			return NewValidationErrorf("iRODS is not configured")
+		}
+		return svc.irods.Reconnect()
+	case control.ComponentKafka:
+		if svc.kafka == nil {
+			return NewValidationErrorf("Kafka is not configured")
+		}
+		return svc.kafka.Reconnect()
+	case control.ComponentNATS:
+		if svc.nats == nil {
+			return NewValidationErrorf("NATS is not configured")
+		}
+
+		err := svc.nats.Reconnect()
+		if err != nil {
+			return err
+		}
+
+		if svc.natsConsumer != nil {
+			svc.natsConsumer.Reconnect()
+		}
+		return nil
+	case control.ComponentNATSConsumer:
+		if svc.natsConsumer == nil {
+			return NewValidationErrorf("NATS consumer is not configured, it consumes iRODS events for BisQue")
+		}
+
+		// the consumer reconnects in background
+		svc.natsConsumer.Reconnect()
+		return nil
+	case control.ComponentAll:
+		if svc.amqp != nil {
+			err := svc.Reconnect(control.ComponentAMQP)
+			if err != nil {
+				return err
+			}
+		}
+
+		if svc.kafka != nil {
+			err := svc.Reconnect(control.ComponentKafka)
+			if err != nil {
+				return err
+			}
+		}
+
+		if svc.nats != nil {
+			err := svc.Reconnect(control.ComponentNATS)
+			if err != nil {
+				return err
+			}
+		} else if svc.natsConsumer != nil {
+			svc.natsConsumer.Reconnect()
+		}
+		return svc.Reconnect(control.ComponentIRODS)
+	default:
+		if strings.HasPrefix(target, control.ComponentAMQPDestinationPrefix) {
+			name := strings.TrimPrefix(target, control.ComponentAMQPDestinationPrefix)
+			if amqp, ok := svc.amqpDestinations[name]; ok {
+				return amqp.Reconnect()
+			}
+
+			if name == commons.AmqpDestinationDefault && svc.amqp != nil {
+				return svc.amqp.Reconnect()
+			}
+		}
+
+		return NewValidationErrorf("unknown component %s to reconnect", target)
+	}
+}
+
+// GetStatus returns status of the service
+func (svc *AsyncExecCmdService) GetStatus() *control.Status {
+	status := &control.Status{
+		ServiceVersion: commons.GetReleaseVersion(),
+		StartTime:      svc.startTime,
+		Draining:       svc.IsDraining(),
+		Lanes:          []control.LaneStatus{},
+		Components:     []control.ComponentStatus{},
+		Backlog:        []control.BacklogStatus{},
+	}
+
+	for _, lane := range GetLanes() {
+		status.Lanes = append(status.Lanes, control.LaneStatus{
+			Name:   lane,
+			Paused: svc.IsLanePaused(lane),
+		})
+	}
+
+	status.Components = append(status.Components, control.ComponentStatus{
+		Name:       control.ComponentAMQP,
+		Configured: svc.amqp != nil,
+		Connected:  svc.amqp != nil && svc.amqp.IsConnected(),
+	})
+
+	destinationNames := []string{}
+	for name := range svc.amqpDestinations {
+		destinationNames = append(destinationNames, name)
+	}
+	sort.Strings(destinationNames)
+
+	for _, name := range destinationNames {
+		status.Components = append(status.Components, control.ComponentStatus{
+			Name:       control.ComponentAMQPDestinationPrefix + name,
+			Configured: true,
+			Connected:  svc.amqpDestinations[name].IsConnected(),
+		})
+	}
+
+	consumerStatus := control.ComponentStatus{
+		Name:       control.ComponentAMQPConsumer,
+		Configured: svc.amqpConsumer != nil,
+	}
+
+	if svc.amqpConsumer != nil {
+		consumerStatus.Connected = svc.amqpConsumer.IsConsuming()
+		consumerStatus.LastActivityTime = svc.amqpConsumer.GetLastActivityTime()
+		if consumerErr := svc.amqpConsumer.GetLastError(); consumerErr != nil {
+			consumerStatus.LastError = consumerErr.Error()
+		}
+	}
+
+	status.Components = append(status.Components, consumerStatus)
+
+	status.Components = append(status.Components, control.ComponentStatus{
+		Name:       control.ComponentKafka,
+		Configured: svc.kafka != nil,
+		Connected:  svc.kafka != nil && svc.kafka.IsConnected(),
+	})
+
+	status.Components = append(status.Components, control.ComponentStatus{
+		Name:       control.ComponentNATS,
+		Configured: svc.nats != nil,
+		Connected:  svc.nats != nil && svc.nats.IsConnected(),
+	})
+
+	natsConsumerStatus := control.ComponentStatus{
+		Name:       control.ComponentNATSConsumer,
+		Configured: svc.natsConsumer != nil,
+	}
+
+	if svc.natsConsumer != nil {
+		natsConsumerStatus.Connected = svc.natsConsumer.IsConsuming()
+		natsConsumerStatus.LastActivityTime = svc.natsConsumer.GetLastActivityTime()
+		if consumerErr := svc.natsConsumer.GetLastError(); consumerErr != nil {
+			natsConsumerStatus.LastError = consumerErr.Error()
+		}
+	}
+
+	status.Components = append(status.Components, natsConsumerStatus)
+
+	status.Components = append(status.Components, control.ComponentStatus{
+		Name:       control.ComponentIRODS,
+		Configured: svc.irods != nil,
+		Connected:  svc.irods != nil && svc.irods.IsConnected(),
+	})
+
+	// BisQue is accessed over HTTP, no connection is kept
+	status.Components = append(status.Components, control.ComponentStatus{
+		Name:       control.ComponentBisque,
+		Configured: svc.bisque != nil,
+		Connected:  svc.bisque != nil,
+	})
+
+	for _, backlog := range svc.turnin.GetBacklogMetrics() {
+		status.Backlog = append(status.Backlog, control.BacklogStatus{
+			Priority:           backlog.Priority.String(),
+			Count:              backlog.Count,
+			OldestCreationTime: backlog.OldestCreationTime,
+		})
+	}
+
+	return status
 }
 
-// Scrape scrape turn-ins
-func (svc *AsyncExecCmdService) Scrape() {
+// GetBacklogMetrics returns backlog of turn-ins per priority
+func (svc *AsyncExecCmdService) GetBacklogMetrics() []turnin.BacklogMetrics {
+	return svc.turnin.GetBacklogMetrics()
+}
+
+// Scrape scrape turn-ins, returns the number of turn-ins processed
+func (svc *AsyncExecCmdService) Scrape() int {
 	logger := log.WithFields(log.Fields{
 		"package":  "service",
 		"struct":   "AsyncExecCmdService",
 		"function": "Scrape",
 	})
 
+	// turn-ins claimed by dead instances are scraped again
+	reclaimed, err := svc.turnin.ReclaimExpiredLeases(time.Now())
+	if err != nil {
+		logger.WithError(err).Error("failed to reclaim turn-ins of expired leases")
+		// continue
+	}
+
+	svc.logRecoveredItems(reclaimed, "in-flight in instances whose leases are expired")
+
 	// do not uncomment this for release
-	//logger.Debugf("checking turn-ins at %s", svc.config.GetTurnInRootDirPath())
+	//logger.Debugf("checking turn-ins at %s", svc.getConfig().GetTurnInRootDirPath())
 	items, err := svc.turnin.Scrape()
 	if err != nil {
 		logger.Error(err)
 		// continue
 	}
 
+	processed := int32(0)
+
 	if len(items) > 0 {
-		logger.Debugf("found %d turn-ins at %s", len(items), svc.config.GetTurnInRootDirPath())
+		logger.Debugf("found %d turn-ins at %s", len(items), svc.getConfig().GetTurnInRootDirPath())
+
+		for _, backlog := range svc.turnin.GetBacklogMetrics() {
+			if backlog.Count > 0 {
+				logger.Debugf("backlog of %s priority turn-ins - %d, oldest at %s", backlog.Priority.String(), backlog.Count, backlog.OldestCreationTime.String())
+			}
+		}
 
 		messageChan := make(chan turnin.TurnInItem)
 		bisqueChan := make(chan turnin.TurnInItem)
+		irodsChan := make(chan turnin.TurnInItem)
 
 		wg := sync.WaitGroup{}
-		wg.Add(2)
+		wg.Add(3)
 
-		// we create two goroutines to handle them separately in parallel
+		// we create a goroutine per lane to handle them separately in parallel
 		go func() {
+			stopped := false
 			for item := range messageChan {
-				if !svc.ProcessItem(item) {
-					break
+				if stopped {
 					// ignore all items in the messageChan
 					// to be processed in the next iteration
+					continue
+				}
+
+				if svc.isTerminating() || svc.IsLanePaused(control.LaneSendMessage) || !svc.ProcessItem(item) {
+					stopped = true
+					continue
 				}
+				atomic.AddInt32(&processed, 1)
+				svc.touchAlive()
 			}
 			wg.Done()
 		}()
 
 		go func() {
+			stopped := false
 			for item := range bisqueChan {
-				if !svc.ProcessItem(item) {
-					break
+				if stopped {
 					// ignore all items in the bisqueChan
 					// to be processed in the next iteration
+					continue
 				}
+
+				if svc.isTerminating() || svc.IsLanePaused(control.LaneBisque) || !svc.ProcessItem(item) {
+					stopped = true
+					continue
+				}
+				atomic.AddInt32(&processed, 1)
+				svc.touchAlive()
+			}
+			wg.Done()
+		}()
+
+		go func() {
+			stopped := false
+			for item := range irodsChan {
+				if stopped {
+					// ignore all items in the irodsChan
+					// to be processed in the next iteration
+					continue
+				}
+
+				if svc.isTerminating() || svc.IsLanePaused(control.LaneIRODS) || !svc.ProcessItem(item) {
+					stopped = true
+					continue
+				}
+				atomic.AddInt32(&processed, 1)
+				svc.touchAlive()
 			}
 			wg.Done()
 		}()
 
 		for _, item := range items {
-			if turnin.IsItemTypeSendMessage(item) {
+			lane := getItemLane(item)
+			if svc.IsLanePaused(lane) {
+				// leave it for the lane resumed
+				continue
+			}
+
+			switch lane {
+			case control.LaneSendMessage:
 				logger.Debug("sending a turn-in to send_message queue")
 				messageChan <- item
-			} else if turnin.IsItemTypeBisque(item) {
+			case control.LaneBisque:
 				logger.Debug("sending a turn-in to bisque queue")
 				bisqueChan <- item
-			} else {
+			case control.LaneIRODS:
+				logger.Debug("sending a turn-in to irods queue")
+				irodsChan <- item
+			default:
 				logger.Debug("unknown turn-in found, skip")
 			}
 		}
 
 		close(messageChan)
 		close(bisqueChan)
+		close(irodsChan)
 
 		wg.Wait()
+
+		// let others process turn-ins not processed, they are claimed again at the next scrape
+		for _, item := range items {
+			unclaimErr := svc.turnin.Unclaim(item)
+			if unclaimErr != nil {
+				logger.WithError(unclaimErr).Errorf("failed to unclaim a turn-in %s", item.GetItemFilePath())
+			}
+		}
+
+		// the scrape was limited, more turn-ins may be pending, scrape again not to wait for the next tick
+		// turn-ins of higher priority turned in meanwhile go before the rest
+		if svc.turnin.ScrapeLimit > 0 && len(items) >= svc.turnin.ScrapeLimit && processed > 0 {
+			svc.TriggerScrape()
+		}
 	}
+
+	return int(atomic.LoadInt32(&processed))
 }
 
 func (svc *AsyncExecCmdService) ProcessItem(item turnin.TurnInItem) bool {
 	logger := log.WithFields(log.Fields{
-		"package":  "service",
-		"struct":   "AsyncExecCmdService",
-		"function": "ProcessItem",
+		"package":    "service",
+		"struct":     "AsyncExecCmdService",
+		"function":   "ProcessItem",
+		"request_id": item.GetRequestID(),
 	})
 
 	logger.Debug("Processing a turn-in item")
+
+	if !svc.turnin.IsClaimValid(item, time.Now()) {
+		// lease expired while waiting, the item may be processed by others
+		logger.Warnf("skipping an item turned-in %s, not claimed by this instance any more", item.GetRequestType())
+		return true
+	}
+
+	expired, reason := svc.checkItemExpiry(item, time.Now())
+	if expired {
+		logger.Warnf("skipping an expired item turned-in %s - %s", item.GetRequestType(), reason)
+		svc.takeAttempts(item)
+		svc.forgetDeliveredOutputs(item)
+		err := svc.turnin.MarkExpired(item, reason)
+		if err != nil {
+			logger.WithError(err).Errorf("failed to mark an item turned-in %s expired", item.GetRequestType())
+		}
+
+		svc.writeResult(item, turnin.ResultStatusExpired, errors.New(reason))
+		return true
+	}
+
+	if item.GetAttempts() >= MaxInterruptedAttempts {
+		err := fmt.Errorf("interrupted %d times while in-flight, max %d, not retrying", item.GetAttempts(), MaxInterruptedAttempts)
+		logger.WithError(err).Errorf("failed to process an item turned-in %s", item.GetRequestType())
+		markErr := svc.turnin.MarkFailed(item, svc.newFailureRecord(item, err))
+		if markErr != nil {
+			logger.WithError(markErr).Errorf("failed to mark an item turned-in %s failed", item.GetRequestType())
+		}
+
+		svc.writeResult(item, turnin.ResultStatusFailed, err)
+		return true
+	}
+
+	// checked again right before sending it out, the checks above may be slow on shared storage
+	if !svc.turnin.HasLease(time.Now()) {
+		logger.Warnf("skipping an item turned-in %s, lease of this instance is expired", item.GetRequestType())
+		return true
+	}
+
 	err := svc.distributeItem(item)
 	if err != nil {
+		svc.recordAttempt(item, err)
+
 		if IsServiceNotReadyError(err) {
 			logger.WithError(err).Errorf("service is not ready. will retry next time. pending turn-in %s", item.GetRequestType())
 			// do not mark failed
@@ -239,10 +1073,16 @@ func (svc *AsyncExecCmdService) ProcessItem(item turnin.TurnInItem) bool {
 			return false
 		} else {
 			logger.WithError(err).Errorf("failed to process an item turned-in %s", item.GetRequestType())
-			svc.turnin.MarkFailed(item)
+			markErr := svc.turnin.MarkFailed(item, svc.newFailureRecord(item, err))
+			if markErr != nil {
+				logger.WithError(markErr).Errorf("failed to mark an item turned-in %s failed", item.GetRequestType())
+			}
+
+			svc.writeResult(item, turnin.ResultStatusFailed, err)
 		}
 	} else {
 		logger.Debugf("Processed an item turned-in")
+		svc.takeAttempts(item)
 
 		if len(item.GetItemFilePath()) > 0 {
 			// processed -> delete file
@@ -251,54 +1091,115 @@ func (svc *AsyncExecCmdService) ProcessItem(item turnin.TurnInItem) bool {
 				logger.WithError(err).Errorf("failed to mark an item turned-in %s success", item.GetRequestType())
 			}
 		}
+
+		svc.writeResult(item, turnin.ResultStatusSuccess, nil)
 	}
 
 	return true
 }
 
+// writeResult writes the result of the item if a client waits for it
+func (svc *AsyncExecCmdService) writeResult(item turnin.TurnInItem, status turnin.ResultStatus, err error) {
+	logger := log.WithFields(log.Fields{
+		"package":    "service",
+		"struct":     "AsyncExecCmdService",
+		"function":   "writeResult",
+		"request_id": item.GetRequestID(),
+	})
+
+	if !item.IsResultRequested() || len(item.GetItemFilePath()) == 0 {
+		return
+	}
+
+	record := turnin.NewResultRecord(item, status, err, svc.classifyError(item, err))
+	writeErr := svc.turnin.WriteResult(record)
+	if writeErr != nil {
+		logger.WithError(writeErr).Errorf("failed to write a result of an item turned-in %s", item.GetRequestType())
+	}
+}
+
+// checkItemExpiry checks if the item is expired, using the default TTL of the request type if the item does not have expiry time
+func (svc *AsyncExecCmdService) checkItemExpiry(item turnin.TurnInItem, now time.Time) (bool, string) {
+	if !item.GetExpiryTime().IsZero() {
+		if item.IsExpired(now) {
+			return true, fmt.Sprintf("expired at %s, checked at %s", item.GetExpiryTime().String(), now.String())
+		}
+		return false, ""
+	}
+
+	ttl := svc.getConfig().GetTurnInTTL(string(item.GetRequestType()))
+	if ttl > 0 {
+		expiryTime := item.GetCreationTime().Add(ttl)
+		if now.After(expiryTime) {
+			return true, fmt.Sprintf("expired at %s (default ttl %s for %s), checked at %s", expiryTime.String(), ttl.String(), item.GetRequestType(), now.String())
+		}
+	}
+
+	return false, ""
+}
+
 func (svc *AsyncExecCmdService) distributeItem(item turnin.TurnInItem) error {
 	logger := log.WithFields(log.Fields{
-		"package":  "service",
-		"struct":   "AsyncExecCmdService",
-		"function": "distributeItem",
+		"package":    "service",
+		"struct":     "AsyncExecCmdService",
+		"function":   "distributeItem",
+		"request_id": item.GetRequestID(),
 	})
 
+	// continue the trace of the client turned in the item
+	ctx := turnin.ExtractTraceContext(context.Background(), item)
+	ctx = commons.ContextWithRequestID(ctx, item.GetRequestID())
+
+	ctx, span := svc.startSpan(ctx, "distributeItem", trace.SpanKindConsumer,
+		commons.TracingRequestIDKey.String(item.GetRequestID()),
+		commons.TracingRequestTypeKey.String(string(item.GetRequestType())),
+	)
+	defer span.End()
+
+	var err error
 	switch item.GetRequestType() {
 	case turnin.SendMessageRequestType:
-		processed := false
-		if svc.amqp != nil {
-			logger.Debug("Sending an AMQP request")
-			err := svc.amqp.ProcessItem(item)
-			if err != nil {
-				logger.Error(err)
-				return err
-			}
-
-			processed = true
+		request, ok := item.(*turnin.SendMessageRequest)
+		if !ok {
+			err = NewValidationErrorf("failed to convert item to SendMessageRequest")
+			break
 		}
 
-		if !processed {
-			return fmt.Errorf("failed to send a send_message request because AMQP is not configured")
+		err = svc.sendMessage(ctx, request)
+		if err != nil {
+			logger.Error(err)
 		}
 	case turnin.LinkBisqueRequestType, turnin.RemoveBisqueRequestType, turnin.MoveBisqueRequestType:
-		processed := false
 		if svc.bisque != nil {
 			logger.Debug("Sending a BisQue request")
-			err := svc.bisque.ProcessItem(item)
+			err = svc.bisque.ProcessItem(ctx, item)
 			if err != nil {
 				logger.Error(err)
-				return err
 			}
+		} else {
+			err = fmt.Errorf("failed to send a bisque request because BisQue is not configured")
+		}
+	case turnin.IRODSMetadataRequestType:
+		request, ok := item.(*turnin.IRODSMetadataRequest)
+		if !ok {
+			err = NewValidationErrorf("failed to convert item to IRODSMetadataRequest")
+			break
+		}
 
-			processed = true
+		if svc.irods == nil {
+			err = fmt.Errorf("failed to process an irods_metadata request because iRODS is not configured")
+			break
 		}
 
-		if !processed {
-			return fmt.Errorf("failed to send a bisque request because BisQue is not configured")
+		logger.Debug("Sending an iRODS metadata request")
+		err = svc.irods.ModifyMetadata(ctx, request.IRODSPath, request.Operation, request.AVUs, request.Recursive)
+		if err != nil {
+			logger.Error(err)
 		}
 	default:
-		return fmt.Errorf("failed to distribute an unknown request %s", item.GetRequestType())
+		err = NewValidationErrorf("failed to distribute an unknown request %s", item.GetRequestType())
 	}
 
-	return nil
+	commons.SetSpanError(span, err)
+	return err
 }
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	"github.com/cyverse/irods-rule-async-exec-cmd/turnin"
+)
+
+// newTestService returns a service processing turn-ins in a temp dir, without any clients
+func newTestService(t *testing.T) *AsyncExecCmdService {
+	t.Helper()
+
+	config := commons.NewDefaultServerConfig()
+	config.DataRootPath = t.TempDir()
+
+	svc := &AsyncExecCmdService{
+		config:           config,
+		turnin:           turnin.NewTurnIn(filepath.Join(config.DataRootPath, "turnin")),
+		attempts:         map[string][]turnin.AttemptRecord{},
+		deliveredOutputs: map[string]map[commons.MessageOutput]bool{},
+	}
+
+	err := svc.turnin.MakeTurnInDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return svc
+}
+
+func TestProcessItemExpiry(t *testing.T) {
+	tests := []struct {
+		name          string
+		expiryTime    time.Duration // from now, not given if 0
+		ttl           time.Duration // default TTL of send_message, not given if 0
+		age           time.Duration
+		expectExpired bool
+	}{
+		{name: "expiry time passed", expiryTime: -time.Minute, expectExpired: true},
+		{name: "expiry time not passed", expiryTime: time.Minute},
+		{name: "expiry time over default TTL", expiryTime: time.Minute, ttl: time.Minute, age: time.Hour},
+		{name: "default TTL passed", ttl: time.Minute, age: time.Hour, expectExpired: true},
+		{name: "default TTL not passed", ttl: time.Hour, age: time.Minute},
+		{name: "no expiry", age: 24 * time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc := newTestService(t)
+			if test.ttl > 0 {
+				svc.config.TurnInTTLs[string(turnin.SendMessageRequestType)] = test.ttl
+			}
+
+			item := turnin.NewSendMessageRequest("irods.data-object.add", "{}")
+			item.SetCreationTime(time.Now().Add(-test.age))
+			item.SetResultRequested(true)
+			if test.expiryTime != 0 {
+				item.SetExpiryTime(time.Now().Add(test.expiryTime))
+			}
+
+			err := svc.turnin.Turnin(item)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			id := turnin.GetItemID(item)
+
+			// not expired items are sent out, and fail as AMQP is not configured
+			if !svc.ProcessItem(item) {
+				t.Fatal("expected the item processed")
+			}
+
+			expectedDir := svc.turnin.FailedDir
+			expectedStatus := turnin.ResultStatusFailed
+			if test.expectExpired {
+				expectedDir = svc.turnin.ExpiredDir
+				expectedStatus = turnin.ResultStatusExpired
+			}
+
+			_, err = os.Stat(filepath.Join(expectedDir, id))
+			if err != nil {
+				t.Fatalf("expected the item in %s - %v", expectedDir, err)
+			}
+
+			_, err = os.Stat(filepath.Join(svc.turnin.Dir, id))
+			if !os.IsNotExist(err) {
+				t.Errorf("expected the item not pending, got %v", err)
+			}
+
+			reason, err := os.ReadFile(filepath.Join(svc.turnin.ExpiredDir, id+turnin.ReasonFileExt))
+			if test.expectExpired {
+				if err != nil {
+					t.Fatalf("expected a reason file - %v", err)
+				}
+
+				if !strings.HasPrefix(string(reason), "expired at ") {
+					t.Errorf("unexpected reason %q", reason)
+				}
+			} else if !os.IsNotExist(err) {
+				t.Errorf("expected no reason file, got %v", err)
+			}
+
+			result, err := svc.turnin.ReadResult(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result == nil || result.Status != expectedStatus {
+				t.Errorf("expected result %s, got %+v", expectedStatus, result)
+			}
+		})
+	}
+}
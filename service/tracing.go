@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+
+	"github.com/cyverse/irods-rule-async-exec-cmd/commons"
+	amqp_mod "github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan starts a span, spans are dropped if tracing is disabled
+func (svc *AsyncExecCmdService) startSpan(ctx context.Context, name string, kind trace.SpanKind, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	var tracing *commons.Tracing
+	if svc != nil {
+		tracing = svc.tracing
+	}
+
+	return tracing.GetTracer(commons.TracerName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+}
+
+// amqpHeaderCarrier carries W3C trace context in AMQP message headers
+type amqpHeaderCarrier amqp_mod.Table
+
+// Get returns the value of the key
+func (carrier amqpHeaderCarrier) Get(key string) string {
+	if val, ok := carrier[key].(string); ok {
+		return val
+	}
+	return ""
+}
+
+// Set sets the value of the key
+func (carrier amqpHeaderCarrier) Set(key string, value string) {
+	carrier[key] = value
+}
+
+// Keys returns all keys
+func (carrier amqpHeaderCarrier) Keys() []string {
+	keys := []string{}
+	for key := range carrier {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// injectTraceContext injects W3C trace context of the span in ctx into the carrier
+func injectTraceContext(ctx context.Context, carrier propagation.TextMapCarrier) {
+	propagation.TraceContext{}.Inject(ctx, carrier)
+}
@@ -0,0 +1,35 @@
+package service
+
+import "fmt"
+
+// ValidationError is an error returned when a turn-in request has invalid values
+type ValidationError struct {
+	message string
+}
+
+// NewValidationError creates ValidationError struct
+func NewValidationError(message string) *ValidationError {
+	return &ValidationError{
+		message: message,
+	}
+}
+
+// NewValidationErrorf creates ValidationError struct
+func NewValidationErrorf(format string, v ...interface{}) *ValidationError {
+	return &ValidationError{
+		message: fmt.Sprintf(format, v...),
+	}
+}
+
+func (e *ValidationError) Error() string {
+	return e.message
+}
+
+// IsValidationError evaluates if the given error is ValidationError
+func IsValidationError(err error) bool {
+	if _, ok := err.(*ValidationError); ok {
+		return true
+	}
+
+	return false
+}
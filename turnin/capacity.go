@@ -0,0 +1,111 @@
+package turnin
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+)
+
+const (
+	// writeAccessMode is W_OK for access(2)
+	writeAccessMode uint32 = 0x2
+	// backlogCountBatchSize is the number of dir entries read at once when counting backlog
+	backlogCountBatchSize int = 1024
+)
+
+// CapacityLimits is a struct to store limits checked before writing a turn-in, zero values mean unlimited
+type CapacityLimits struct {
+	MinFreeBytes  uint64
+	MinFreeInodes uint64
+	MaxBacklog    int
+}
+
+// CheckCapacity checks if a turn-in can be written to the turn in dir
+// returns CapacityError if the dir is not writable, the disk is full or too many turn-ins are pending
+func (turnin *TurnIn) CheckCapacity() error {
+	err := syscall.Access(turnin.Dir, writeAccessMode)
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) {
+			return NewCapacityErrorf(PermissionDeniedCapacityErrorKind, "turn in dir (%s) does not exist", turnin.Dir)
+		}
+		return NewCapacityErrorf(PermissionDeniedCapacityErrorKind, "turn in dir (%s) is not writable - %v", turnin.Dir, err)
+	}
+
+	if turnin.Limits.MinFreeBytes > 0 || turnin.Limits.MinFreeInodes > 0 {
+		stat := syscall.Statfs_t{}
+		err = syscall.Statfs(turnin.Dir, &stat)
+		if err != nil {
+			return err
+		}
+
+		freeBytes := uint64(stat.Bavail) * uint64(stat.Bsize)
+		if turnin.Limits.MinFreeBytes > 0 && freeBytes < turnin.Limits.MinFreeBytes {
+			return NewCapacityErrorf(DiskFullCapacityErrorKind, "turn in dir (%s) has %d bytes free, less than %d bytes required", turnin.Dir, freeBytes, turnin.Limits.MinFreeBytes)
+		}
+
+		// some filesystems do not report inodes
+		if turnin.Limits.MinFreeInodes > 0 && stat.Files > 0 && uint64(stat.Ffree) < turnin.Limits.MinFreeInodes {
+			return NewCapacityErrorf(DiskFullCapacityErrorKind, "turn in dir (%s) has %d inodes free, less than %d inodes required", turnin.Dir, uint64(stat.Ffree), turnin.Limits.MinFreeInodes)
+		}
+	}
+
+	if turnin.Limits.MaxBacklog > 0 {
+		backlog, err := turnin.countBacklog(turnin.Limits.MaxBacklog)
+		if err != nil {
+			return err
+		}
+
+		if backlog >= turnin.Limits.MaxBacklog {
+			return NewCapacityErrorf(QueueFullCapacityErrorKind, "turn in dir (%s) has %d or more pending turn-ins, max backlog is %d", turnin.Dir, backlog, turnin.Limits.MaxBacklog)
+		}
+	}
+
+	return nil
+}
+
+// countBacklog counts pending turn-ins, stops counting once it reaches the max
+func (turnin *TurnIn) countBacklog(max int) (int, error) {
+	dir, err := os.Open(turnin.Dir)
+	if err != nil {
+		return 0, err
+	}
+	defer dir.Close()
+
+	count := 0
+	for count < max {
+		entries, err := dir.ReadDir(backlogCountBatchSize)
+		for _, entry := range entries {
+			if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				count++
+			}
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// convertWriteError converts errors occurred while writing a turn-in into CapacityError if possible
+func (turnin *TurnIn) convertWriteError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) {
+		return NewCapacityErrorf(DiskFullCapacityErrorKind, "turn in dir (%s) is full - %v", turnin.Dir, err)
+	}
+
+	if os.IsPermission(err) {
+		return NewCapacityErrorf(PermissionDeniedCapacityErrorKind, "turn in dir (%s) is not writable - %v", turnin.Dir, err)
+	}
+
+	return err
+}
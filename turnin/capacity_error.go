@@ -0,0 +1,71 @@
+package turnin
+
+import "fmt"
+
+// CapacityErrorKind is a kind of CapacityError
+type CapacityErrorKind string
+
+const (
+	QueueFullCapacityErrorKind        CapacityErrorKind = "queue_full"
+	DiskFullCapacityErrorKind         CapacityErrorKind = "disk_full"
+	PermissionDeniedCapacityErrorKind CapacityErrorKind = "permission_denied"
+)
+
+// CapacityError is an error returned when a turn-in cannot be written to the turn in dir
+type CapacityError struct {
+	kind    CapacityErrorKind
+	message string
+}
+
+// NewCapacityErrorf creates CapacityError struct
+func NewCapacityErrorf(kind CapacityErrorKind, format string, v ...interface{}) *CapacityError {
+	return &CapacityError{
+		kind:    kind,
+		message: fmt.Sprintf(format, v...),
+	}
+}
+
+func (e *CapacityError) Error() string {
+	return e.message
+}
+
+// GetKind returns kind of the error
+func (e *CapacityError) GetKind() CapacityErrorKind {
+	return e.kind
+}
+
+// IsCapacityError evaluates if the given error is CapacityError
+func IsCapacityError(err error) bool {
+	if _, ok := err.(*CapacityError); ok {
+		return true
+	}
+
+	return false
+}
+
+// IsQueueFullError evaluates if the given error is CapacityError for too many pending turn-ins
+func IsQueueFullError(err error) bool {
+	if capErr, ok := err.(*CapacityError); ok {
+		return capErr.kind == QueueFullCapacityErrorKind
+	}
+
+	return false
+}
+
+// IsDiskFullError evaluates if the given error is CapacityError for lack of free space or inodes
+func IsDiskFullError(err error) bool {
+	if capErr, ok := err.(*CapacityError); ok {
+		return capErr.kind == DiskFullCapacityErrorKind
+	}
+
+	return false
+}
+
+// IsPermissionDeniedError evaluates if the given error is CapacityError for lack of write permission
+func IsPermissionDeniedError(err error) bool {
+	if capErr, ok := err.(*CapacityError); ok {
+		return capErr.kind == PermissionDeniedCapacityErrorKind
+	}
+
+	return false
+}
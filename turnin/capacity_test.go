@@ -0,0 +1,80 @@
+package turnin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckCapacity(t *testing.T) {
+	tests := []struct {
+		name       string
+		limits     CapacityLimits
+		pending    int
+		hidden     int  // turn-ins being written, not counted
+		removeDir  bool // the turn in dir does not exist
+		expectKind CapacityErrorKind
+	}{
+		{name: "unlimited", pending: 5},
+		{name: "under max backlog", limits: CapacityLimits{MaxBacklog: 3}, pending: 2},
+		{name: "queue full", limits: CapacityLimits{MaxBacklog: 3}, pending: 3, expectKind: QueueFullCapacityErrorKind},
+		{name: "hidden turn-ins not counted", limits: CapacityLimits{MaxBacklog: 3}, pending: 2, hidden: 2},
+		{name: "disk full", limits: CapacityLimits{MinFreeBytes: 1 << 62}, expectKind: DiskFullCapacityErrorKind},
+		{name: "no turn in dir", removeDir: true, expectKind: PermissionDeniedCapacityErrorKind},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			turnin := NewTurnIn(filepath.Join(t.TempDir(), "turnin"))
+			err := turnin.MakeTurnInDir()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			turninTestItems(t, turnin, test.pending, NormalPriority)
+			turnin.Limits = test.limits
+
+			for i := 0; i < test.hidden; i++ {
+				err = os.WriteFile(filepath.Join(turnin.Dir, fmt.Sprintf(".hidden%d%s", i, turninTempFileExt)), []byte("{"), 0o666)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if test.removeDir {
+				err = os.RemoveAll(turnin.Dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			item := NewSendMessageRequest("irods.data-object.add", "{}")
+			err = turnin.Turnin(item)
+			if len(test.expectKind) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error - %v", err)
+				}
+				return
+			}
+
+			if !IsCapacityError(err) {
+				t.Fatalf("expected a capacity error, got %v", err)
+			}
+
+			if kind := err.(*CapacityError).GetKind(); kind != test.expectKind {
+				t.Errorf("expected kind %s, got %s", test.expectKind, kind)
+			}
+
+			if test.removeDir {
+				return
+			}
+
+			// rejected turn-ins are not written
+			pending := listTestDir(t, turnin.Dir)
+			if len(pending) != test.pending+test.hidden {
+				t.Errorf("expected %d files in the turn in dir, got %d", test.pending+test.hidden, len(pending))
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package turnin
+
+import "fmt"
+
+// DecodeError is an error returned when a turn-in item cannot be decoded
+type DecodeError struct {
+	message     string
+	newerSchema bool
+}
+
+// NewDecodeError creates DecodeError struct
+func NewDecodeError(message string) *DecodeError {
+	return &DecodeError{
+		message: message,
+	}
+}
+
+// NewDecodeErrorf creates DecodeError struct
+func NewDecodeErrorf(format string, v ...interface{}) *DecodeError {
+	return &DecodeError{
+		message: fmt.Sprintf(format, v...),
+	}
+}
+
+// NewNewerSchemaDecodeErrorf creates DecodeError struct for items written in newer schema that this version does not understand
+func NewNewerSchemaDecodeErrorf(format string, v ...interface{}) *DecodeError {
+	return &DecodeError{
+		message:     fmt.Sprintf(format, v...),
+		newerSchema: true,
+	}
+}
+
+func (e *DecodeError) Error() string {
+	return e.message
+}
+
+// IsNewerSchema returns true if the item is written in newer schema, so newer versions may decode it
+func (e *DecodeError) IsNewerSchema() bool {
+	return e.newerSchema
+}
+
+// IsDecodeError evaluates if the given error is DecodeError
+func IsDecodeError(err error) bool {
+	if _, ok := err.(*DecodeError); ok {
+		return true
+	}
+
+	return false
+}
+
+// IsNewerSchemaDecodeError evaluates if the given error is DecodeError for items written in newer schema
+func IsNewerSchemaDecodeError(err error) bool {
+	if decodeErr, ok := err.(*DecodeError); ok {
+		return decodeErr.IsNewerSchema()
+	}
+
+	return false
+}
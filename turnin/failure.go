@@ -0,0 +1,114 @@
+package turnin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// FailureRecordFileExt is an extension of a sidecar file that stores why a turn-in failed
+	FailureRecordFileExt string = ".error.json"
+)
+
+// ErrorClass is a class of errors that made turn-ins fail
+type ErrorClass string
+
+const (
+	ErrorClassDecode        ErrorClass = "decode"
+	ErrorClassValidation    ErrorClass = "validation"
+	ErrorClassRemote4xx     ErrorClass = "remote_4xx"
+	ErrorClassRemote5xx     ErrorClass = "remote_5xx"
+	ErrorClassRemote        ErrorClass = "remote"
+	ErrorClassIRODS         ErrorClass = "irods"
+	ErrorClassAMQP          ErrorClass = "amqp"
+	ErrorClassKafka         ErrorClass = "kafka"
+	ErrorClassNats          ErrorClass = "nats"
+	ErrorClassNotReady      ErrorClass = "not_ready"
+	ErrorClassNotConfigured ErrorClass = "not_configured"
+	ErrorClassIO            ErrorClass = "io"
+	ErrorClassUnknown       ErrorClass = "unknown"
+)
+
+// AttemptRecord is a record of an attempt to process a turn-in
+type AttemptRecord struct {
+	Time       time.Time  `json:"time"`
+	Error      string     `json:"error,omitempty"`
+	ErrorClass ErrorClass `json:"error_class,omitempty"`
+}
+
+// FailureRecord is a sidecar record stored next to a failed turn-in
+type FailureRecord struct {
+	Error          string            `json:"error"`
+	ErrorClass     ErrorClass        `json:"error_class"`
+	RequestID      string            `json:"request_id,omitempty"`
+	RequestType    TurnInRequestType `json:"request_type,omitempty"`
+	Hostname       string            `json:"hostname"`
+	ServiceVersion string            `json:"service_version"`
+	CreationTime   time.Time         `json:"creation_time"` // creation time of the turn-in
+	FailedTime     time.Time         `json:"failed_time"`
+	Attempts       []AttemptRecord   `json:"attempts"`
+
+	// attempts interrupted while in-flight in previous runs, not in Attempts
+	InterruptedAttempts int `json:"interrupted_attempts,omitempty"`
+}
+
+// NewFailureRecord creates a FailureRecord for the item, item can be nil if it could not be decoded
+func NewFailureRecord(item TurnInItem, err error, errorClass ErrorClass) *FailureRecord {
+	hostname, hostErr := os.Hostname()
+	if hostErr != nil {
+		hostname = ""
+	}
+
+	record := &FailureRecord{
+		ErrorClass: errorClass,
+		Hostname:   hostname,
+		FailedTime: time.Now(),
+		Attempts:   []AttemptRecord{},
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	if item != nil {
+		record.RequestID = item.GetRequestID()
+		record.RequestType = item.GetRequestType()
+		record.CreationTime = item.GetCreationTime()
+		record.InterruptedAttempts = item.GetAttempts()
+	}
+
+	return record
+}
+
+// NewFailureRecordFromFile reads a FailureRecord stored next to a failed turn-in
+func NewFailureRecordFromFile(failedItemPath string) (*FailureRecord, error) {
+	bytes, err := os.ReadFile(GetFailureRecordFilePath(failedItemPath))
+	if err != nil {
+		return nil, err
+	}
+
+	record := FailureRecord{}
+	err = json.Unmarshal(bytes, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// GetFailureRecordFilePath returns a path of a sidecar file for the failed turn-in
+func GetFailureRecordFilePath(failedItemPath string) string {
+	return fmt.Sprintf("%s%s", failedItemPath, FailureRecordFileExt)
+}
+
+// SaveToFile saves the record to a file
+func (record *FailureRecord) SaveToFile(path string) error {
+	bytes, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, bytes, 0o666)
+}
@@ -0,0 +1,394 @@
+package turnin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// InflightDirName is a dir in the turn in dir having turn-ins claimed by service instances, a sub dir per instance
+	InflightDirName string = "inflight"
+	// LeaseFileExt is an extension of a file that stores the lease of an instance on turn-ins it claimed
+	LeaseFileExt string = ".lease"
+	// leaseTempFileExt is an extension of a lease file or a turn-in being written
+	leaseTempFileExt string = ".tmp"
+)
+
+// LeaseRecord is a lease of an instance on turn-ins in its inflight dir, renewed while the instance is alive
+type LeaseRecord struct {
+	Instance    string    `json:"instance"`
+	PID         int       `json:"pid"`
+	RenewedTime time.Time `json:"renewed_time"`
+	ExpiryTime  time.Time `json:"expiry_time"`
+}
+
+// IsExpired returns true if the lease is expired
+func (record *LeaseRecord) IsExpired(now time.Time) bool {
+	return !now.Before(record.ExpiryTime)
+}
+
+// IsClaimEnabled returns true if turn-ins are claimed before processing, to share the turn in dir with other instances
+func (turnin *TurnIn) IsClaimEnabled() bool {
+	return len(turnin.Instance) > 0
+}
+
+// getInstanceInflightDir returns a dir having turn-ins claimed by the instance
+func (turnin *TurnIn) getInstanceInflightDir(instance string) string {
+	return filepath.Join(turnin.InflightDir, instance)
+}
+
+// getLeaseFilePath returns a path of a lease file of the instance
+func (turnin *TurnIn) getLeaseFilePath(instance string) string {
+	return filepath.Join(turnin.InflightDir, fmt.Sprintf("%s%s", instance, LeaseFileExt))
+}
+
+// RenewLease writes the lease of this instance, expiring after LeaseDuration
+func (turnin *TurnIn) RenewLease() error {
+	if !turnin.IsClaimEnabled() {
+		return nil
+	}
+
+	// the dir may be removed by others while no turn-ins are claimed
+	err := makeDir(turnin.getInstanceInflightDir(turnin.Instance), "inflight turn in dir")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	record := &LeaseRecord{
+		Instance:    turnin.Instance,
+		PID:         os.Getpid(),
+		RenewedTime: now,
+		ExpiryTime:  now.Add(turnin.LeaseDuration),
+	}
+
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file then rename, not to let others read partially written lease
+	leaseFilePath := turnin.getLeaseFilePath(turnin.Instance)
+	tempFilePath := fmt.Sprintf("%s%s", leaseFilePath, leaseTempFileExt)
+
+	err = os.WriteFile(tempFilePath, bytes, 0o666)
+	if err != nil {
+		os.Remove(tempFilePath)
+		return err
+	}
+
+	err = os.Rename(tempFilePath, leaseFilePath)
+	if err != nil {
+		os.Remove(tempFilePath)
+		return err
+	}
+
+	atomic.StoreInt64(&turnin.leaseExpiryTime, record.ExpiryTime.UnixNano())
+	return nil
+}
+
+// HasLease returns true if the lease of this instance is not expired
+func (turnin *TurnIn) HasLease(now time.Time) bool {
+	if !turnin.IsClaimEnabled() {
+		return true
+	}
+
+	return now.UnixNano() < atomic.LoadInt64(&turnin.leaseExpiryTime)
+}
+
+// ReleaseLease returns turn-ins claimed back to the turn in dir and removes the lease, to let others process them immediately
+func (turnin *TurnIn) ReleaseLease() error {
+	if !turnin.IsClaimEnabled() {
+		return nil
+	}
+
+	atomic.StoreInt64(&turnin.leaseExpiryTime, 0)
+
+	_, err := turnin.moveInflightBack(turnin.Instance)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(turnin.getLeaseFilePath(turnin.Instance))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ReadLease reads the lease of the instance, returns nil if the instance does not have a lease
+func (turnin *TurnIn) ReadLease(instance string) (*LeaseRecord, error) {
+	bytes, err := os.ReadFile(turnin.getLeaseFilePath(instance))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	record := LeaseRecord{}
+	err = json.Unmarshal(bytes, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse lease of instance %s - %v", instance, err)
+	}
+
+	return &record, nil
+}
+
+// RecoverInflight returns turn-ins left in-flight by a previous run of this instance back to the turn in dir
+// attempts of the turn-ins are incremented, as they may be processed partially
+// must be called before claiming turn-ins, returns turn-ins recovered
+// the lease is not checked, the caller must make sure no other process runs as the instance, e.g., with the instance lock
+func (turnin *TurnIn) RecoverInflight() ([]TurnInItem, error) {
+	if !turnin.IsClaimEnabled() {
+		return nil, nil
+	}
+
+	return turnin.recoverInflight(turnin.Instance)
+}
+
+// ReclaimExpiredLeases returns turn-ins in-flight in other instances whose leases are expired back to the turn in dir
+// inflight dirs without leases are reclaimed once they are not modified for LeaseDuration
+// expiry and modification times are compared with the local clock, clocks of hosts sharing the dir must be synchronized
+// attempts of the turn-ins are incremented, as they may be processed partially
+// returns turn-ins reclaimed
+func (turnin *TurnIn) ReclaimExpiredLeases(now time.Time) ([]TurnInItem, error) {
+	if !turnin.IsClaimEnabled() {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(turnin.InflightDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	reclaimed := []TurnInItem{}
+	var lastErr error
+	for _, entry := range entries {
+		instance := entry.Name()
+		if !entry.IsDir() || instance == turnin.Instance {
+			continue
+		}
+
+		lease, leaseErr := turnin.ReadLease(instance)
+		if leaseErr != nil {
+			lastErr = leaseErr
+			continue
+		}
+
+		if lease != nil && !lease.IsExpired(now) {
+			continue
+		}
+
+		if lease == nil {
+			// an instance without a lease has released its turn-ins, died before writing the lease,
+			// or is starting up, having made its dir but not renamed its lease in yet
+			info, infoErr := entry.Info()
+			if infoErr != nil {
+				if !os.IsNotExist(infoErr) {
+					lastErr = infoErr
+				}
+				continue
+			}
+
+			if now.Sub(info.ModTime()) < turnin.LeaseDuration {
+				continue
+			}
+		}
+
+		items, recoverErr := turnin.recoverInflight(instance)
+		reclaimed = append(reclaimed, items...)
+		if recoverErr != nil {
+			lastErr = recoverErr
+		}
+	}
+
+	return reclaimed, lastErr
+}
+
+// recoverInflight returns turn-ins in-flight in the instance back to the turn in dir, incrementing their attempts
+// turn-ins of other instances are claimed first, not to be recovered by two instances
+func (turnin *TurnIn) recoverInflight(instance string) ([]TurnInItem, error) {
+	inflightDir := turnin.getInstanceInflightDir(instance)
+
+	files, err := os.ReadDir(inflightDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	recovered := []TurnInItem{}
+	var lastErr error
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		fullpath := filepath.Join(inflightDir, file.Name())
+		if instance != turnin.Instance {
+			claimedPath, claimErr := turnin.claim(fullpath)
+			if claimErr != nil {
+				if !os.IsNotExist(claimErr) {
+					lastErr = claimErr
+				}
+				// recovered by others
+				continue
+			}
+
+			fullpath = claimedPath
+		}
+
+		item, recoverErr := turnin.recoverItem(fullpath)
+		if recoverErr != nil {
+			lastErr = recoverErr
+			continue
+		}
+
+		if item != nil {
+			recovered = append(recovered, item)
+		}
+	}
+
+	return recovered, lastErr
+}
+
+// recoverItem increments attempts of the turn-in claimed by this instance, and moves it back to the turn in dir
+// turn-ins that cannot be decoded are moved back as they are, returns nil item for them
+func (turnin *TurnIn) recoverItem(fullpath string) (TurnInItem, error) {
+	pendingPath := filepath.Join(turnin.Dir, filepath.Base(fullpath))
+
+	item, err := NewTurnInRequestFromFile(fullpath)
+	if err != nil {
+		if IsDecodeError(err) {
+			// scrape handles it
+			return nil, os.Rename(fullpath, pendingPath)
+		}
+		return nil, err
+	}
+
+	item.SetAttempts(item.GetAttempts() + 1)
+
+	// write to a temp file then rename, not to leave partially written turn-in
+	tempFilePath := filepath.Join(filepath.Dir(fullpath), fmt.Sprintf(".%s%s", filepath.Base(fullpath), leaseTempFileExt))
+	err = item.SaveToFile(tempFilePath)
+	if err != nil {
+		os.Remove(tempFilePath)
+		return nil, err
+	}
+
+	err = os.Rename(tempFilePath, fullpath)
+	if err != nil {
+		os.Remove(tempFilePath)
+		return nil, err
+	}
+
+	err = os.Rename(fullpath, pendingPath)
+	if err != nil {
+		return nil, err
+	}
+
+	item.SetItemFilePath(pendingPath)
+
+	// items written by old clients do not have request IDs, use their IDs to correlate logs
+	if len(item.GetRequestID()) == 0 {
+		item.SetRequestID(GetItemID(item))
+	}
+
+	return item, nil
+}
+
+// moveInflightBack moves turn-ins claimed by the instance back to the turn in dir as they are, returns IDs of turn-ins moved
+func (turnin *TurnIn) moveInflightBack(instance string) ([]string, error) {
+	inflightDir := turnin.getInstanceInflightDir(instance)
+
+	files, err := os.ReadDir(inflightDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	moved := []string{}
+	var lastErr error
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		err := os.Rename(filepath.Join(inflightDir, file.Name()), filepath.Join(turnin.Dir, file.Name()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// moved by others
+				continue
+			}
+
+			lastErr = err
+			continue
+		}
+
+		moved = append(moved, file.Name())
+	}
+
+	return moved, lastErr
+}
+
+// claim moves a turn-in into the inflight dir of this instance, returns the new path
+// returns an error satisfying os.IsNotExist if others claimed it first
+func (turnin *TurnIn) claim(fullpath string) (string, error) {
+	claimedPath := filepath.Join(turnin.getInstanceInflightDir(turnin.Instance), filepath.Base(fullpath))
+
+	// rename is atomic, only one instance succeeds
+	err := os.Rename(fullpath, claimedPath)
+	if err != nil {
+		return "", err
+	}
+
+	return claimedPath, nil
+}
+
+// Unclaim returns a turn-in claimed but not processed back to the turn in dir
+// does nothing if the turn-in is processed, or not claimed
+func (turnin *TurnIn) Unclaim(item TurnInItem) error {
+	fullpath := item.GetItemFilePath()
+	if !turnin.IsClaimEnabled() || len(fullpath) == 0 || filepath.Dir(fullpath) != turnin.getInstanceInflightDir(turnin.Instance) {
+		return nil
+	}
+
+	pendingPath := filepath.Join(turnin.Dir, filepath.Base(fullpath))
+	err := os.Rename(fullpath, pendingPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// processed
+			return nil
+		}
+		return err
+	}
+
+	item.SetItemFilePath(pendingPath)
+	return nil
+}
+
+// IsClaimValid returns true if this instance still holds the turn-in, not reclaimed by others
+func (turnin *TurnIn) IsClaimValid(item TurnInItem, now time.Time) bool {
+	if !turnin.IsClaimEnabled() {
+		return true
+	}
+
+	if !turnin.HasLease(now) {
+		return false
+	}
+
+	_, err := os.Stat(item.GetItemFilePath())
+	return err == nil
+}
@@ -0,0 +1,350 @@
+package turnin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestInstance returns a turn in dir claimed by the instance, holding a lease
+func newTestInstance(t *testing.T, dir string, instance string) *TurnIn {
+	t.Helper()
+
+	turnin := NewTurnIn(dir)
+	turnin.Instance = instance
+	turnin.LeaseDuration = time.Minute
+
+	err := turnin.MakeTurnInDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = turnin.RenewLease()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return turnin
+}
+
+// turninTestItems turns in items of the priority, returns their IDs
+func turninTestItems(t *testing.T, turnin *TurnIn, count int, priority TurnInPriority) []string {
+	t.Helper()
+
+	ids := []string{}
+	for i := 0; i < count; i++ {
+		item := NewSendMessageRequest("irods.data-object.add", fmt.Sprintf(`{"seq": %d}`, i))
+		item.SetPriority(priority)
+
+		err := turnin.Turnin(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, GetItemID(item))
+	}
+
+	return ids
+}
+
+// listTestDir returns names of files in the dir
+func listTestDir(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names
+}
+
+func TestScrapeClaimRace(t *testing.T) {
+	dir := t.TempDir()
+	instances := []*TurnIn{
+		newTestInstance(t, dir, "host1"),
+		newTestInstance(t, dir, "host2"),
+	}
+
+	ids := turninTestItems(t, instances[0], 200, NormalPriority)
+
+	claimed := make([][]TurnInItem, len(instances))
+	wg := sync.WaitGroup{}
+	for i := range instances {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// scrape until nothing is left, as the other instance does
+			for {
+				items, err := instances[i].Scrape()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				if len(items) == 0 {
+					return
+				}
+
+				claimed[i] = append(claimed[i], items...)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	owners := map[string]string{}
+	for i, items := range claimed {
+		for _, item := range items {
+			id := GetItemID(item)
+			if owner, ok := owners[id]; ok {
+				t.Errorf("turn-in %s claimed by %s and %s", id, owner, instances[i].Instance)
+			}
+			owners[id] = instances[i].Instance
+
+			if filepath.Dir(item.GetItemFilePath()) != instances[i].getInstanceInflightDir(instances[i].Instance) {
+				t.Errorf("turn-in %s claimed by %s is at %s", id, instances[i].Instance, item.GetItemFilePath())
+			}
+		}
+	}
+
+	for _, id := range ids {
+		if _, ok := owners[id]; !ok {
+			t.Errorf("turn-in %s is not claimed", id)
+		}
+	}
+
+	if pending := listTestDir(t, dir); len(pending) != 0 {
+		t.Errorf("expected no pending turn-ins, got %d", len(pending))
+	}
+}
+
+func TestScrapeClaimLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int
+		normal        int
+		high          int
+		expectClaimed int
+		expectHigh    int
+	}{
+		{name: "no limit", normal: 5, high: 2, expectClaimed: 7, expectHigh: 2},
+		{name: "under limit", limit: 10, normal: 5, high: 2, expectClaimed: 7, expectHigh: 2},
+		{name: "limited", limit: 3, normal: 5, high: 2, expectClaimed: 3, expectHigh: 2},
+		{name: "high priority first", limit: 2, normal: 5, high: 4, expectClaimed: 2, expectHigh: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			turnin := newTestInstance(t, dir, "host1")
+			turnin.ScrapeLimit = test.limit
+
+			// normal items are older, high items still go first
+			turninTestItems(t, turnin, test.normal, NormalPriority)
+			turninTestItems(t, turnin, test.high, HighPriority)
+
+			items, err := turnin.Scrape()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(items) != test.expectClaimed {
+				t.Fatalf("expected %d turn-ins claimed, got %d", test.expectClaimed, len(items))
+			}
+
+			high := 0
+			for _, item := range items {
+				if item.GetPriority() == HighPriority {
+					high++
+				}
+			}
+
+			if high != test.expectHigh {
+				t.Errorf("expected %d high priority turn-ins claimed, got %d", test.expectHigh, high)
+			}
+
+			pending := listTestDir(t, dir)
+			if len(pending) != test.normal+test.high-test.expectClaimed {
+				t.Errorf("expected %d turn-ins left pending, got %d", test.normal+test.high-test.expectClaimed, len(pending))
+			}
+		})
+	}
+}
+
+func TestReclaimExpiredLeases(t *testing.T) {
+	tests := []struct {
+		name           string
+		removeLease    bool          // the instance died before writing its lease
+		after          time.Duration // time passed since the instance claimed turn-ins
+		expectReclaims bool
+	}{
+		{name: "live lease", after: 30 * time.Second},
+		{name: "expired lease", after: 2 * time.Minute, expectReclaims: true},
+		{name: "no lease in grace period", removeLease: true, after: 30 * time.Second},
+		{name: "no lease after grace period", removeLease: true, after: 2 * time.Minute, expectReclaims: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dead := newTestInstance(t, dir, "host1")
+			alive := newTestInstance(t, dir, "host2")
+
+			ids := turninTestItems(t, dead, 3, NormalPriority)
+
+			claimed, err := dead.Scrape()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(claimed) != len(ids) {
+				t.Fatalf("expected %d turn-ins claimed, got %d", len(ids), len(claimed))
+			}
+
+			if test.removeLease {
+				err = os.Remove(dead.getLeaseFilePath(dead.Instance))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			reclaimed, err := alive.ReclaimExpiredLeases(time.Now().Add(test.after))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			inflight := listTestDir(t, dead.getInstanceInflightDir(dead.Instance))
+			pending := listTestDir(t, dir)
+
+			if !test.expectReclaims {
+				if len(reclaimed) != 0 || len(pending) != 0 {
+					t.Fatalf("expected nothing reclaimed, got %d reclaimed, %d pending", len(reclaimed), len(pending))
+				}
+
+				if len(inflight) != len(ids) {
+					t.Errorf("expected %d turn-ins left in-flight, got %d", len(ids), len(inflight))
+				}
+				return
+			}
+
+			if len(reclaimed) != len(ids) || len(pending) != len(ids) {
+				t.Fatalf("expected %d turn-ins reclaimed, got %d reclaimed, %d pending", len(ids), len(reclaimed), len(pending))
+			}
+
+			if len(inflight) != 0 {
+				t.Errorf("expected no turn-ins left in-flight, got %d", len(inflight))
+			}
+
+			for _, item := range reclaimed {
+				if item.GetAttempts() != 1 {
+					t.Errorf("expected attempts of turn-in %s 1, got %d", GetItemID(item), item.GetAttempts())
+				}
+
+				if filepath.Dir(item.GetItemFilePath()) != dir {
+					t.Errorf("expected turn-in %s in the turn in dir, got %s", GetItemID(item), item.GetItemFilePath())
+				}
+			}
+		})
+	}
+}
+
+func TestRecoverInflight(t *testing.T) {
+	dir := t.TempDir()
+	turnin := newTestInstance(t, dir, "host1")
+
+	ids := turninTestItems(t, turnin, 2, NormalPriority)
+
+	// the instance crashes twice while the turn-ins are in-flight
+	for run := 1; run <= 2; run++ {
+		claimed, err := turnin.Scrape()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(claimed) != len(ids) {
+			t.Fatalf("run %d: expected %d turn-ins claimed, got %d", run, len(ids), len(claimed))
+		}
+
+		// restarts
+		turnin = newTestInstance(t, dir, "host1")
+		recovered, err := turnin.RecoverInflight()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(recovered) != len(ids) {
+			t.Fatalf("run %d: expected %d turn-ins recovered, got %d", run, len(ids), len(recovered))
+		}
+
+		for _, item := range recovered {
+			if item.GetAttempts() != run {
+				t.Errorf("run %d: expected attempts of turn-in %s %d, got %d", run, GetItemID(item), run, item.GetAttempts())
+			}
+
+			// the count is stored
+			stored, err := NewTurnInRequestFromFile(item.GetItemFilePath())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stored.GetAttempts() != run {
+				t.Errorf("run %d: expected stored attempts of turn-in %s %d, got %d", run, GetItemID(item), run, stored.GetAttempts())
+			}
+		}
+	}
+}
+
+func TestRecoverInflightUndecodable(t *testing.T) {
+	dir := t.TempDir()
+	turnin := newTestInstance(t, dir, "host1")
+
+	// written partially by an old client, then claimed
+	name := "1665000000000000-100-000001"
+	err := os.WriteFile(filepath.Join(turnin.getInstanceInflightDir(turnin.Instance), name), []byte(`{"type": "send_message", "ke`), 0o666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recovered, err := turnin.RecoverInflight()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recovered) != 0 {
+		t.Errorf("expected no turn-ins recovered, got %d", len(recovered))
+	}
+
+	// moved back as it is, the scrape quarantines it
+	pending := listTestDir(t, dir)
+	if len(pending) != 1 || pending[0] != name {
+		t.Fatalf("expected %s back in the turn in dir, got %v", name, pending)
+	}
+
+	_, err = turnin.Scrape()
+	if err == nil {
+		t.Error("expected a decode error, got nil")
+	}
+
+	quarantined := listTestDir(t, turnin.QuarantineDir)
+	found := false
+	for _, quarantinedName := range quarantined {
+		if quarantinedName == name {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("expected %s quarantined, got %v", name, quarantined)
+	}
+}
@@ -0,0 +1,135 @@
+package turnin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// ResultFileExt is an extension of a file that stores the result of a turn-in
+	ResultFileExt string = ".json"
+	// resultTempFileExt is an extension of a result file being written
+	resultTempFileExt string = ".tmp"
+)
+
+// ResultStatus is a status of a turn-in processed
+type ResultStatus string
+
+const (
+	ResultStatusSuccess     ResultStatus = "success"
+	ResultStatusFailed      ResultStatus = "failed"
+	ResultStatusExpired     ResultStatus = "expired"
+	ResultStatusQuarantined ResultStatus = "quarantined"
+)
+
+// ResultRecord is a record of a turn-in processed, written for clients waiting for completion
+type ResultRecord struct {
+	ID            string            `json:"id"`
+	RequestID     string            `json:"request_id,omitempty"`
+	RequestType   TurnInRequestType `json:"request_type,omitempty"`
+	Status        ResultStatus      `json:"status"`
+	Error         string            `json:"error,omitempty"`
+	ErrorClass    ErrorClass        `json:"error_class,omitempty"`
+	CompletedTime time.Time         `json:"completed_time"`
+}
+
+// NewResultRecord creates a ResultRecord for the item
+func NewResultRecord(item TurnInItem, status ResultStatus, err error, errorClass ErrorClass) *ResultRecord {
+	record := &ResultRecord{
+		ID:            GetItemID(item),
+		RequestID:     item.GetRequestID(),
+		RequestType:   item.GetRequestType(),
+		Status:        status,
+		ErrorClass:    errorClass,
+		CompletedTime: time.Now(),
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	return record
+}
+
+// getResultFilePath returns a path of a result file for the turn-in ID
+func (turnin *TurnIn) getResultFilePath(id string) string {
+	return filepath.Join(turnin.ResultDir, fmt.Sprintf("%s%s", id, ResultFileExt))
+}
+
+// WriteResult writes the result of a turn-in, for clients waiting for completion
+func (turnin *TurnIn) WriteResult(record *ResultRecord) error {
+	if len(record.ID) == 0 {
+		return fmt.Errorf("failed to write a result without turn-in ID")
+	}
+
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file then rename, not to let clients read partially written result
+	resultFilePath := turnin.getResultFilePath(record.ID)
+	tempFilePath := fmt.Sprintf("%s%s", resultFilePath, resultTempFileExt)
+
+	err = os.WriteFile(tempFilePath, bytes, 0o666)
+	if err != nil {
+		os.Remove(tempFilePath)
+		return err
+	}
+
+	return os.Rename(tempFilePath, resultFilePath)
+}
+
+// ReadResult reads the result of a turn-in, returns nil if the result is not available yet
+func (turnin *TurnIn) ReadResult(id string) (*ResultRecord, error) {
+	bytes, err := os.ReadFile(turnin.getResultFilePath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	record := ResultRecord{}
+	err = json.Unmarshal(bytes, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// RemoveResult removes the result of a turn-in
+func (turnin *TurnIn) RemoveResult(id string) error {
+	err := os.Remove(turnin.getResultFilePath(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// WaitResult waits for the result of a turn-in, 0 timeout to wait forever
+// returns nil if the result is not available in time
+func (turnin *TurnIn) WaitResult(id string, timeout time.Duration, pollInterval time.Duration) (*ResultRecord, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		record, err := turnin.ReadResult(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if record != nil {
+			return record, nil
+		}
+
+		if timeout > 0 && time.Now().After(deadline) {
+			return nil, nil
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
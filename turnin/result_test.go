@@ -0,0 +1,72 @@
+package turnin
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitResult(t *testing.T) {
+	tests := []struct {
+		name         string
+		writeAfter   time.Duration // the result is written after, not written if negative
+		status       ResultStatus
+		err          error
+		expectResult bool
+	}{
+		{name: "written before", status: ResultStatusSuccess, expectResult: true},
+		{name: "written while waiting", writeAfter: 50 * time.Millisecond, status: ResultStatusSuccess, expectResult: true},
+		{name: "failed", status: ResultStatusFailed, err: errors.New("rejected"), expectResult: true},
+		{name: "not written", writeAfter: -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			turnin := NewTurnIn(t.TempDir())
+			err := turnin.MakeTurnInDir()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			item := NewSendMessageRequest("irods.data-object.add", "{}")
+			item.SetResultRequested(true)
+			err = turnin.Turnin(item)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			record := NewResultRecord(item, test.status, test.err, "")
+			written := make(chan error, 1)
+			if test.writeAfter >= 0 {
+				go func() {
+					time.Sleep(test.writeAfter)
+					written <- turnin.WriteResult(record)
+				}()
+			}
+
+			result, err := turnin.WaitResult(GetItemID(item), time.Second, 10*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !test.expectResult {
+				if result != nil {
+					t.Fatalf("expected no result, got %+v", result)
+				}
+				return
+			}
+
+			if writeErr := <-written; writeErr != nil {
+				t.Fatal(writeErr)
+			}
+
+			if result == nil {
+				t.Fatal("expected a result, got nil")
+			}
+
+			if result.ID != record.ID || result.RequestID != item.GetRequestID() || result.Status != record.Status || result.Error != record.Error {
+				t.Errorf("expected result %+v, got %+v", record, result)
+			}
+		})
+	}
+}
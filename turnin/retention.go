@@ -0,0 +1,234 @@
+package turnin
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy is a policy to prune items in a spool dir, zero values mean unlimited
+type RetentionPolicy struct {
+	MaxAge        time.Duration
+	MaxFileCount  int
+	MaxTotalBytes int64
+	// Archive compresses pruned items into a dated tarball in ArchiveDir instead of deleting them
+	Archive bool
+}
+
+// IsUnlimited returns true if the policy does not prune anything
+func (policy *RetentionPolicy) IsUnlimited() bool {
+	return policy.MaxAge <= 0 && policy.MaxFileCount <= 0 && policy.MaxTotalBytes <= 0
+}
+
+// spoolEntry is an item in a spool dir, with its sidecar files
+type spoolEntry struct {
+	name    string
+	files   []string
+	size    int64
+	modTime time.Time
+}
+
+// getSpoolEntryName returns name of the item the file belongs to, stripping sidecar extensions
+func getSpoolEntryName(filename string) string {
+	for _, ext := range []string{FailureRecordFileExt, ReasonFileExt} {
+		if strings.HasSuffix(filename, ext) && len(filename) > len(ext) {
+			return filename[:len(filename)-len(ext)]
+		}
+	}
+	return filename
+}
+
+// listSpoolEntries lists items in the dir, oldest first
+func listSpoolEntries(dir string) ([]*spoolEntry, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entryMap := map[string]*spoolEntry{}
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			// removed in the middle
+			continue
+		}
+
+		name := getSpoolEntryName(dirEntry.Name())
+		entry, ok := entryMap[name]
+		if !ok {
+			entry = &spoolEntry{
+				name: name,
+			}
+			entryMap[name] = entry
+		}
+
+		entry.files = append(entry.files, filepath.Join(dir, dirEntry.Name()))
+		entry.size += info.Size()
+		if info.ModTime().After(entry.modTime) {
+			entry.modTime = info.ModTime()
+		}
+	}
+
+	entries := []*spoolEntry{}
+	for _, entry := range entryMap {
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i int, j int) bool {
+		if entries[i].modTime.Equal(entries[j].modTime) {
+			return entries[i].name < entries[j].name
+		}
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+
+	return entries, nil
+}
+
+// selectEntriesToPrune returns entries that violate the policy, entries must be sorted oldest first
+func selectEntriesToPrune(entries []*spoolEntry, policy *RetentionPolicy, now time.Time) []*spoolEntry {
+	totalBytes := int64(0)
+	for _, entry := range entries {
+		totalBytes += entry.size
+	}
+
+	pruneCount := 0
+	remainCount := len(entries)
+	for _, entry := range entries {
+		expired := policy.MaxAge > 0 && now.Sub(entry.modTime) > policy.MaxAge
+		tooMany := policy.MaxFileCount > 0 && remainCount > policy.MaxFileCount
+		tooLarge := policy.MaxTotalBytes > 0 && totalBytes > policy.MaxTotalBytes
+
+		if !expired && !tooMany && !tooLarge {
+			break
+		}
+
+		pruneCount++
+		remainCount--
+		totalBytes -= entry.size
+	}
+
+	return entries[:pruneCount]
+}
+
+// Prune prunes items in the dir to follow the policy, returns the number of items pruned
+func (turnin *TurnIn) Prune(dir string, policy RetentionPolicy) (int, error) {
+	if policy.IsUnlimited() {
+		return 0, nil
+	}
+
+	entries, err := listSpoolEntries(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	pruneEntries := selectEntriesToPrune(entries, &policy, time.Now())
+	if len(pruneEntries) == 0 {
+		return 0, nil
+	}
+
+	if policy.Archive {
+		err = turnin.archiveEntries(dir, pruneEntries)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for _, entry := range pruneEntries {
+		for _, file := range entry.files {
+			removeErr := os.Remove(file)
+			if removeErr != nil && !os.IsNotExist(removeErr) {
+				err = removeErr
+			}
+		}
+	}
+
+	return len(pruneEntries), err
+}
+
+// archiveEntries compresses entries into a dated tarball in archive dir
+func (turnin *TurnIn) archiveEntries(dir string, entries []*spoolEntry) error {
+	err := makeDir(turnin.ArchiveDir, "archive turn in dir")
+	if err != nil {
+		return err
+	}
+
+	tarballName := fmt.Sprintf("%s-%s.tar.gz", filepath.Base(dir), time.Now().Format("20060102T150405.000000"))
+	tarballPath := filepath.Join(turnin.ArchiveDir, tarballName)
+
+	tarballFile, err := os.OpenFile(tarballPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o664)
+	if err != nil {
+		return fmt.Errorf("failed to create an archive %s - %v", tarballPath, err)
+	}
+
+	gzipWriter := gzip.NewWriter(tarballFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, entry := range entries {
+		for _, file := range entry.files {
+			err = addFileToTar(tarWriter, file)
+			if err != nil {
+				break
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = tarWriter.Close()
+	}
+
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+
+	closeErr := tarballFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tarballPath)
+		return fmt.Errorf("failed to archive items to %s - %v", tarballPath, err)
+	}
+
+	return nil
+}
+
+func addFileToTar(tarWriter *tar.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+
+	err = tarWriter.WriteHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tarWriter, file)
+	return err
+}
@@ -0,0 +1,106 @@
+package turnin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+
+	// items in the spool, oldest first, 10 bytes each with their reason files
+	items := []struct {
+		name string
+		age  time.Duration
+	}{
+		{name: "item1", age: 3 * time.Hour},
+		{name: "item2", age: 2 * time.Hour},
+		{name: "item3", age: time.Hour},
+		{name: "item4", age: time.Minute},
+	}
+
+	tests := []struct {
+		name         string
+		policy       RetentionPolicy
+		expectPruned []string
+	}{
+		{name: "unlimited", policy: RetentionPolicy{}},
+		{name: "max age", policy: RetentionPolicy{MaxAge: 90 * time.Minute}, expectPruned: []string{"item1", "item2"}},
+		{name: "max file count", policy: RetentionPolicy{MaxFileCount: 3}, expectPruned: []string{"item1"}},
+		{name: "max total bytes", policy: RetentionPolicy{MaxTotalBytes: 25}, expectPruned: []string{"item1", "item2"}},
+		{name: "all limits", policy: RetentionPolicy{MaxAge: 150 * time.Minute, MaxFileCount: 3, MaxTotalBytes: 15}, expectPruned: []string{"item1", "item2", "item3"}},
+		{name: "archive", policy: RetentionPolicy{MaxFileCount: 2, Archive: true}, expectPruned: []string{"item1", "item2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			turnin := NewTurnIn(t.TempDir())
+			err := turnin.MakeTurnInDir()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, item := range items {
+				itemPath := filepath.Join(turnin.ExpiredDir, item.name)
+				err = os.WriteFile(itemPath, []byte("12345"), 0o666)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// the reason file is pruned with the item
+				err = os.WriteFile(itemPath+ReasonFileExt, []byte("12345"), 0o666)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				modTime := now.Add(-item.age)
+				for _, path := range []string{itemPath, itemPath + ReasonFileExt} {
+					err = os.Chtimes(path, modTime, modTime)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			pruned, err := turnin.Prune(turnin.ExpiredDir, test.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if pruned != len(test.expectPruned) {
+				t.Fatalf("expected %d items pruned, got %d", len(test.expectPruned), pruned)
+			}
+
+			remaining := listTestDir(t, turnin.ExpiredDir)
+			if len(remaining) != 2*(len(items)-pruned) {
+				t.Errorf("expected %d files left, got %v", 2*(len(items)-pruned), remaining)
+			}
+
+			for _, name := range test.expectPruned {
+				for _, file := range remaining {
+					if getSpoolEntryName(file) == name {
+						t.Errorf("expected %s pruned, found %s", name, file)
+					}
+				}
+			}
+
+			archives := []string{}
+			if _, statErr := os.Stat(turnin.ArchiveDir); statErr == nil {
+				archives = listTestDir(t, turnin.ArchiveDir)
+			}
+
+			if test.policy.Archive != (len(archives) > 0) {
+				t.Errorf("expected archived %t, got %v", test.policy.Archive, archives)
+			}
+
+			for _, archive := range archives {
+				if !strings.HasPrefix(archive, "expired-") || !strings.HasSuffix(archive, ".tar.gz") {
+					t.Errorf("unexpected archive %s", archive)
+				}
+			}
+		})
+	}
+}
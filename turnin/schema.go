@@ -0,0 +1,169 @@
+package turnin
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// LegacyTurnInSchemaVersion is a schema version of turn-in items written without version field
+	LegacyTurnInSchemaVersion int = 0
+	// CurrentTurnInSchemaVersion is a schema version of turn-in items written by this version
+	CurrentTurnInSchemaVersion int = 1
+)
+
+// schemaUpgradeFunc upgrades raw turn-in content from a version to the next version
+type schemaUpgradeFunc func(content map[string]json.RawMessage) error
+
+// schemaUpgrades has upgrade functions keyed by the version they upgrade from
+var schemaUpgrades = map[int]schemaUpgradeFunc{
+	LegacyTurnInSchemaVersion: upgradeSchemaFromLegacy,
+}
+
+// upgradeSchemaFromLegacy upgrades legacy (unversioned) content to version 1
+// version 1 adds version, expiry_time and priority fields, all have usable zero values
+func upgradeSchemaFromLegacy(content map[string]json.RawMessage) error {
+	return setSchemaVersion(content, 1)
+}
+
+func setSchemaVersion(content map[string]json.RawMessage, version int) error {
+	versionBytes, err := json.Marshal(version)
+	if err != nil {
+		return err
+	}
+
+	content["version"] = versionBytes
+	return nil
+}
+
+// getSchemaVersion returns schema version of raw turn-in content
+func getSchemaVersion(content map[string]json.RawMessage) (int, error) {
+	versionBytes, ok := content["version"]
+	if !ok {
+		return LegacyTurnInSchemaVersion, nil
+	}
+
+	version := 0
+	err := json.Unmarshal(versionBytes, &version)
+	if err != nil {
+		return 0, fmt.Errorf("field 'version' is not an integer - %s", string(versionBytes))
+	}
+
+	if version < 0 {
+		return 0, fmt.Errorf("field 'version' must not be negative - %d", version)
+	}
+
+	return version, nil
+}
+
+// getRequestType returns request type of raw turn-in content
+func getRequestType(content map[string]json.RawMessage) (TurnInRequestType, error) {
+	reqTypeBytes, ok := content["type"]
+	if !ok {
+		return "", fmt.Errorf("field 'type' not provided")
+	}
+
+	reqType := ""
+	err := json.Unmarshal(reqTypeBytes, &reqType)
+	if err != nil {
+		return "", fmt.Errorf("field 'type' is not a string - %s", string(reqTypeBytes))
+	}
+
+	return TurnInRequestType(reqType), nil
+}
+
+// upgradeSchema upgrades raw turn-in content to the current version
+// content written by newer versions is kept as it is, unknown fields are preserved
+func upgradeSchema(content map[string]json.RawMessage) error {
+	version, err := getSchemaVersion(content)
+	if err != nil {
+		return err
+	}
+
+	for version < CurrentTurnInSchemaVersion {
+		upgrade, ok := schemaUpgrades[version]
+		if !ok {
+			return fmt.Errorf("no schema upgrade from version %d", version)
+		}
+
+		err = upgrade(content)
+		if err != nil {
+			return fmt.Errorf("failed to upgrade schema from version %d - %v", version, err)
+		}
+
+		newVersion, err := getSchemaVersion(content)
+		if err != nil {
+			return err
+		}
+
+		if newVersion <= version {
+			return fmt.Errorf("schema upgrade from version %d did not advance version", version)
+		}
+
+		version = newVersion
+	}
+
+	return nil
+}
+
+// decodeTurnInItem decodes bytes into the item, preserving fields the item does not know
+func decodeTurnInItem(bytes []byte, item TurnInItem) error {
+	err := json.Unmarshal(bytes, item)
+	if err != nil {
+		return err
+	}
+
+	content := map[string]json.RawMessage{}
+	err = json.Unmarshal(bytes, &content)
+	if err != nil {
+		return err
+	}
+
+	knownBytes, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	known := map[string]json.RawMessage{}
+	err = json.Unmarshal(knownBytes, &known)
+	if err != nil {
+		return err
+	}
+
+	extra := map[string]json.RawMessage{}
+	for key, val := range content {
+		if _, ok := known[key]; !ok {
+			extra[key] = val
+		}
+	}
+
+	item.SetExtraFields(extra)
+	return nil
+}
+
+// encodeTurnInItem encodes the item into bytes, including fields preserved at decoding
+func encodeTurnInItem(item TurnInItem) ([]byte, error) {
+	bytes, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+
+	extra := item.GetExtraFields()
+	if len(extra) == 0 {
+		return bytes, nil
+	}
+
+	content := map[string]json.RawMessage{}
+	err = json.Unmarshal(bytes, &content)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, val := range extra {
+		if _, ok := content[key]; !ok {
+			content[key] = val
+		}
+	}
+
+	return json.Marshal(content)
+}
@@ -0,0 +1,27 @@
+package turnin
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// InjectTraceContext stores the trace context of the span in ctx into the item, in W3C trace context format
+func InjectTraceContext(ctx context.Context, item TurnInItem) {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+
+	if len(carrier) > 0 {
+		item.SetTraceContext(carrier)
+	}
+}
+
+// ExtractTraceContext returns a context having the trace context stored in the item, spans started with it continue the trace
+func ExtractTraceContext(ctx context.Context, item TurnInItem) context.Context {
+	traceContext := item.GetTraceContext()
+	if len(traceContext) == 0 {
+		return ctx
+	}
+
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(traceContext))
+}
@@ -7,92 +7,291 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/rs/xid"
+)
+
+const (
+	// ReasonFileExt is an extension of a file that stores the reason why a turn-in is expired or quarantined
+	ReasonFileExt string = ".reason"
+	// StagingDirName is a name of the hidden dir in the turn in dir where all-or-nothing batches are written
+	StagingDirName string = ".staging"
+
+	// turninTempFileExt is an extension of a turn-in being written
+	turninTempFileExt string = ".tmp"
 )
 
+// BacklogMetrics is a struct to store backlog of turn-ins for a priority level
+type BacklogMetrics struct {
+	Priority           TurnInPriority
+	Count              int
+	OldestCreationTime time.Time
+}
+
 // TurnIn is a struct to maintain turn in config and state
 type TurnIn struct {
-	Dir       string
-	FailedDir string
+	Dir           string
+	FailedDir     string
+	ExpiredDir    string
+	QuarantineDir string
+	ArchiveDir    string
+	ResultDir     string
+	InflightDir   string
+
+	// Instance is a name of the service instance claiming turn-ins, claiming is disabled if empty
+	Instance string
+	// LeaseDuration is the time turn-ins claimed are held by the instance without renewing its lease
+	LeaseDuration time.Duration
+
+	// ServiceVersion is recorded in failure records of turn-ins failed at scraping
+	ServiceVersion string
+
+	// Limits are checked before writing a turn-in
+	Limits CapacityLimits
+
+	// PriorityAging raises the priority of waiting items by one level per interval to prevent starvation, 0 to disable
+	PriorityAging time.Duration
+
+	// ScrapeLimit is the max number of turn-ins taken by a scrape, the rest is left to other instances or the next scrape, 0 for no limit
+	ScrapeLimit int
+
+	backlog     map[TurnInPriority]*BacklogMetrics
+	backlogLock sync.Mutex
+
+	leaseExpiryTime int64 // unix nano time the lease of this instance expires at
 }
 
 func NewTurnIn(dir string) *TurnIn {
 	return &TurnIn{
-		Dir:       dir,
-		FailedDir: path.Join(dir, "failed"),
+		Dir:           dir,
+		FailedDir:     path.Join(dir, "failed"),
+		ExpiredDir:    path.Join(dir, "expired"),
+		QuarantineDir: path.Join(dir, "quarantine"),
+		ArchiveDir:    path.Join(dir, "archive"),
+		ResultDir:     path.Join(dir, "results"),
+		InflightDir:   path.Join(dir, InflightDirName),
 	}
 }
 
 // MakeTurnInDir makes turn in dir
 func (turnin *TurnIn) MakeTurnInDir() error {
-	turninDirInfo, err := os.Stat(turnin.Dir)
+	err := makeDir(turnin.Dir, "turn in dir")
 	if err != nil {
-		if os.IsNotExist(err) {
-			// make
-			mkdirErr := os.MkdirAll(turnin.Dir, 0775)
-			if mkdirErr != nil {
-				return fmt.Errorf("making a turn in dir (%s) error - %v", turnin.Dir, mkdirErr)
-			}
+		return err
+	}
 
-			// okay
-		} else {
-			return fmt.Errorf("turn in dir (%s) error - %v", turnin.Dir, err)
-		}
+	err = makeDir(turnin.FailedDir, "failed turn in dir")
+	if err != nil {
+		return err
 	}
 
-	if turninDirInfo != nil {
-		if !turninDirInfo.IsDir() {
-			return fmt.Errorf("turn in dir (%s) exist, but not a directory", turnin.Dir)
-		}
+	err = makeDir(turnin.ExpiredDir, "expired turn in dir")
+	if err != nil {
+		return err
+	}
+
+	err = makeDir(turnin.QuarantineDir, "quarantine turn in dir")
+	if err != nil {
+		return err
+	}
 
-		turninDirPerm := turninDirInfo.Mode().Perm()
-		if turninDirPerm&0200 != 0200 {
-			return fmt.Errorf("turn in dir (%s) exist, but does not have write permission", turnin.Dir)
+	err = makeDir(turnin.ResultDir, "result turn in dir")
+	if err != nil {
+		return err
+	}
+
+	if turnin.IsClaimEnabled() {
+		err = makeDir(turnin.getInstanceInflightDir(turnin.Instance), "inflight turn in dir")
+		if err != nil {
+			return err
 		}
 	}
 
-	failedTurninDirInfo, err := os.Stat(turnin.FailedDir)
+	return nil
+}
+
+// makeDir makes a dir if not exist, and checks if it is writable
+func makeDir(dir string, desc string) error {
+	dirInfo, err := os.Stat(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// make
-			mkdirErr := os.MkdirAll(turnin.FailedDir, 0775)
+			mkdirErr := os.MkdirAll(dir, 0775)
 			if mkdirErr != nil {
-				return fmt.Errorf("making a failed turn in dir (%s) error - %v", turnin.FailedDir, mkdirErr)
+				return fmt.Errorf("making a %s (%s) error - %v", desc, dir, mkdirErr)
 			}
 
 			// okay
-		} else {
-			return fmt.Errorf("failed turn in dir (%s) error - %v", turnin.FailedDir, err)
+			return nil
 		}
+
+		return fmt.Errorf("%s (%s) error - %v", desc, dir, err)
 	}
 
-	if failedTurninDirInfo != nil {
-		if !failedTurninDirInfo.IsDir() {
-			return fmt.Errorf("failed turn in dir (%s) exist, but not a directory", turnin.FailedDir)
-		}
+	if !dirInfo.IsDir() {
+		return fmt.Errorf("%s (%s) exist, but not a directory", desc, dir)
+	}
 
-		failedTurninDirPerm := failedTurninDirInfo.Mode().Perm()
-		if failedTurninDirPerm&0200 != 0200 {
-			return fmt.Errorf("failed turn in dir (%s) exist, but does not have write permission", turnin.FailedDir)
-		}
+	dirPerm := dirInfo.Mode().Perm()
+	if dirPerm&0200 != 0200 {
+		return fmt.Errorf("%s (%s) exist, but does not have write permission", desc, dir)
 	}
 
 	return nil
 }
 
-// Turnin turns a request in
-func (turnin *TurnIn) Turnin(item TurnInItem) error {
-	// save as a file
+// turninSequence distinguishes turn-ins made by a process in the same microsecond
+var turninSequence uint64
+
+// newTurnInFilePath returns a new unique path for a turn-in
+// file names are sorted by time, then by order made in a process
+func (turnin *TurnIn) newTurnInFilePath() string {
 	id := strconv.FormatInt(time.Now().UnixMicro(), 10)
 	pid := os.Getpid()
-	filename := fmt.Sprintf("%s-%d", id, pid)
-	turninFilePath := filepath.Join(turnin.Dir, filename)
+	seq := atomic.AddUint64(&turninSequence, 1)
+	filename := fmt.Sprintf("%s-%d-%06d", id, pid, seq)
+	return filepath.Join(turnin.Dir, filename)
+}
+
+// Turnin turns a request in
+// returns CapacityError if the turn in dir cannot accept more turn-ins
+func (turnin *TurnIn) Turnin(item TurnInItem) error {
+	err := turnin.CheckCapacity()
+	if err != nil {
+		return err
+	}
+
+	return turnin.save(item)
+}
+
+// TurninUnchecked turns a request in without checking capacity, for callers checking capacity themselves
+func (turnin *TurnIn) TurninUnchecked(item TurnInItem) error {
+	return turnin.save(item)
+}
+
+// TurninBatch turns requests in, checking capacity once for all
+// stops at the first error, returns the number of requests turned in
+func (turnin *TurnIn) TurninBatch(items []TurnInItem) (int, error) {
+	err := turnin.CheckCapacity()
+	if err != nil {
+		return 0, err
+	}
+
+	for idx, item := range items {
+		err = turnin.save(item)
+		if err != nil {
+			return idx, err
+		}
+	}
+
+	return len(items), nil
+}
+
+// EnsureRequestID generates a request ID of the item if not given, returns the request ID
+func EnsureRequestID(item TurnInItem) string {
+	if len(item.GetRequestID()) == 0 {
+		item.SetRequestID(xid.New().String())
+	}
+	return item.GetRequestID()
+}
+
+// TurninBatchAllOrNothing turns requests in only if all of them can be written
+// items are written to a hidden staging dir first, then moved into the turn in dir
+// returns the number of requests turned in, which is either 0 or all
+func (turnin *TurnIn) TurninBatchAllOrNothing(items []TurnInItem) (int, error) {
+	err := turnin.CheckCapacity()
+	if err != nil {
+		return 0, err
+	}
+
+	stagingRootDir := filepath.Join(turnin.Dir, StagingDirName)
+	err = os.MkdirAll(stagingRootDir, 0775)
+	if err != nil {
+		return 0, turnin.convertWriteError(err)
+	}
+
+	stagingDir, err := os.MkdirTemp(stagingRootDir, "batch-")
+	if err != nil {
+		return 0, turnin.convertWriteError(err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	stagedPaths := make([]string, len(items))
+	for idx, item := range items {
+		EnsureRequestID(item)
+
+		turninFilePath := turnin.newTurnInFilePath()
+		stagedPath := filepath.Join(stagingDir, filepath.Base(turninFilePath))
+
+		err = item.SaveToFile(stagedPath)
+		if err != nil {
+			return 0, turnin.convertWriteError(err)
+		}
+
+		stagedPaths[idx] = stagedPath
+	}
+
+	// rename never fails for lack of space, items are moved in the order given
+	for idx, item := range items {
+		turninFilePath := filepath.Join(turnin.Dir, filepath.Base(stagedPaths[idx]))
+		err = os.Rename(stagedPaths[idx], turninFilePath)
+		if err != nil {
+			// items moved in already may be processed, cannot take them back
+			return idx, err
+		}
+
+		item.SetItemFilePath(turninFilePath)
+	}
+
+	return len(items), nil
+}
 
-	return item.SaveToFile(turninFilePath)
+// save saves the item as a file in the turn in dir
+// the item is written to a hidden temp file first, so scraping never sees a partially written turn-in
+func (turnin *TurnIn) save(item TurnInItem) error {
+	EnsureRequestID(item)
+
+	turninFilePath := turnin.newTurnInFilePath()
+	tempFilePath := filepath.Join(turnin.Dir, fmt.Sprintf(".%s%s", filepath.Base(turninFilePath), turninTempFileExt))
+
+	err := item.SaveToFile(tempFilePath)
+	if err != nil {
+		// do not leave a partially written turn-in
+		os.Remove(tempFilePath)
+		return turnin.convertWriteError(err)
+	}
+
+	err = os.Rename(tempFilePath, turninFilePath)
+	if err != nil {
+		os.Remove(tempFilePath)
+		return err
+	}
+
+	item.SetItemFilePath(turninFilePath)
+	return nil
 }
 
-// Scrape finds all turn-ins
+// GetItemID returns ID of the item turned-in, empty if the item is not turned-in
+func GetItemID(item TurnInItem) string {
+	fullpath := item.GetItemFilePath()
+	if len(fullpath) == 0 {
+		return ""
+	}
+	return filepath.Base(fullpath)
+}
+
+// Scrape finds up to ScrapeLimit turn-ins of the highest priority
+// items that cannot be decoded are moved to quarantine dir, except items written in newer schema
+// if claiming is enabled, items are claimed into the inflight dir of this instance, items claimed by others are skipped
 func (turnin *TurnIn) Scrape() ([]TurnInItem, error) {
+	if turnin.IsClaimEnabled() && !turnin.HasLease(time.Now()) {
+		return nil, fmt.Errorf("lease of instance %s is expired, not claiming turn-ins", turnin.Instance)
+	}
+
 	files, err := os.ReadDir(turnin.Dir)
 	if err != nil {
 		return nil, err
@@ -100,40 +299,220 @@ func (turnin *TurnIn) Scrape() ([]TurnInItem, error) {
 
 	items := []TurnInItem{}
 	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") {
+			// turn-ins being written or staged
+			continue
+		}
+
 		if !file.IsDir() {
 			fullpath := filepath.Join(turnin.Dir, file.Name())
 			item, reqErr := NewTurnInRequestFromFile(fullpath)
 			if reqErr != nil {
+				if IsNewerSchemaDecodeError(reqErr) {
+					// leave it for newer versions sharing the turn in dir
+					continue
+				}
+
+				if os.IsNotExist(reqErr) {
+					// claimed by others since listed
+					continue
+				}
+
 				err = reqErr
-				failDirFile := filepath.Join(turnin.FailedDir, filepath.Base(fullpath))
-				os.Rename(fullpath, failDirFile)
+				if IsDecodeError(reqErr) {
+					turnin.moveWithReason(fullpath, turnin.QuarantineDir, reqErr.Error())
+
+					// we do not know if a client waits for it, write the result anyway
+					turnin.WriteResult(&ResultRecord{
+						ID:            filepath.Base(fullpath),
+						Status:        ResultStatusQuarantined,
+						Error:         reqErr.Error(),
+						ErrorClass:    ErrorClassDecode,
+						CompletedTime: time.Now(),
+					})
+				} else {
+					record := NewFailureRecord(nil, reqErr, ErrorClassIO)
+					record.ServiceVersion = turnin.ServiceVersion
+					record.Attempts = append(record.Attempts, AttemptRecord{
+						Time:       record.FailedTime,
+						Error:      record.Error,
+						ErrorClass: record.ErrorClass,
+					})
+					turnin.moveToFailedDir(fullpath, record)
+				}
 				continue
 			}
 
+			// items written by old clients do not have request IDs, use their IDs to correlate logs
+			if len(item.GetRequestID()) == 0 {
+				item.SetRequestID(GetItemID(item))
+			}
+
 			items = append(items, item)
 		}
 	}
 
-	// sort by file name
+	turnin.updateBacklog(items)
+
+	// sort by effective priority, then by priority given, then by file name
+	// items aged to the same priority do not go before items given the priority
+	now := time.Now()
+	priorities := map[TurnInItem]TurnInPriority{}
+	for _, item := range items {
+		priorities[item] = turnin.GetEffectivePriority(item, now)
+	}
+
 	sort.SliceStable(items[:], func(i int, j int) bool {
+		priorityi := priorities[items[i]]
+		priorityj := priorities[items[j]]
+		if priorityi != priorityj {
+			return priorityi > priorityj
+		}
+
+		if items[i].GetPriority() != items[j].GetPriority() {
+			return items[i].GetPriority() > items[j].GetPriority()
+		}
+
 		basei := filepath.Base(items[i].GetItemFilePath())
 		basej := filepath.Base(items[j].GetItemFilePath())
 		return basei < basej
 	})
 
-	return items, err
+	// take items of the highest priority first, the rest waits for the next scrape,
+	// so items of higher priority turned in meanwhile go before them
+	scrapedItems := []TurnInItem{}
+	for _, item := range items {
+		if turnin.ScrapeLimit > 0 && len(scrapedItems) >= turnin.ScrapeLimit {
+			break
+		}
+
+		if turnin.IsClaimEnabled() {
+			claimedPath, claimErr := turnin.claim(item.GetItemFilePath())
+			if claimErr != nil {
+				if !os.IsNotExist(claimErr) {
+					err = claimErr
+				}
+				// claimed by others
+				continue
+			}
+
+			item.SetItemFilePath(claimedPath)
+		}
+
+		scrapedItems = append(scrapedItems, item)
+	}
+
+	return scrapedItems, err
+}
+
+// GetEffectivePriority returns priority of the item, raised by the time it has waited
+func (turnin *TurnIn) GetEffectivePriority(item TurnInItem, now time.Time) TurnInPriority {
+	priority := item.GetPriority()
+	if turnin.PriorityAging <= 0 || priority >= HighPriority {
+		return priority
+	}
+
+	age := now.Sub(item.GetCreationTime())
+	if age > 0 {
+		priority += TurnInPriority(age / turnin.PriorityAging)
+	}
+
+	if priority > HighPriority {
+		return HighPriority
+	}
+	return priority
+}
+
+func (turnin *TurnIn) updateBacklog(items []TurnInItem) {
+	backlog := map[TurnInPriority]*BacklogMetrics{}
+	for _, priority := range GetTurnInPriorities() {
+		backlog[priority] = &BacklogMetrics{
+			Priority: priority,
+		}
+	}
+
+	for _, item := range items {
+		metrics, ok := backlog[item.GetPriority()]
+		if !ok {
+			metrics = &BacklogMetrics{
+				Priority: item.GetPriority(),
+			}
+			backlog[item.GetPriority()] = metrics
+		}
+
+		metrics.Count++
+		if metrics.OldestCreationTime.IsZero() || item.GetCreationTime().Before(metrics.OldestCreationTime) {
+			metrics.OldestCreationTime = item.GetCreationTime()
+		}
+	}
+
+	turnin.backlogLock.Lock()
+	defer turnin.backlogLock.Unlock()
+
+	turnin.backlog = backlog
+}
+
+// GetBacklogMetrics returns backlog per priority found at the last scrape, from high to low priority
+func (turnin *TurnIn) GetBacklogMetrics() []BacklogMetrics {
+	turnin.backlogLock.Lock()
+	defer turnin.backlogLock.Unlock()
+
+	metrics := []BacklogMetrics{}
+	for _, m := range turnin.backlog {
+		metrics = append(metrics, *m)
+	}
+
+	sort.Slice(metrics, func(i int, j int) bool {
+		return metrics[i].Priority > metrics[j].Priority
+	})
+
+	return metrics
+}
+
+// MarkFailed sets a turn-in failed, the record is stored next to the item if given
+func (turnin *TurnIn) MarkFailed(item TurnInItem, record *FailureRecord) error {
+	fullpath := item.GetItemFilePath()
+	if len(fullpath) > 0 {
+		return turnin.moveToFailedDir(fullpath, record)
+	}
+	return nil
+}
+
+// moveToFailedDir moves a turn-in file to failed dir, storing the record next to it
+func (turnin *TurnIn) moveToFailedDir(fullpath string, record *FailureRecord) error {
+	failDirFile := filepath.Join(turnin.FailedDir, filepath.Base(fullpath))
+	err := os.Rename(fullpath, failDirFile)
+	if err != nil {
+		return err
+	}
+
+	if record != nil {
+		return record.SaveToFile(GetFailureRecordFilePath(failDirFile))
+	}
+	return nil
 }
 
-// MarkFailed sets a turn-in failed
-func (turnin *TurnIn) MarkFailed(item TurnInItem) error {
+// MarkExpired sets a turn-in expired, the reason is stored next to the item
+func (turnin *TurnIn) MarkExpired(item TurnInItem, reason string) error {
 	fullpath := item.GetItemFilePath()
 	if len(fullpath) > 0 {
-		failDirFile := filepath.Join(turnin.FailedDir, filepath.Base(fullpath))
-		return os.Rename(fullpath, failDirFile)
+		return turnin.moveWithReason(fullpath, turnin.ExpiredDir, reason)
 	}
 	return nil
 }
 
+// moveWithReason moves a turn-in file to the dir, storing the reason next to it
+func (turnin *TurnIn) moveWithReason(fullpath string, dir string, reason string) error {
+	dirFile := filepath.Join(dir, filepath.Base(fullpath))
+	err := os.Rename(fullpath, dirFile)
+	if err != nil {
+		return err
+	}
+
+	reasonFile := fmt.Sprintf("%s%s", dirFile, ReasonFileExt)
+	return os.WriteFile(reasonFile, []byte(reason+"\n"), 0o666)
+}
+
 // MarkSuccess sets a turn-in success
 func (turnin *TurnIn) MarkSuccess(item TurnInItem) error {
 	fullpath := item.GetItemFilePath()
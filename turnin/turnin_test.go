@@ -0,0 +1,157 @@
+package turnin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// failingTestItem fails to be written, as on a disk full
+type failingTestItem struct {
+	*SendMessageRequest
+}
+
+func (item *failingTestItem) SaveToFile(path string) error {
+	return errors.New("no space left on device")
+}
+
+func TestScrapePriorityBetweenBatches(t *testing.T) {
+	// the high priority turn-in is turned in after the first batch
+	expectedOrder := []TurnInPriority{NormalPriority, NormalPriority, HighPriority, NormalPriority, NormalPriority, NormalPriority}
+
+	tests := []struct {
+		name     string
+		instance string // claiming is disabled if empty
+	}{
+		{name: "single instance"},
+		{name: "claiming", instance: "host1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			turnin := NewTurnIn(dir)
+			if len(test.instance) > 0 {
+				turnin = newTestInstance(t, dir, test.instance)
+			} else {
+				err := turnin.MakeTurnInDir()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			turnin.ScrapeLimit = 2
+
+			turninTestItems(t, turnin, 5, NormalPriority)
+
+			order := []TurnInPriority{}
+			for batch := 0; ; batch++ {
+				items, err := turnin.Scrape()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(items) == 0 {
+					break
+				}
+
+				if len(items) > turnin.ScrapeLimit {
+					t.Fatalf("expected at most %d turn-ins in a batch, got %d", turnin.ScrapeLimit, len(items))
+				}
+
+				for _, item := range items {
+					order = append(order, item.GetPriority())
+
+					err = turnin.MarkSuccess(item)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				if batch == 0 {
+					// turned in while the first batch is processed, goes before the rest of the backlog
+					turninTestItems(t, turnin, 1, HighPriority)
+				}
+			}
+
+			if len(order) != len(expectedOrder) {
+				t.Fatalf("expected %d turn-ins scraped, got %d", len(expectedOrder), len(order))
+			}
+
+			for i := range order {
+				if order[i] != expectedOrder[i] {
+					t.Errorf("expected %s priority turn-in at %d, got %s", expectedOrder[i].String(), i, order[i].String())
+				}
+			}
+		})
+	}
+}
+
+func TestTurninBatchAllOrNothing(t *testing.T) {
+	newItem := func() TurnInItem {
+		return NewSendMessageRequest("irods.data-object.add", "{}")
+	}
+
+	newFailingItem := func() TurnInItem {
+		return &failingTestItem{NewSendMessageRequest("irods.data-object.add", "{}")}
+	}
+
+	tests := []struct {
+		name          string
+		allOrNothing  bool
+		pending       int
+		maxBacklog    int
+		items         []TurnInItem
+		expectErr     bool
+		expectWritten int
+	}{
+		{name: "all written", allOrNothing: true, items: []TurnInItem{newItem(), newItem(), newItem()}, expectWritten: 3},
+		{name: "partial batch", allOrNothing: true, items: []TurnInItem{newItem(), newFailingItem(), newItem()}, expectErr: true},
+		{name: "partial batch without all or nothing", items: []TurnInItem{newItem(), newFailingItem(), newItem()}, expectErr: true, expectWritten: 1},
+		{name: "queue full", allOrNothing: true, pending: 2, maxBacklog: 2, items: []TurnInItem{newItem()}, expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			turnin := NewTurnIn(dir)
+			err := turnin.MakeTurnInDir()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			turninTestItems(t, turnin, test.pending, NormalPriority)
+			turnin.Limits.MaxBacklog = test.maxBacklog
+
+			var written int
+			if test.allOrNothing {
+				written, err = turnin.TurninBatchAllOrNothing(test.items)
+			} else {
+				written, err = turnin.TurninBatch(test.items)
+			}
+
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error %t, got %v", test.expectErr, err)
+			}
+
+			if written != test.expectWritten {
+				t.Errorf("expected %d turn-ins written, got %d", test.expectWritten, written)
+			}
+
+			pending := listTestDir(t, dir)
+			if len(pending) != test.pending+test.expectWritten {
+				t.Errorf("expected %d turn-ins pending, got %d", test.pending+test.expectWritten, len(pending))
+			}
+
+			// nothing is left staged
+			staged, err := os.ReadDir(filepath.Join(dir, StagingDirName))
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+
+			if len(staged) != 0 {
+				t.Errorf("expected nothing staged, got %d", len(staged))
+			}
+		})
+	}
+}
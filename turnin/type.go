@@ -4,44 +4,193 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type TurnInRequestType string
 
 const (
-	SendMessageRequestType  TurnInRequestType = "send_message"
-	LinkBisqueRequestType   TurnInRequestType = "link_bisque"
-	RemoveBisqueRequestType TurnInRequestType = "remove_bisque"
-	MoveBisqueRequestType   TurnInRequestType = "move_bisque"
+	SendMessageRequestType   TurnInRequestType = "send_message"
+	LinkBisqueRequestType    TurnInRequestType = "link_bisque"
+	RemoveBisqueRequestType  TurnInRequestType = "remove_bisque"
+	MoveBisqueRequestType    TurnInRequestType = "move_bisque"
+	IRODSMetadataRequestType TurnInRequestType = "irods_metadata"
 )
 
+// GetTurnInRequestTypes returns all request types
+func GetTurnInRequestTypes() []TurnInRequestType {
+	return []TurnInRequestType{SendMessageRequestType, LinkBisqueRequestType, RemoveBisqueRequestType, MoveBisqueRequestType, IRODSMetadataRequestType}
+}
+
+// TurnInPriority is a priority of a turn-in item, items with higher priority are processed first
+type TurnInPriority int
+
+const (
+	LowPriority    TurnInPriority = -1
+	NormalPriority TurnInPriority = 0
+	HighPriority   TurnInPriority = 1
+)
+
+// GetTurnInPriorities returns all priority levels, from high to low
+func GetTurnInPriorities() []TurnInPriority {
+	return []TurnInPriority{HighPriority, NormalPriority, LowPriority}
+}
+
+// ParseTurnInPriority parses priority string (low, normal, high)
+func ParseTurnInPriority(priority string) (TurnInPriority, error) {
+	switch strings.ToLower(strings.TrimSpace(priority)) {
+	case "low":
+		return LowPriority, nil
+	case "", "normal":
+		return NormalPriority, nil
+	case "high":
+		return HighPriority, nil
+	default:
+		return NormalPriority, fmt.Errorf("unknown priority - %s", priority)
+	}
+}
+
+func (priority TurnInPriority) String() string {
+	switch priority {
+	case LowPriority:
+		return "low"
+	case NormalPriority:
+		return "normal"
+	case HighPriority:
+		return "high"
+	default:
+		return strconv.Itoa(int(priority))
+	}
+}
+
 // TurnInItem is an interface that all turn-in items must implement
 type TurnInItem interface {
 	GetRequestType() TurnInRequestType
+	GetRequestID() string
+	SetRequestID(requestID string)
+	GetTraceContext() map[string]string
+	SetTraceContext(traceContext map[string]string)
 	GetCreationTime() time.Time
+	SetCreationTime(creationTime time.Time)
+	GetExpiryTime() time.Time
+	SetExpiryTime(expiryTime time.Time)
+	IsExpired(now time.Time) bool
+	IsResultRequested() bool
+	SetResultRequested(requested bool)
+	GetPriority() TurnInPriority
+	SetPriority(priority TurnInPriority)
+	GetAttempts() int
+	SetAttempts(attempts int)
+	GetSchemaVersion() int
+	GetExtraFields() map[string]json.RawMessage
+	SetExtraFields(extra map[string]json.RawMessage)
 	GetItemFilePath() string
 	SetItemFilePath(path string)
 	MarshalJson() ([]byte, error)
+	Validate() error
 	ToString() string
 	SaveToFile(path string) error
 }
 
 // TurnInItemBase is a common parts that all turn-in items must contain
 type TurnInItemBase struct {
-	Type         TurnInRequestType `json:"type"`          // requred to identify what this item is
-	CreationTime time.Time         `json:"creation_time"` // creation time
-	FilePath     string            `json:"-"`             // stores physical path of item, to be filled when the item is turn-in
+	Type            TurnInRequestType `json:"type"`                       // requred to identify what this item is
+	Version         int               `json:"version"`                    // schema version
+	RequestID       string            `json:"request_id,omitempty"`       // unique ID generated at enqueue, to correlate logs
+	TraceContext    map[string]string `json:"trace_context,omitempty"`    // W3C trace context of the enqueuer, to connect spans
+	CreationTime    time.Time         `json:"creation_time"`              // creation time
+	ExpiryTime      time.Time         `json:"expiry_time"`                // expiry time, zero if the item never expires
+	Priority        TurnInPriority    `json:"priority"`                   // priority, normal by default
+	ResultRequested bool              `json:"result_requested,omitempty"` // if true, a result is written when processed, for clients waiting for completion
+	Attempts        int               `json:"attempts,omitempty"`         // attempts interrupted while in-flight, e.g., by crashes, counted when recovered
+	FilePath        string            `json:"-"`                          // stores physical path of item, to be filled when the item is turn-in
+
+	extraFields map[string]json.RawMessage // fields unknown to this version, preserved to be written back
 }
 
 func (base *TurnInItemBase) GetRequestType() TurnInRequestType {
 	return base.Type
 }
 
+func (base *TurnInItemBase) GetRequestID() string {
+	return base.RequestID
+}
+
+func (base *TurnInItemBase) SetRequestID(requestID string) {
+	base.RequestID = requestID
+}
+
+func (base *TurnInItemBase) GetTraceContext() map[string]string {
+	return base.TraceContext
+}
+
+func (base *TurnInItemBase) SetTraceContext(traceContext map[string]string) {
+	base.TraceContext = traceContext
+}
+
 func (base *TurnInItemBase) GetCreationTime() time.Time {
 	return base.CreationTime
 }
 
+func (base *TurnInItemBase) SetCreationTime(creationTime time.Time) {
+	base.CreationTime = creationTime
+}
+
+func (base *TurnInItemBase) GetExpiryTime() time.Time {
+	return base.ExpiryTime
+}
+
+func (base *TurnInItemBase) SetExpiryTime(expiryTime time.Time) {
+	base.ExpiryTime = expiryTime
+}
+
+// IsExpired returns true if the item has an expiry time and it is passed
+func (base *TurnInItemBase) IsExpired(now time.Time) bool {
+	if base.ExpiryTime.IsZero() {
+		return false
+	}
+
+	return now.After(base.ExpiryTime)
+}
+
+func (base *TurnInItemBase) IsResultRequested() bool {
+	return base.ResultRequested
+}
+
+func (base *TurnInItemBase) SetResultRequested(requested bool) {
+	base.ResultRequested = requested
+}
+
+func (base *TurnInItemBase) GetPriority() TurnInPriority {
+	return base.Priority
+}
+
+func (base *TurnInItemBase) SetPriority(priority TurnInPriority) {
+	base.Priority = priority
+}
+
+func (base *TurnInItemBase) GetAttempts() int {
+	return base.Attempts
+}
+
+func (base *TurnInItemBase) SetAttempts(attempts int) {
+	base.Attempts = attempts
+}
+
+func (base *TurnInItemBase) GetSchemaVersion() int {
+	return base.Version
+}
+
+func (base *TurnInItemBase) GetExtraFields() map[string]json.RawMessage {
+	return base.extraFields
+}
+
+func (base *TurnInItemBase) SetExtraFields(extra map[string]json.RawMessage) {
+	base.extraFields = extra
+}
+
 func (base *TurnInItemBase) GetItemFilePath() string {
 	return base.FilePath
 }
@@ -67,31 +216,68 @@ func NewTurnInRequestFromFile(path string) (TurnInItem, error) {
 }
 
 // NewTurnInRequest creates TurnInItem from byte array
+// returns DecodeError if the bytes cannot be decoded
 func NewTurnInRequest(bytes []byte) (TurnInItem, error) {
-	var content map[string]interface{}
+	content := map[string]json.RawMessage{}
 
 	err := json.Unmarshal(bytes, &content)
 	if err != nil {
-		return nil, err
+		return nil, NewDecodeErrorf("malformed request - %v", err)
+	}
+
+	version, err := getSchemaVersion(content)
+	if err != nil {
+		return nil, NewDecodeErrorf("unknown schema version - %v", err)
+	}
+
+	reqType, err := getRequestType(content)
+	if err != nil {
+		if version > CurrentTurnInSchemaVersion {
+			// newer versions may define the type differently
+			return nil, NewNewerSchemaDecodeErrorf("unknown request type - %v, schema version %d is newer than %d", err, version, CurrentTurnInSchemaVersion)
+		}
+		return nil, NewDecodeErrorf("unknown request type - %v", err)
+	}
+
+	if version < CurrentTurnInSchemaVersion {
+		err = upgradeSchema(content)
+		if err != nil {
+			return nil, NewDecodeErrorf("failed to upgrade schema version %d - %v", version, err)
+		}
+
+		bytes, err = json.Marshal(content)
+		if err != nil {
+			return nil, NewDecodeErrorf("failed to upgrade schema version %d - %v", version, err)
+		}
+	}
+
+	var req TurnInItem
+	switch reqType {
+	case SendMessageRequestType:
+		req, err = NewSendMessageRequestFromBytes(bytes)
+	case LinkBisqueRequestType:
+		req, err = NewLinkBisqueRequestFromBytes(bytes)
+	case RemoveBisqueRequestType:
+		req, err = NewRemoveBisqueRequestFromBytes(bytes)
+	case MoveBisqueRequestType:
+		req, err = NewMoveBisqueRequestFromBytes(bytes)
+	case IRODSMetadataRequestType:
+		req, err = NewIRODSMetadataRequestFromBytes(bytes)
+	default:
+		if version > CurrentTurnInSchemaVersion {
+			return nil, NewNewerSchemaDecodeErrorf("unknown request type - %s, schema version %d is newer than %d", reqType, version, CurrentTurnInSchemaVersion)
+		}
+		return nil, NewDecodeErrorf("unknown request type - %s", reqType)
 	}
 
-	if reqType, ok := content["type"]; ok {
-		reqTypeString := reqType.(string)
-		switch TurnInRequestType(reqTypeString) {
-		case SendMessageRequestType:
-			return NewSendMessageRequestFromBytes(bytes)
-		case LinkBisqueRequestType:
-			return NewLinkBisqueRequestFromBytes(bytes)
-		case RemoveBisqueRequestType:
-			return NewRemoveBisqueRequestFromBytes(bytes)
-		case MoveBisqueRequestType:
-			return NewMoveBisqueRequestFromBytes(bytes)
-		default:
-			return nil, fmt.Errorf("unknown request type - %s", reqTypeString)
+	if err != nil {
+		if version > CurrentTurnInSchemaVersion {
+			return nil, NewNewerSchemaDecodeErrorf("malformed %s request - %v, schema version %d is newer than %d", reqType, err, version, CurrentTurnInSchemaVersion)
 		}
+		return nil, NewDecodeErrorf("malformed %s request - %v", reqType, err)
 	}
 
-	return nil, fmt.Errorf("unknown request type - field 'type' not provided")
+	return req, nil
 }
 
 type SendMessageRequest struct {
@@ -99,12 +285,24 @@ type SendMessageRequest struct {
 
 	Key  string `json:"key"`
 	Body string `json:"body"`
+
+	// where to publish, routes of the service are used if not given
+	Destination string `json:"destination,omitempty"` // name of a destination configured in the service
+	Exchange    string `json:"exchange,omitempty"`    // exchange of the destination
+
+	// message properties, defaults of the service are used if not given
+	ContentType   string            `json:"content_type,omitempty"`   // e.g., application/json
+	Headers       map[string]string `json:"headers,omitempty"`        // message headers
+	CorrelationID string            `json:"correlation_id,omitempty"` // correlation ID, to relate the message to others
+	MessageID     string            `json:"message_id,omitempty"`     // message ID
+	Expiration    string            `json:"expiration,omitempty"`     // time the message is dropped if not consumed, e.g., 30m
 }
 
 func NewSendMessageRequest(key string, body string) *SendMessageRequest {
 	return &SendMessageRequest{
 		TurnInItemBase: TurnInItemBase{
 			Type:         SendMessageRequestType,
+			Version:      CurrentTurnInSchemaVersion,
 			CreationTime: time.Now().Local(),
 		},
 		Key:  key,
@@ -114,7 +312,7 @@ func NewSendMessageRequest(key string, body string) *SendMessageRequest {
 
 func NewSendMessageRequestFromBytes(bytes []byte) (*SendMessageRequest, error) {
 	var request SendMessageRequest
-	err := json.Unmarshal(bytes, &request)
+	err := decodeTurnInItem(bytes, &request)
 	if err != nil {
 		return nil, err
 	}
@@ -123,7 +321,7 @@ func NewSendMessageRequestFromBytes(bytes []byte) (*SendMessageRequest, error) {
 }
 
 func (request *SendMessageRequest) MarshalJson() ([]byte, error) {
-	return json.Marshal(request)
+	return encodeTurnInItem(request)
 }
 
 func (request *SendMessageRequest) SaveToFile(path string) error {
@@ -135,6 +333,53 @@ func (request *SendMessageRequest) SaveToFile(path string) error {
 	return os.WriteFile(path, bytes, 0o666)
 }
 
+// Validate checks if required fields are given
+func (request *SendMessageRequest) Validate() error {
+	if len(request.Key) == 0 {
+		return fmt.Errorf("key is not given")
+	}
+
+	if IsJSONContentType(request.ContentType) && !json.Valid([]byte(request.Body)) {
+		return fmt.Errorf("body is not a valid JSON for content type %s", request.ContentType)
+	}
+
+	if len(request.Expiration) > 0 {
+		_, err := request.GetExpiration()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetExpiration returns expiration of the message, 0 if not given
+func (request *SendMessageRequest) GetExpiration() (time.Duration, error) {
+	if len(request.Expiration) == 0 {
+		return 0, nil
+	}
+
+	expiration, err := time.ParseDuration(request.Expiration)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse expiration %s - %v", request.Expiration, err)
+	}
+
+	if expiration <= 0 {
+		return 0, fmt.Errorf("expiration %s must be positive", request.Expiration)
+	}
+
+	return expiration, nil
+}
+
+// ContentTypeJSON is a content type of JSON bodies
+const ContentTypeJSON string = "application/json"
+
+// IsJSONContentType returns true if the content type is JSON, e.g., application/json or application/cloudevents+json
+func IsJSONContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return mediaType == "application/json" || (strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
+
 func (request *SendMessageRequest) ToString() string {
 	return fmt.Sprintf("send message request - key: '%s', body: '\n%s\n', timestamp: %s", request.Key, request.Body, request.CreationTime.String())
 }
@@ -150,6 +395,7 @@ func NewLinkBisqueRequest(irodsUsername string, irodsPath string) *LinkBisqueReq
 	return &LinkBisqueRequest{
 		TurnInItemBase: TurnInItemBase{
 			Type:         LinkBisqueRequestType,
+			Version:      CurrentTurnInSchemaVersion,
 			CreationTime: time.Now().Local(),
 		},
 		IRODSUsername: irodsUsername,
@@ -159,7 +405,7 @@ func NewLinkBisqueRequest(irodsUsername string, irodsPath string) *LinkBisqueReq
 
 func NewLinkBisqueRequestFromBytes(bytes []byte) (*LinkBisqueRequest, error) {
 	var request LinkBisqueRequest
-	err := json.Unmarshal(bytes, &request)
+	err := decodeTurnInItem(bytes, &request)
 	if err != nil {
 		return nil, err
 	}
@@ -168,7 +414,7 @@ func NewLinkBisqueRequestFromBytes(bytes []byte) (*LinkBisqueRequest, error) {
 }
 
 func (request *LinkBisqueRequest) MarshalJson() ([]byte, error) {
-	return json.Marshal(request)
+	return encodeTurnInItem(request)
 }
 
 func (request *LinkBisqueRequest) SaveToFile(path string) error {
@@ -180,6 +426,19 @@ func (request *LinkBisqueRequest) SaveToFile(path string) error {
 	return os.WriteFile(path, bytes, 0o666)
 }
 
+// Validate checks if required fields are given
+func (request *LinkBisqueRequest) Validate() error {
+	if len(request.IRODSUsername) == 0 {
+		return fmt.Errorf("irods username is not given")
+	}
+
+	if len(request.IRODSPath) == 0 {
+		return fmt.Errorf("irods path is not given")
+	}
+
+	return nil
+}
+
 func (request *LinkBisqueRequest) ToString() string {
 	return fmt.Sprintf("link bisque request - irods user: '%s', irods path: '%s', timestamp: %s", request.IRODSUsername, request.IRODSPath, request.CreationTime.String())
 }
@@ -195,6 +454,7 @@ func NewRemoveBisqueRequest(irodsUsername string, irodsPath string) *RemoveBisqu
 	return &RemoveBisqueRequest{
 		TurnInItemBase: TurnInItemBase{
 			Type:         RemoveBisqueRequestType,
+			Version:      CurrentTurnInSchemaVersion,
 			CreationTime: time.Now().Local(),
 		},
 		IRODSUsername: irodsUsername,
@@ -204,7 +464,7 @@ func NewRemoveBisqueRequest(irodsUsername string, irodsPath string) *RemoveBisqu
 
 func NewRemoveBisqueRequestFromBytes(bytes []byte) (*RemoveBisqueRequest, error) {
 	var request RemoveBisqueRequest
-	err := json.Unmarshal(bytes, &request)
+	err := decodeTurnInItem(bytes, &request)
 	if err != nil {
 		return nil, err
 	}
@@ -213,7 +473,7 @@ func NewRemoveBisqueRequestFromBytes(bytes []byte) (*RemoveBisqueRequest, error)
 }
 
 func (request *RemoveBisqueRequest) MarshalJson() ([]byte, error) {
-	return json.Marshal(request)
+	return encodeTurnInItem(request)
 }
 
 func (request *RemoveBisqueRequest) SaveToFile(path string) error {
@@ -225,6 +485,19 @@ func (request *RemoveBisqueRequest) SaveToFile(path string) error {
 	return os.WriteFile(path, bytes, 0o666)
 }
 
+// Validate checks if required fields are given
+func (request *RemoveBisqueRequest) Validate() error {
+	if len(request.IRODSUsername) == 0 {
+		return fmt.Errorf("irods username is not given")
+	}
+
+	if len(request.IRODSPath) == 0 {
+		return fmt.Errorf("irods path is not given")
+	}
+
+	return nil
+}
+
 func (request *RemoveBisqueRequest) ToString() string {
 	return fmt.Sprintf("remove bisque request - irods user: '%s', irods path: '%s', timestamp: %s", request.IRODSUsername, request.IRODSPath, request.CreationTime.String())
 }
@@ -241,6 +514,7 @@ func NewMoveBisqueRequest(irodsUsername string, sourceIrodsPath string, destIrod
 	return &MoveBisqueRequest{
 		TurnInItemBase: TurnInItemBase{
 			Type:         MoveBisqueRequestType,
+			Version:      CurrentTurnInSchemaVersion,
 			CreationTime: time.Now().Local(),
 		},
 		IRODSUsername:   irodsUsername,
@@ -251,7 +525,7 @@ func NewMoveBisqueRequest(irodsUsername string, sourceIrodsPath string, destIrod
 
 func NewMoveBisqueRequestFromBytes(bytes []byte) (*MoveBisqueRequest, error) {
 	var request MoveBisqueRequest
-	err := json.Unmarshal(bytes, &request)
+	err := decodeTurnInItem(bytes, &request)
 	if err != nil {
 		return nil, err
 	}
@@ -260,7 +534,7 @@ func NewMoveBisqueRequestFromBytes(bytes []byte) (*MoveBisqueRequest, error) {
 }
 
 func (request *MoveBisqueRequest) MarshalJson() ([]byte, error) {
-	return json.Marshal(request)
+	return encodeTurnInItem(request)
 }
 
 func (request *MoveBisqueRequest) SaveToFile(path string) error {
@@ -272,10 +546,152 @@ func (request *MoveBisqueRequest) SaveToFile(path string) error {
 	return os.WriteFile(path, bytes, 0o666)
 }
 
+// Validate checks if required fields are given
+func (request *MoveBisqueRequest) Validate() error {
+	if len(request.IRODSUsername) == 0 {
+		return fmt.Errorf("irods username is not given")
+	}
+
+	if len(request.SourceIRODSPath) == 0 {
+		return fmt.Errorf("source irods path is not given")
+	}
+
+	if len(request.DestIRODSPath) == 0 {
+		return fmt.Errorf("dest irods path is not given")
+	}
+
+	return nil
+}
+
 func (request *MoveBisqueRequest) ToString() string {
 	return fmt.Sprintf("move bisque request - irods user: '%s', source irods path: '%s', dest irods path: '%s', timestamp: %s", request.IRODSUsername, request.SourceIRODSPath, request.DestIRODSPath, request.CreationTime.String())
 }
 
+// IRODSMetadataOperation is an operation on metadata (AVUs) of iRODS data objects and collections
+type IRODSMetadataOperation string
+
+const (
+	// IRODSMetadataOperationAdd adds AVUs
+	IRODSMetadataOperationAdd IRODSMetadataOperation = "add"
+	// IRODSMetadataOperationSet replaces AVUs having the same attributes
+	IRODSMetadataOperationSet IRODSMetadataOperation = "set"
+	// IRODSMetadataOperationRemove removes AVUs
+	IRODSMetadataOperationRemove IRODSMetadataOperation = "rm"
+	// IRODSMetadataOperationRemoveWildcard removes AVUs matching patterns, % and _ are wildcards
+	IRODSMetadataOperationRemoveWildcard IRODSMetadataOperation = "rmw"
+)
+
+// ParseIRODSMetadataOperation parses metadata operation string (add, set, rm, rmw)
+func ParseIRODSMetadataOperation(operation string) (IRODSMetadataOperation, error) {
+	switch IRODSMetadataOperation(strings.ToLower(strings.TrimSpace(operation))) {
+	case IRODSMetadataOperationAdd:
+		return IRODSMetadataOperationAdd, nil
+	case IRODSMetadataOperationSet:
+		return IRODSMetadataOperationSet, nil
+	case IRODSMetadataOperationRemove:
+		return IRODSMetadataOperationRemove, nil
+	case IRODSMetadataOperationRemoveWildcard:
+		return IRODSMetadataOperationRemoveWildcard, nil
+	default:
+		return "", fmt.Errorf("unknown metadata operation - %s", operation)
+	}
+}
+
+// IRODSAVU is a metadata of iRODS, attribute, value and unit
+type IRODSAVU struct {
+	Attribute string `json:"attribute"`
+	Value     string `json:"value"`
+	Unit      string `json:"unit,omitempty"`
+}
+
+type IRODSMetadataRequest struct {
+	TurnInItemBase
+
+	Operation IRODSMetadataOperation `json:"operation"`
+	IRODSPath string                 `json:"irods_path"`
+	AVUs      []IRODSAVU             `json:"avus"`
+	Recursive bool                   `json:"recursive,omitempty"` // if true, applied to all data objects and collections under the collection too
+}
+
+func NewIRODSMetadataRequest(operation IRODSMetadataOperation, irodsPath string, avus []IRODSAVU) *IRODSMetadataRequest {
+	return &IRODSMetadataRequest{
+		TurnInItemBase: TurnInItemBase{
+			Type:         IRODSMetadataRequestType,
+			Version:      CurrentTurnInSchemaVersion,
+			CreationTime: time.Now().Local(),
+		},
+		Operation: operation,
+		IRODSPath: irodsPath,
+		AVUs:      avus,
+	}
+}
+
+func NewIRODSMetadataRequestFromBytes(bytes []byte) (*IRODSMetadataRequest, error) {
+	var request IRODSMetadataRequest
+	err := decodeTurnInItem(bytes, &request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+func (request *IRODSMetadataRequest) MarshalJson() ([]byte, error) {
+	return encodeTurnInItem(request)
+}
+
+func (request *IRODSMetadataRequest) SaveToFile(path string) error {
+	bytes, err := request.MarshalJson()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, bytes, 0o666)
+}
+
+// Validate checks if required fields are given
+func (request *IRODSMetadataRequest) Validate() error {
+	switch request.Operation {
+	case IRODSMetadataOperationAdd, IRODSMetadataOperationSet, IRODSMetadataOperationRemove, IRODSMetadataOperationRemoveWildcard:
+	default:
+		return fmt.Errorf("unknown metadata operation - %s", request.Operation)
+	}
+
+	if len(request.IRODSPath) == 0 {
+		return fmt.Errorf("irods path is not given")
+	}
+
+	if !strings.HasPrefix(request.IRODSPath, "/") {
+		return fmt.Errorf("irods path %s is not an absolute path", request.IRODSPath)
+	}
+
+	if len(request.AVUs) == 0 {
+		return fmt.Errorf("avus are not given")
+	}
+
+	for _, avu := range request.AVUs {
+		if len(avu.Attribute) == 0 {
+			return fmt.Errorf("attribute of an avu is not given")
+		}
+
+		// iRODS does not allow empty values
+		if len(avu.Value) == 0 {
+			return fmt.Errorf("value of an avu %s is not given", avu.Attribute)
+		}
+	}
+
+	return nil
+}
+
+func (request *IRODSMetadataRequest) ToString() string {
+	avus := []string{}
+	for _, avu := range request.AVUs {
+		avus = append(avus, fmt.Sprintf("%s=%s [%s]", avu.Attribute, avu.Value, avu.Unit))
+	}
+
+	return fmt.Sprintf("irods metadata request - operation: '%s', irods path: '%s', avus: '%s', recursive: %t, timestamp: %s", request.Operation, request.IRODSPath, strings.Join(avus, ", "), request.Recursive, request.CreationTime.String())
+}
+
 // IsItemTypeSendMessage checks if the given turn-in item is SendMessage request type
 func IsItemTypeSendMessage(item TurnInItem) bool {
 	return item.GetRequestType() == SendMessageRequestType
@@ -290,3 +706,8 @@ func IsItemTypeBisque(item TurnInItem) bool {
 		return false
 	}
 }
+
+// IsItemTypeIRODS checks if the given turn-in item is a request type processed with iRODS
+func IsItemTypeIRODS(item TurnInItem) bool {
+	return item.GetRequestType() == IRODSMetadataRequestType
+}
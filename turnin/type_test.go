@@ -0,0 +1,191 @@
+package turnin
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// fuzzSeedItems returns valid items of all request types written by this version
+func fuzzSeedItems() []TurnInItem {
+	sendMessage := NewSendMessageRequest("irods.data-object.add", `{"path": "/zone/home/user/file"}`)
+	sendMessage.Headers = map[string]string{"source": "irods"}
+	sendMessage.MessageID = "msg-1"
+
+	irodsMetadata := NewIRODSMetadataRequest(IRODSMetadataOperationAdd, "/zone/home/user", []IRODSAVU{{Attribute: "attr", Value: "value", Unit: "unit"}})
+	irodsMetadata.Recursive = true
+
+	return []TurnInItem{
+		sendMessage,
+		NewLinkBisqueRequest("user", "/zone/home/user/file"),
+		NewRemoveBisqueRequest("user", "/zone/home/user/file"),
+		NewMoveBisqueRequest("user", "/zone/home/user/file", "/zone/home/user/file2"),
+		irodsMetadata,
+	}
+}
+
+func FuzzNewTurnInRequest(f *testing.F) {
+	// current schema
+	for _, item := range fuzzSeedItems() {
+		itemBytes, err := item.MarshalJson()
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		f.Add(itemBytes)
+		// truncated
+		f.Add(itemBytes[:len(itemBytes)/2])
+		f.Add(itemBytes[:len(itemBytes)-1])
+	}
+
+	// legacy schema, without version
+	f.Add([]byte(`{"type": "send_message", "key": "irods.data-object.add", "body": "{}", "creation_time": "2022-10-01T00:00:00Z"}`))
+	f.Add([]byte(`{"type": "link_bisque", "irods_username": "user", "irods_path": "/zone/home/user/file"}`))
+	f.Add([]byte(`{"type": "remove_bisque", "irods_username": "user", "irods_path": "/zone/home/user/file"}`))
+	f.Add([]byte(`{"type": "move_bisque", "irods_username": "user", "source_irods_path": "/zone/a", "dest_irods_path": "/zone/b"}`))
+	f.Add([]byte(`{"type": "irods_metadata", "operation": "rmw", "irods_path": "/zone/a", "avus": [{"attribute": "a%", "value": "%"}]}`))
+
+	// newer schema
+	f.Add([]byte(`{"type": "send_message", "version": 2, "key": "k", "body": "b", "new_field": {"a": 1}}`))
+	f.Add([]byte(`{"type": "send_message", "version": 2, "key": 1}`))
+	f.Add([]byte(`{"type": "new_request", "version": 2}`))
+
+	// garbage
+	f.Add([]byte(``))
+	f.Add([]byte(`null`))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(`"send_message"`))
+	f.Add([]byte(`{}`))
+	f.Add([]byte(`{"type": 1}`))
+	f.Add([]byte(`{"type": "send_message", "version": "1"}`))
+	f.Add([]byte(`{"type": "send_message", "version": -1}`))
+	f.Add([]byte(`{"type": "send_message", "version": 1.5}`))
+	f.Add([]byte(`{"type": "send_message", "version": 1, "creation_time": "yesterday"}`))
+	f.Add([]byte(`{"type": "irods_metadata", "version": 1, "avus": {}}`))
+	f.Add([]byte{0xff, 0xfe, 0x00})
+
+	f.Fuzz(func(t *testing.T, itemBytes []byte) {
+		item, err := NewTurnInRequest(itemBytes)
+		if err != nil {
+			if item != nil {
+				t.Fatalf("returned an item with an error - %v", err)
+			}
+
+			decodeErr, ok := err.(*DecodeError)
+			if !ok {
+				t.Fatalf("returned %T, not *DecodeError - %v", err, err)
+			}
+
+			// items written in newer schema must be left for newer versions
+			content := map[string]json.RawMessage{}
+			if json.Unmarshal(itemBytes, &content) == nil {
+				version := 0
+				if versionBytes, ok := content["version"]; ok && json.Unmarshal(versionBytes, &version) == nil && version > CurrentTurnInSchemaVersion {
+					if !decodeErr.IsNewerSchema() {
+						t.Fatalf("item in newer schema version %d is not marked newer - %v", version, err)
+					}
+				}
+			}
+			return
+		}
+
+		if item == nil {
+			t.Fatal("returned no item and no error")
+		}
+
+		// items decoded must be encoded and decoded again as the same type
+		encodedBytes, err := item.MarshalJson()
+		if err != nil {
+			t.Fatalf("failed to encode an item decoded - %v", err)
+		}
+
+		decodedItem, err := NewTurnInRequest(encodedBytes)
+		if err != nil {
+			t.Fatalf("failed to decode an item encoded again - %v", err)
+		}
+
+		if decodedItem.GetRequestType() != item.GetRequestType() {
+			t.Fatalf("request type changed from %s to %s", item.GetRequestType(), decodedItem.GetRequestType())
+		}
+	})
+}
+
+func TestParseIRODSMetadataOperation(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation string
+		expected  IRODSMetadataOperation
+		expectErr bool
+	}{
+		{name: "add", operation: "add", expected: IRODSMetadataOperationAdd},
+		{name: "set", operation: "set", expected: IRODSMetadataOperationSet},
+		{name: "rm", operation: "rm", expected: IRODSMetadataOperationRemove},
+		{name: "rmw", operation: "rmw", expected: IRODSMetadataOperationRemoveWildcard},
+		{name: "upper case", operation: "RMW", expected: IRODSMetadataOperationRemoveWildcard},
+		{name: "spaces", operation: " set ", expected: IRODSMetadataOperationSet},
+		{name: "empty", operation: "", expectErr: true},
+		{name: "unknown", operation: "mod", expectErr: true},
+		{name: "imeta flag", operation: "-r", expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operation, err := ParseIRODSMetadataOperation(test.operation)
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", operation)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+
+			if operation != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, operation)
+			}
+		})
+	}
+}
+
+func TestIRODSMetadataRequestValidate(t *testing.T) {
+	avu := IRODSAVU{Attribute: "attr", Value: "value", Unit: "unit"}
+
+	tests := []struct {
+		name      string
+		operation IRODSMetadataOperation
+		irodsPath string
+		avus      []IRODSAVU
+		expectErr bool
+	}{
+		{name: "add", operation: IRODSMetadataOperationAdd, irodsPath: "/zone/home/user/file", avus: []IRODSAVU{avu}},
+		{name: "set without unit", operation: IRODSMetadataOperationSet, irodsPath: "/zone/home/user", avus: []IRODSAVU{{Attribute: "attr", Value: "value"}}},
+		{name: "rmw with wildcards", operation: IRODSMetadataOperationRemoveWildcard, irodsPath: "/zone/home/user", avus: []IRODSAVU{{Attribute: "ipc_%", Value: "%"}}},
+		{name: "rmw with wildcards in unit", operation: IRODSMetadataOperationRemoveWildcard, irodsPath: "/zone/home/user", avus: []IRODSAVU{{Attribute: "attr_", Value: "v%", Unit: "_"}}},
+		{name: "upper case operation", operation: IRODSMetadataOperation("RMW"), irodsPath: "/zone/home/user", avus: []IRODSAVU{avu}, expectErr: true},
+		{name: "unknown operation", operation: IRODSMetadataOperation("mod"), irodsPath: "/zone/home/user", avus: []IRODSAVU{avu}, expectErr: true},
+		{name: "empty path", operation: IRODSMetadataOperationAdd, irodsPath: "", avus: []IRODSAVU{avu}, expectErr: true},
+		{name: "relative path", operation: IRODSMetadataOperationAdd, irodsPath: "home/user", avus: []IRODSAVU{avu}, expectErr: true},
+		{name: "nil avus", operation: IRODSMetadataOperationAdd, irodsPath: "/zone/home/user", avus: nil, expectErr: true},
+		{name: "empty avus", operation: IRODSMetadataOperationRemove, irodsPath: "/zone/home/user", avus: []IRODSAVU{}, expectErr: true},
+		{name: "missing attribute", operation: IRODSMetadataOperationAdd, irodsPath: "/zone/home/user", avus: []IRODSAVU{{Value: "value"}}, expectErr: true},
+		{name: "missing attribute after valid", operation: IRODSMetadataOperationSet, irodsPath: "/zone/home/user", avus: []IRODSAVU{avu, {Value: "value"}}, expectErr: true},
+		{name: "missing value", operation: IRODSMetadataOperationAdd, irodsPath: "/zone/home/user", avus: []IRODSAVU{{Attribute: "attr"}}, expectErr: true},
+		{name: "rmw missing attribute", operation: IRODSMetadataOperationRemoveWildcard, irodsPath: "/zone/home/user", avus: []IRODSAVU{{Value: "%"}}, expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := NewIRODSMetadataRequest(test.operation, test.irodsPath, test.avus)
+
+			err := request.Validate()
+			if test.expectErr && err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+
+			if !test.expectErr && err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+		})
+	}
+}